@@ -17,6 +17,10 @@ INSERT INTO businesses (name, category, latitude, longitude, address, phone, web
 ('パン工房 麦の香', 'ベーカリー', 35.7295, 139.7181, '東京都文京区本郷1-2-3', '03-7890-1234', 'https://mugi-kaori.com', '毎朝焼き立てのパンが楽しめる町のベーカリー', NOW(), NOW()),
 ('中華楼 龍園', '中華', 35.6944, 139.6444, '東京都渋谷区代々木2-1-1', '03-8901-2345', 'https://ryuen.com', '本格四川料理と広東料理が味わえる中華レストラン', NOW(), NOW());
 
+-- Sample Business Owners
+UPDATE businesses SET owner_id = (SELECT id FROM users WHERE email = 'yamada@example.com') WHERE name = 'ラーメン山田';
+UPDATE businesses SET owner_id = (SELECT id FROM users WHERE email = 'sato@example.com') WHERE name IN ('カフェ・ドリーム', 'パン工房 麦の香');
+
 -- Sample Reviews
 INSERT INTO reviews (business_id, user_id, rating, text, created_at, updated_at) VALUES
 (1, 1, 5, '醤油ラーメンが絶品！麺のコシも最高で、また来たいと思います。', NOW(), NOW()),
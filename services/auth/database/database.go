@@ -1,11 +1,15 @@
 package database
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/metrics"
 	"github.com/yelp-sample-v2/shared/models"
+	"github.com/yelp-sample-v2/shared/tracing/gormtrace"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -45,10 +49,37 @@ func Connect() {
 
 	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logger.Fatal("Failed to connect to database", "error", err)
 	}
+	if err := DB.Use(gormtrace.Plugin{}); err != nil {
+		logger.Fatal("Failed to trace database queries", "error", err)
+	}
+
+	sqlDB, err := DB.DB()
+	if err != nil {
+		logger.Fatal("Failed to get database connection pool", "error", err)
+	}
+	metrics.RegisterDB(dbname, sqlDB)
+
+	slog.Info("Connected to database")
+}
 
-	log.Println("Connected to database successfully")
+// Ping checks that the database answers, for the readiness probe
+func Ping(ctx context.Context) error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Close closes the connection pool once no more queries will run
+func Close() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
 
 func Migrate() {
@@ -56,10 +87,19 @@ func Migrate() {
 		&models.User{},
 		&models.Business{},
 		&models.Review{},
+		&models.Collection{},
+		&models.CollectionItem{},
+		&models.Follow{},
+		&models.FeedItem{},
+		&models.Checkin{},
+		&models.ErasureRequest{},
+		&models.ErasureStep{},
+		&models.BusinessActivityRollup{},
+		&models.CategoryActivityRollup{},
 	)
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		logger.Fatal("Failed to migrate database", "error", err)
 	}
 
-	log.Println("Database migration completed successfully")
+	slog.Info("Database migration completed")
 }
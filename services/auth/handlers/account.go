@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth/database"
+	"auth/userdata"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/models"
+	"github.com/yelp-sample-v2/shared/server"
+	"gorm.io/gorm"
+)
+
+// authServiceStep is the erasure step for the account itself. It always runs last,
+// so the user can still sign in and resume an erasure that failed part-way.
+const authServiceStep = "auth-service"
+
+func getUserID(c *gin.Context) uint {
+	// Get user ID from header (set by API Gateway)
+	userIDStr := c.GetHeader("X-User-ID")
+	if userIDStr != "" {
+		if userID, err := strconv.ParseUint(userIDStr, 10, 32); err == nil {
+			return uint(userID)
+		}
+	}
+	return 0
+}
+
+type exportManifest struct {
+	UserID      uint      `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+}
+
+// ExportMe builds a zip archive of everything stored about the current user
+func ExportMe(c *gin.Context) {
+	// Calls every service, each of which may take up to the client's 30s timeout; the
+	// gateway allows the route 2 minutes
+	server.WriteDeadline(c, 2*time.Minute)
+
+	userID := getUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	files := map[string]interface{}{"profile.json": user.ToPrivate()}
+	names := []string{"profile.json"}
+	for _, service := range userdata.Services() {
+		data, err := userdata.Fetch(c.Request.Context(), service, userID)
+		if err != nil {
+			logger.From(c.Request.Context()).Error("Export failed", "user_id", userID, "error", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to collect data from " + service.Name})
+			return
+		}
+		name := service.Name + ".json"
+		files[name] = data
+		names = append(names, name)
+	}
+
+	manifest := exportManifest{UserID: userID, GeneratedAt: time.Now().UTC(), Files: names}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	if err := writeJSONFile(archive, "manifest.json", manifest); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build export"})
+		return
+	}
+	for _, name := range names {
+		if err := writeJSONFile(archive, name, files[name]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build export"})
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build export"})
+		return
+	}
+
+	filename := fmt.Sprintf("user-%d-export-%s.zip", userID, manifest.GeneratedAt.Format("20060102"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+func writeJSONFile(archive *zip.Writer, name string, v interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// DeleteMe erases the current user's data in every service and then the account itself.
+// Progress is recorded per service; calling it again after a failure resumes with the
+// steps that have not completed.
+func DeleteMe(c *gin.Context) {
+	// Like an export, erasure waits on every service
+	server.WriteDeadline(c, 2*time.Minute)
+
+	userID := getUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	request, err := findOrStartErasure(c.Request.Context(), userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start erasure"})
+		return
+	}
+
+	if request.Status != models.ErasureCompleted {
+		runErasure(c, request)
+	}
+
+	if request.Status != models.ErasureCompleted {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Erasure did not complete; call DELETE /auth/me again to resume",
+			"erasure": request,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account and data erased",
+		"erasure": request,
+	})
+}
+
+// GetErasureStatus reports the progress of the current user's erasure
+func GetErasureStatus(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var request models.ErasureRequest
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Steps", orderSteps).Where("user_id = ?", userID).First(&request).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No erasure requested"})
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+func orderSteps(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC")
+}
+
+// findOrStartErasure loads the user's erasure request, creating it with one step per service
+func findOrStartErasure(ctx context.Context, userID uint) (*models.ErasureRequest, error) {
+	var request models.ErasureRequest
+	err := database.DB.WithContext(ctx).Preload("Steps", orderSteps).Where("user_id = ?", userID).First(&request).Error
+	if err == nil {
+		return &request, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	// Only existing accounts can start an erasure
+	var user models.User
+	if err := database.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	request = models.ErasureRequest{UserID: userID, Status: models.ErasurePending}
+	for i, service := range userdata.Services() {
+		request.Steps = append(request.Steps, models.ErasureStep{
+			Service:  service.Name,
+			Position: i,
+			Status:   models.ErasurePending,
+		})
+	}
+	request.Steps = append(request.Steps, models.ErasureStep{
+		Service:  authServiceStep,
+		Position: len(request.Steps),
+		Status:   models.ErasurePending,
+	})
+
+	if err := database.DB.WithContext(ctx).Create(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// runErasure runs every incomplete step. Service steps are independent, so a failure
+// doesn't stop the others; the account is only erased once they have all completed.
+func runErasure(c *gin.Context, request *models.ErasureRequest) {
+	database.DB.WithContext(c.Request.Context()).Model(request).Update("status", models.ErasureInProgress)
+
+	services := map[string]userdata.Service{}
+	for _, service := range userdata.Services() {
+		services[service.Name] = service
+	}
+
+	allCompleted := true
+	for i := range request.Steps {
+		step := &request.Steps[i]
+		if step.Status == models.ErasureCompleted {
+			continue
+		}
+		if step.Service == authServiceStep && !allCompleted {
+			continue
+		}
+
+		var err error
+		if step.Service == authServiceStep {
+			err = eraseAccount(c.Request.Context(), request.UserID)
+		} else if service, ok := services[step.Service]; ok {
+			err = userdata.Erase(c.Request.Context(), service, request.UserID)
+		} else {
+			err = fmt.Errorf("unknown service %s", step.Service)
+		}
+
+		step.Attempts++
+		if err != nil {
+			logger.From(c.Request.Context()).Error("Erasure step failed", "user_id", request.UserID, "step", step.Service, "error", err)
+			step.Status = models.ErasureFailed
+			step.LastError = err.Error()
+			allCompleted = false
+		} else {
+			now := time.Now()
+			step.Status = models.ErasureCompleted
+			step.LastError = ""
+			step.CompletedAt = &now
+		}
+		database.DB.WithContext(c.Request.Context()).Save(step)
+	}
+
+	if allCompleted {
+		now := time.Now()
+		request.Status = models.ErasureCompleted
+		request.CompletedAt = &now
+	} else {
+		request.Status = models.ErasureFailed
+	}
+	database.DB.WithContext(c.Request.Context()).Model(request).Updates(map[string]interface{}{
+		"status":       request.Status,
+		"completed_at": request.CompletedAt,
+	})
+}
+
+// eraseAccount scrubs the user's personal fields and deletes the account.
+// The row is kept (soft-deleted) so the ID is never reused.
+func eraseAccount(ctx context.Context, userID uint) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"name":     "Deleted user",
+			"email":    fmt.Sprintf("deleted-%d@deleted.invalid", userID),
+			"password": "",
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, userID).Error
+	})
+}
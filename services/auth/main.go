@@ -2,22 +2,36 @@ package main
 
 import (
 	"auth/handlers"
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
-	"os"
 
 	"auth/database"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/health"
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/metrics"
+	"github.com/yelp-sample-v2/shared/server"
+	"github.com/yelp-sample-v2/shared/tracing"
 )
 
 func main() {
+	// Log JSON to stdout, at LOG_LEVEL and above
+	logger.Start(logger.ConfigFromEnv("auth-service"))
+
+	// Trace requests, including their database queries and calls to other services
+	if err := tracing.Start(tracing.ConfigFromEnv("auth-service")); err != nil {
+		logger.Fatal("Failed to start tracing", "error", err)
+	}
+
 	// Connect to database
 	database.Connect()
 	database.Migrate()
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(tracing.Middleware(), logger.Middleware("X-User-ID"), metrics.Middleware(), logger.Recovery())
+	srv := server.New(server.ConfigFromEnv("8084"), r)
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -27,12 +41,13 @@ func main() {
 		})
 	})
 
-	r.GET("/ready", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "ready",
-			"service": "auth-service",
-		})
-	})
+	// Ready while the database answers
+	checks := health.New(health.ConfigFromEnv())
+	checks.Critical("postgres", database.Ping)
+	r.GET("/ready", srv.CheckReady, checks.Ready)
+
+	// Prometheus metrics
+	r.GET("/metrics", metrics.Handler())
 
 	// Authentication routes
 	auth := r.Group("/auth")
@@ -41,13 +56,19 @@ func main() {
 		auth.POST("/login", handlers.Login)
 		auth.POST("/logout", handlers.Logout)
 		auth.GET("/me", handlers.GetMe)
-	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8084"
+		// Data export and erasure of the current user
+		auth.POST("/me/export", handlers.ExportMe)
+		auth.DELETE("/me", handlers.DeleteMe)
+		auth.GET("/me/erasure", handlers.GetErasureStatus)
 	}
 
-	fmt.Printf("Auth service starting on port %s\n", port)
-	log.Fatal(r.Run(":" + port))
+	// Once in-flight requests finish, deliver buffered spans and close the database pool
+	srv.OnShutdown("database", func(context.Context) error { return database.Close() })
+	srv.OnShutdown("tracing", tracing.Close)
+
+	slog.Info("Auth service starting", "addr", srv.HTTP.Addr)
+	if err := srv.Run(); err != nil {
+		logger.Fatal("Failed to start server", "error", err)
+	}
 }
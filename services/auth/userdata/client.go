@@ -0,0 +1,88 @@
+package userdata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/yelp-sample-v2/shared/tracing"
+)
+
+// Service is a service that holds user data behind /internal/users/:id/data
+type Service struct {
+	Name string
+	URL  string
+}
+
+// Services returns the services whose data is exported and erased, in erasure order.
+// The auth service's own data is handled last by the caller.
+func Services() []Service {
+	return []Service{
+		{Name: "business-service", URL: serviceURL("BUSINESS_SERVICE_URL", "http://business-service:8081")},
+		{Name: "review-service", URL: serviceURL("REVIEW_SERVICE_URL", "http://review-service:8082")},
+		{Name: "logging-service", URL: serviceURL("LOGGING_SERVICE_URL", "http://logging-service:8083")},
+	}
+}
+
+func serviceURL(env, fallback string) string {
+	if url := os.Getenv(env); url != "" {
+		return url
+	}
+	return fallback
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second, Transport: tracing.NewTransport("", nil)}
+
+func dataURL(service Service, userID uint) string {
+	return fmt.Sprintf("%s/internal/users/%d/data", service.URL, userID)
+}
+
+// Fetch returns the user's data held by a service as JSON
+func Fetch(ctx context.Context, service Service, userID uint) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dataURL(service, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", service.Name, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", service.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", service.Name, resp.StatusCode)
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("%s returned invalid JSON", service.Name)
+	}
+	return body, nil
+}
+
+// Erase asks a service to erase the user's data. Services treat repeated calls as no-ops.
+func Erase(ctx context.Context, service Service, userID uint) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, dataURL(service, userID), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", service.Name, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", service.Name, resp.StatusCode)
+	}
+	return nil
+}
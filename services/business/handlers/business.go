@@ -2,17 +2,46 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/events"
 	"github.com/yelp-sample-v2/shared/models"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"business/database"
 )
 
+// BusinessDetail is a business as seen by the current (possibly anonymous) user
+type BusinessDetail struct {
+	models.PublicBusiness
+	Bookmarked bool `json:"bookmarked"`
+}
+
+func getUserID(c *gin.Context) uint {
+	// Get user ID from header (set by API Gateway)
+	if id, err := strconv.Atoi(c.GetHeader("X-User-ID")); err == nil && id > 0 {
+		return uint(id)
+	}
+
+	// Anonymous user
+	return 0
+}
+
+// emitEvent queues an analytics event; request data is copied before the handler returns
+func emitEvent(c *gin.Context, eventType string, userID uint, businessID uint, payload interface{}) {
+	event, err := events.New(eventType, int(userID), int(businessID), payload)
+	if err != nil {
+		return
+	}
+	event.IPAddress = c.ClientIP()
+	event.UserAgent = c.GetHeader("User-Agent")
+	events.Emit(event)
+}
+
 func SearchBusinesses(c *gin.Context) {
 	var businesses []models.Business
 
-	query := database.DB.Model(&models.Business{})
+	query := database.DB.WithContext(c.Request.Context()).Model(&models.Business{})
 
 	if category := c.Query("category"); category != "" {
 		query = query.Where("category ILIKE ?", "%"+category+"%")
@@ -43,17 +72,33 @@ func SearchBusinesses(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, businesses)
+	// Lets the gateway cache drop the listing when one of these businesses changes
+	tags := []string{"businesses"}
+	for _, business := range businesses {
+		tags = append(tags, "business:"+strconv.Itoa(int(business.ID)))
+	}
+	c.Header("X-Cache-Tags", strings.Join(tags, " "))
+
+	c.JSON(http.StatusOK, models.ToPublicBusinesses(businesses))
 }
 
 func GetBusiness(c *gin.Context) {
 	id := c.Param("id")
 
 	var business models.Business
-	if err := database.DB.First(&business, id).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&business, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Business not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, business)
+	userID := getUserID(c)
+	emitEvent(c, events.TypeBusinessView, userID, business.ID, events.BusinessView{
+		Referrer: c.GetHeader("Referer"),
+	})
+
+	c.Header("X-Cache-Tags", "business:"+strconv.Itoa(int(business.ID)))
+	c.JSON(http.StatusOK, BusinessDetail{
+		PublicBusiness: business.ToPublic(),
+		Bookmarked:     isBookmarked(c.Request.Context(), userID, business.ID),
+	})
 }
@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/events"
+	"github.com/yelp-sample-v2/shared/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"business/database"
+)
+
+type CreateCollectionRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=1000"`
+	IsPublic    bool   `json:"is_public"`
+}
+
+type UpdateCollectionRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=1000"`
+	IsPublic    *bool   `json:"is_public"`
+}
+
+type AddCollectionItemRequest struct {
+	BusinessID uint   `json:"business_id" binding:"required"`
+	Note       string `json:"note" binding:"max=1000"`
+}
+
+type UpdateCollectionItemRequest struct {
+	Note string `json:"note" binding:"max=1000"`
+}
+
+type ReorderCollectionItemsRequest struct {
+	BusinessIDs []uint `json:"business_ids" binding:"required"`
+}
+
+// preloadCollectionItems loads items in their saved order together with the businesses
+func preloadCollectionItems(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC, id ASC")
+	}).Preload("Items.Business")
+}
+
+// findOwnedCollection loads a collection owned by the current user, writing an error response if it can't
+func findOwnedCollection(c *gin.Context, userID uint) (*models.Collection, bool) {
+	var collection models.Collection
+	if err := database.DB.WithContext(c.Request.Context()).Where("user_id = ?", userID).First(&collection, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return nil, false
+	}
+	return &collection, true
+}
+
+func GetMyCollections(c *gin.Context) {
+	userID := getUserID(c)
+
+	var collections []models.Collection
+	if err := preloadCollectionItems(database.DB.WithContext(c.Request.Context())).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ToPublicCollections(collections))
+}
+
+func GetUserCollections(c *gin.Context) {
+	ownerID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Where("user_id = ?", ownerID)
+	if uint(ownerID) != getUserID(c) {
+		query = query.Where("is_public = ?", true)
+	}
+
+	var collections []models.Collection
+	if err := query.Order("created_at DESC").Find(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ToPublicCollections(collections))
+}
+
+func CreateCollection(c *gin.Context) {
+	var req CreateCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := models.Collection{
+		UserID:      getUserID(c),
+		Name:        req.Name,
+		Description: req.Description,
+		IsPublic:    req.IsPublic,
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Create(&collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create collection"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, collection.ToPublic())
+}
+
+func GetCollection(c *gin.Context) {
+	var collection models.Collection
+	if err := preloadCollectionItems(database.DB.WithContext(c.Request.Context())).First(&collection, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	// Private collections are only visible to their owner
+	if !collection.IsPublic && collection.UserID != getUserID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, collection.ToPublic())
+}
+
+func UpdateCollection(c *gin.Context) {
+	collection, ok := findOwnedCollection(c, getUserID(c))
+	if !ok {
+		return
+	}
+
+	var req UpdateCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.IsPublic != nil {
+		updates["is_public"] = *req.IsPublic
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.WithContext(c.Request.Context()).Model(collection).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update collection"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, collection.ToPublic())
+}
+
+func DeleteCollection(c *gin.Context) {
+	collection, ok := findOwnedCollection(c, getUserID(c))
+	if !ok {
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.CollectionItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(collection).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func AddCollectionItem(c *gin.Context) {
+	collection, ok := findOwnedCollection(c, getUserID(c))
+	if !ok {
+		return
+	}
+
+	var req AddCollectionItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var business models.Business
+	if err := database.DB.WithContext(c.Request.Context()).First(&business, req.BusinessID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business not found"})
+		return
+	}
+
+	// New items are appended to the end of the collection
+	var maxPosition int
+	database.DB.WithContext(c.Request.Context()).Model(&models.CollectionItem{}).
+		Where("collection_id = ?", collection.ID).
+		Select("COALESCE(MAX(position), 0)").
+		Row().Scan(&maxPosition)
+
+	item := models.CollectionItem{
+		CollectionID: collection.ID,
+		BusinessID:   req.BusinessID,
+		Position:     maxPosition + 1,
+		Note:         req.Note,
+	}
+
+	// The unique index decides between concurrent adds of the same business
+	result := database.DB.WithContext(c.Request.Context()).Clauses(clause.OnConflict{DoNothing: true}).Create(&item)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add business to collection"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Business is already in this collection"})
+		return
+	}
+
+	emitEvent(c, events.TypeBookmarkAdded, collection.UserID, business.ID, events.BookmarkAdded{
+		CollectionID: int(collection.ID),
+	})
+
+	item.Business = business
+	c.JSON(http.StatusCreated, item.ToPublic())
+}
+
+func UpdateCollectionItem(c *gin.Context) {
+	collection, ok := findOwnedCollection(c, getUserID(c))
+	if !ok {
+		return
+	}
+
+	var req UpdateCollectionItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var item models.CollectionItem
+	if err := database.DB.WithContext(c.Request.Context()).Where("collection_id = ? AND business_id = ?", collection.ID, c.Param("business_id")).
+		First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business is not in this collection"})
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Model(&item).Update("note", req.Note).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update collection item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, item.ToPublic())
+}
+
+func RemoveCollectionItem(c *gin.Context) {
+	collection, ok := findOwnedCollection(c, getUserID(c))
+	if !ok {
+		return
+	}
+
+	result := database.DB.WithContext(c.Request.Context()).Where("collection_id = ? AND business_id = ?", collection.ID, c.Param("business_id")).
+		Delete(&models.CollectionItem{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove business from collection"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business is not in this collection"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+var errReorderMismatch = errors.New("business_ids must list every business in the collection exactly once")
+
+func ReorderCollectionItems(c *gin.Context) {
+	collection, ok := findOwnedCollection(c, getUserID(c))
+	if !ok {
+		return
+	}
+
+	var req ReorderCollectionItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var items []models.CollectionItem
+		if err := tx.Where("collection_id = ?", collection.ID).Find(&items).Error; err != nil {
+			return err
+		}
+
+		// The new order must be a permutation of the current items
+		if len(items) != len(req.BusinessIDs) {
+			return errReorderMismatch
+		}
+		current := make(map[uint]bool, len(items))
+		for _, item := range items {
+			current[item.BusinessID] = true
+		}
+		for _, businessID := range req.BusinessIDs {
+			if !current[businessID] {
+				return errReorderMismatch
+			}
+			delete(current, businessID)
+		}
+
+		for i, businessID := range req.BusinessIDs {
+			if err := tx.Model(&models.CollectionItem{}).
+				Where("collection_id = ? AND business_id = ?", collection.ID, businessID).
+				Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errReorderMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder collection"})
+		return
+	}
+
+	if err := preloadCollectionItems(database.DB.WithContext(c.Request.Context())).First(collection, collection.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, collection.ToPublic())
+}
+
+// isBookmarked reports whether the business is saved in any of the user's collections
+func isBookmarked(ctx context.Context, userID uint, businessID uint) bool {
+	if userID == 0 {
+		return false
+	}
+
+	var count int64
+	database.DB.WithContext(ctx).Model(&models.CollectionItem{}).
+		Joins("JOIN collections ON collections.id = collection_items.collection_id AND collections.deleted_at IS NULL").
+		Where("collections.user_id = ? AND collection_items.business_id = ?", userID, businessID).
+		Count(&count)
+	return count > 0
+}
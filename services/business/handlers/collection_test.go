@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"business/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/models"
+	"github.com/yelp-sample-v2/shared/models/modelstest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var fixture struct {
+	owner, visitor models.User
+	business       models.Business
+	public         models.Collection
+	private        models.Collection
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	dir, err := os.MkdirTemp("", "business-handlers")
+	if err != nil {
+		panic(err)
+	}
+
+	code := func() int {
+		defer os.RemoveAll(dir)
+		if err := openTestDB(filepath.Join(dir, "test.db")); err != nil {
+			panic(err)
+		}
+		defer database.Close()
+		return m.Run()
+	}()
+	os.Exit(code)
+}
+
+// openTestDB points the handlers at a fresh SQLite database with the fixture loaded
+func openTestDB(path string) error {
+	db, err := gorm.Open(sqlite.Open(path+"?_busy_timeout=5000"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return err
+	}
+	database.DB = db
+
+	if err := db.AutoMigrate(&models.User{}, &models.Business{}, &models.Collection{}, &models.CollectionItem{}); err != nil {
+		return err
+	}
+
+	fixture.owner = models.User{Name: "Owner", Email: "owner@example.com", Password: "owner-password-hash"}
+	fixture.visitor = models.User{Name: "Visitor", Email: "visitor@example.com", Password: "visitor-password-hash"}
+	if err := db.Create(&[]*models.User{&fixture.owner, &fixture.visitor}).Error; err != nil {
+		return err
+	}
+
+	fixture.business = models.Business{Name: "Cafe", Category: "cafe", Latitude: 35.68, Longitude: 139.76, OwnerID: &fixture.owner.ID}
+	if err := db.Create(&fixture.business).Error; err != nil {
+		return err
+	}
+
+	fixture.public = models.Collection{UserID: fixture.owner.ID, Name: "Favorites", IsPublic: true}
+	fixture.private = models.Collection{UserID: fixture.owner.ID, Name: "Maybe later"}
+	if err := db.Create(&[]*models.Collection{&fixture.public, &fixture.private}).Error; err != nil {
+		return err
+	}
+	return db.Create(&[]models.CollectionItem{
+		{CollectionID: fixture.public.ID, BusinessID: fixture.business.ID, Note: "Try the cake"},
+		{CollectionID: fixture.private.ID, BusinessID: fixture.business.ID},
+	}).Error
+}
+
+func TestCollectionRoutesOmitPII(t *testing.T) {
+	r := gin.New()
+	r.GET("/businesses/:id", GetBusiness)
+	r.GET("/collections", GetMyCollections)
+	r.GET("/collections/:id", GetCollection)
+	r.GET("/users/:id/collections", GetUserCollections)
+
+	tests := []struct {
+		name   string
+		path   string
+		userID uint
+	}{
+		{"business", fmt.Sprintf("/businesses/%d", fixture.business.ID), 0},
+		{"public collection", fmt.Sprintf("/collections/%d", fixture.public.ID), fixture.visitor.ID},
+		{"own private collection", fmt.Sprintf("/collections/%d", fixture.private.ID), fixture.owner.ID},
+		{"own collections", "/collections", fixture.owner.ID},
+		{"user collections", fmt.Sprintf("/users/%d/collections", fixture.owner.ID), fixture.visitor.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.userID != 0 {
+				req.Header.Set("X-User-ID", strconv.Itoa(int(tt.userID)))
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s answered %d: %s", tt.path, w.Code, w.Body.String())
+			}
+
+			var body any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("GET %s answered invalid JSON: %v", tt.path, err)
+			}
+			if keys := modelstest.FindPII(body); len(keys) > 0 {
+				t.Errorf("GET %s serialized personal data at %v", tt.path, keys)
+			}
+			for _, user := range []models.User{fixture.owner, fixture.visitor} {
+				if strings.Contains(w.Body.String(), user.Email) || strings.Contains(w.Body.String(), user.Password) {
+					t.Errorf("GET %s contains the credentials of %s", tt.path, user.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestAddCollectionItemConcurrently(t *testing.T) {
+	bakery := models.Business{Name: "Bakery", Category: "bakery", Latitude: 35.67, Longitude: 139.75}
+	if err := database.DB.Create(&bakery).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold each insert long enough for every request to have looked for the item
+	slowInsert := func(db *gorm.DB) {
+		if db.Statement.Table == "collection_items" {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if err := database.DB.Callback().Create().Before("gorm:create").Register("test:slow_collection_item", slowInsert); err != nil {
+		t.Fatal(err)
+	}
+	defer database.DB.Callback().Create().Remove("test:slow_collection_item")
+
+	r := gin.New()
+	r.POST("/collections/:id/items", AddCollectionItem)
+
+	path := fmt.Sprintf("/collections/%d/items", fixture.private.ID)
+	body := fmt.Sprintf(`{"business_id":%d}`, bakery.ID)
+
+	const attempts = 10
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-User-ID", strconv.Itoa(int(fixture.owner.ID)))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != attempts-1 {
+		t.Errorf("concurrent adds answered %v, want one 201 and %d 409", counts, attempts-1)
+	}
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"business/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/geo"
+	"github.com/yelp-sample-v2/shared/models"
+)
+
+// Activity weights: a review says more about a business than a bookmark, and a bookmark more than a view
+const (
+	viewWeight     = 1
+	bookmarkWeight = 3
+	reviewWeight   = 5
+)
+
+// trendingSmoothing is added to both sides of the growth ratio so a handful of views
+// on a business with no history doesn't outrank steady growth on a busy one
+const trendingSmoothing = 5.0
+
+// TrendStats is a business's recent activity compared with its baseline
+type TrendStats struct {
+	RecentViews     int64    `json:"recent_views"`
+	RecentReviews   int64    `json:"recent_reviews"`
+	RecentBookmarks int64    `json:"recent_bookmarks"`
+	RecentScore     float64  `json:"recent_score"`
+	BaselineScore   float64  `json:"baseline_score"`
+	Growth          float64  `json:"growth"`
+	DistanceKm      *float64 `json:"distance_km,omitempty"`
+}
+
+// TrendingBusiness is a business ranked by GetTrendingBusinesses
+type TrendingBusiness struct {
+	models.PublicBusiness
+	Trend TrendStats `json:"trend"`
+}
+
+type TrendingResponse struct {
+	Window       string             `json:"window"`
+	BaselineDays int                `json:"baseline_days"`
+	GeneratedAt  time.Time          `json:"generated_at"`
+	Businesses   []TrendingBusiness `json:"businesses"`
+}
+
+type trendingRow struct {
+	BusinessID      uint
+	RecentViews     int64
+	RecentReviews   int64
+	RecentBookmarks int64
+	BaselineScore   float64
+}
+
+// GetTrendingBusinesses ranks businesses by their activity in the recent window relative to
+// their average activity over the preceding days. Activity comes from the rollup tables.
+func GetTrendingBusinesses(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("window", "24h"))
+	if err != nil || window < time.Hour || window > 7*24*time.Hour || window%time.Hour != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a whole number of hours between 1h and 168h"})
+		return
+	}
+
+	baselineDays, err := strconv.Atoi(c.DefaultQuery("baseline_days", "7"))
+	if err != nil || baselineDays < 1 || baselineDays > 30 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "baseline_days must be between 1 and 30"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	// Optional geo filter: lat and lng together, with a radius in kilometers
+	var nearby bool
+	var lat, lng, radiusKm float64
+	if c.Query("lat") != "" || c.Query("lng") != "" {
+		var errLat, errLng error
+		lat, errLat = strconv.ParseFloat(c.Query("lat"), 64)
+		lng, errLng = strconv.ParseFloat(c.Query("lng"), 64)
+		if errLat != nil || errLng != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng must both be valid coordinates"})
+			return
+		}
+		radiusKm, err = strconv.ParseFloat(c.DefaultQuery("radius_km", "10"), 64)
+		if err != nil || radiusKm <= 0 || radiusKm > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "radius_km must be between 0 and 100"})
+			return
+		}
+		nearby = true
+	}
+
+	// The recent window is made of hourly buckets, including the current partial hour.
+	// The baseline is the full days before the window starts.
+	now := time.Now().UTC()
+	recentStart := now.Truncate(time.Hour).Add(-window + time.Hour)
+	baselineEnd := recentStart.Truncate(24 * time.Hour)
+	baselineStart := baselineEnd.AddDate(0, 0, -baselineDays)
+
+	query := database.DB.WithContext(c.Request.Context()).Table("business_activity_rollups AS r").
+		Select(`r.business_id,
+			SUM(CASE WHEN r.granularity = ? THEN r.views ELSE 0 END) AS recent_views,
+			SUM(CASE WHEN r.granularity = ? THEN r.reviews ELSE 0 END) AS recent_reviews,
+			SUM(CASE WHEN r.granularity = ? THEN r.bookmarks ELSE 0 END) AS recent_bookmarks,
+			SUM(CASE WHEN r.granularity = ? THEN r.views * ? + r.bookmarks * ? + r.reviews * ? ELSE 0 END) AS baseline_score`,
+			models.RollupHour, models.RollupHour, models.RollupHour,
+			models.RollupDay, viewWeight, bookmarkWeight, reviewWeight).
+		Joins("JOIN businesses b ON b.id = r.business_id AND b.deleted_at IS NULL").
+		Where("(r.granularity = ? AND r.bucket_start >= ?) OR (r.granularity = ? AND r.bucket_start >= ? AND r.bucket_start < ?)",
+			models.RollupHour, recentStart, models.RollupDay, baselineStart, baselineEnd)
+
+	if category := c.Query("category"); category != "" {
+		query = query.Where("b.category ILIKE ?", "%"+category+"%")
+	}
+
+	if nearby {
+		// Bounding box in SQL; the exact distance is checked below
+		latDelta := radiusKm / 111.0
+		lngDelta := 180.0
+		if cos := math.Cos(lat * math.Pi / 180); cos > 0.01 {
+			lngDelta = math.Min(radiusKm/(111.0*cos), 180)
+		}
+		query = query.Where("b.latitude BETWEEN ? AND ?", lat-latDelta, lat+latDelta)
+		if lngDelta < 180 {
+			query = query.Where("b.longitude BETWEEN ? AND ?", lng-lngDelta, lng+lngDelta)
+		}
+	}
+
+	var rows []trendingRow
+	if err := query.Group("r.business_id").
+		Having("SUM(CASE WHEN r.granularity = ? THEN r.views + r.reviews + r.bookmarks ELSE 0 END) > 0", models.RollupHour).
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load trending businesses"})
+		return
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.BusinessID)
+	}
+
+	businesses := map[uint]models.Business{}
+	if len(ids) > 0 {
+		var found []models.Business
+		if err := database.DB.WithContext(c.Request.Context()).Where("id IN ?", ids).Find(&found).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load trending businesses"})
+			return
+		}
+		for _, business := range found {
+			businesses[business.ID] = business
+		}
+	}
+
+	// The baseline covers whole days; scale it to the length of the recent window
+	baselineScale := window.Hours() / float64(baselineDays*24)
+
+	trending := make([]TrendingBusiness, 0, len(rows))
+	for _, row := range rows {
+		business, ok := businesses[row.BusinessID]
+		if !ok {
+			continue
+		}
+
+		stats := TrendStats{
+			RecentViews:     row.RecentViews,
+			RecentReviews:   row.RecentReviews,
+			RecentBookmarks: row.RecentBookmarks,
+			RecentScore: float64(row.RecentViews*viewWeight +
+				row.RecentBookmarks*bookmarkWeight +
+				row.RecentReviews*reviewWeight),
+			BaselineScore: row.BaselineScore * baselineScale,
+		}
+		stats.Growth = (stats.RecentScore + trendingSmoothing) / (stats.BaselineScore + trendingSmoothing)
+
+		if nearby {
+			distanceKm := geo.DistanceMeters(lat, lng, business.Latitude, business.Longitude) / 1000
+			if distanceKm > radiusKm {
+				continue
+			}
+			stats.DistanceKm = &distanceKm
+		}
+
+		trending = append(trending, TrendingBusiness{PublicBusiness: business.ToPublic(), Trend: stats})
+	}
+
+	sort.SliceStable(trending, func(i, j int) bool {
+		if trending[i].Trend.Growth != trending[j].Trend.Growth {
+			return trending[i].Trend.Growth > trending[j].Trend.Growth
+		}
+		if trending[i].Trend.RecentScore != trending[j].Trend.RecentScore {
+			return trending[i].Trend.RecentScore > trending[j].Trend.RecentScore
+		}
+		return trending[i].ID < trending[j].ID
+	})
+	if len(trending) > limit {
+		trending = trending[:limit]
+	}
+
+	c.JSON(http.StatusOK, TrendingResponse{
+		Window:       window.String(),
+		BaselineDays: baselineDays,
+		GeneratedAt:  now,
+		Businesses:   trending,
+	})
+}
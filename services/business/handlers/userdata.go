@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/models"
+	"gorm.io/gorm"
+
+	"business/database"
+)
+
+// Internal endpoints used by the auth service for data export and erasure.
+// They are not routed through the API gateway.
+
+func ExportUserData(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	var collections []models.Collection
+	if err := preloadCollectionItems(database.DB.WithContext(c.Request.Context())).
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export collections"})
+		return
+	}
+
+	var owned []models.Business
+	if err := database.DB.WithContext(c.Request.Context()).Where("owner_id = ?", userID).Order("id ASC").Find(&owned).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export owned businesses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"collections":      models.ToPublicCollections(collections),
+		"owned_businesses": models.ToPublicBusinesses(owned),
+	})
+}
+
+// EraseUserData permanently deletes the user's collections, including soft-deleted ones,
+// and unlinks the businesses they own. It is idempotent so the auth service can retry it.
+func EraseUserData(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	var erased int64
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id IN (SELECT id FROM collections WHERE user_id = ?)", userID).
+			Delete(&models.CollectionItem{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.Collection{})
+		if result.Error != nil {
+			return result.Error
+		}
+		erased = result.RowsAffected
+
+		// The businesses stay listed; they just no longer have an owner
+		return tx.Unscoped().Model(&models.Business{}).Where("owner_id = ?", userID).
+			Update("owner_id", nil).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase collections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"erased":      true,
+		"collections": erased,
+	})
+}
+
+// GetOwnedBusinesses lists the IDs of the businesses a user owns. The logging service
+// uses it to authorize live activity streams.
+func GetOwnedBusinesses(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	businessIDs := []uint{}
+	if err := database.DB.WithContext(c.Request.Context()).Model(&models.Business{}).Where("owner_id = ?", userID).
+		Order("id ASC").Pluck("id", &businessIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load owned businesses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"business_ids": businessIDs})
+}
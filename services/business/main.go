@@ -2,20 +2,43 @@ package main
 
 import (
 	"business/handlers"
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
-	"os"
 
 	"business/database"
+	"business/rollup"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/events"
+	"github.com/yelp-sample-v2/shared/health"
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/metrics"
+	"github.com/yelp-sample-v2/shared/server"
+	"github.com/yelp-sample-v2/shared/tracing"
 )
 
 func main() {
+	// Log JSON to stdout, at LOG_LEVEL and above
+	logger.Start(logger.ConfigFromEnv("business-service"))
+
+	// Trace requests, including their database queries and calls to other services
+	if err := tracing.Start(tracing.ConfigFromEnv("business-service")); err != nil {
+		logger.Fatal("Failed to start tracing", "error", err)
+	}
+
 	database.Connect()
 
-	r := gin.Default()
+	// Start delivering analytics events to the logging service
+	events.Start(events.ConfigFromEnv("business-service"))
+	metrics.RegisterQueue("events", events.Default)
+
+	// Start rolling events up into the activity tables used for trending
+	rollup.Start(database.DB, rollup.ConfigFromEnv())
+
+	r := gin.New()
+	r.Use(tracing.Middleware(), logger.Middleware("X-User-ID"), metrics.Middleware(), logger.Recovery())
+	srv := server.New(server.ConfigFromEnv("8081"), r)
 
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -29,21 +52,45 @@ func main() {
 		})
 	})
 
-	r.GET("/ready", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ready",
-		})
-	})
+	// Ready while the database answers
+	checks := health.New(health.ConfigFromEnv())
+	checks.Critical("postgres", database.Ping)
+	r.GET("/ready", srv.CheckReady, checks.Ready)
+
+	// Prometheus metrics
+	r.GET("/metrics", metrics.Handler())
 
 	// Business routes
 	r.GET("/businesses", handlers.SearchBusinesses)
+	r.GET("/businesses/trending", handlers.GetTrendingBusinesses)
 	r.GET("/businesses/:id", handlers.GetBusiness)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
-	}
+	// Collection (bookmark) routes
+	r.GET("/collections", handlers.GetMyCollections)
+	r.POST("/collections", handlers.CreateCollection)
+	r.GET("/collections/:id", handlers.GetCollection)
+	r.PATCH("/collections/:id", handlers.UpdateCollection)
+	r.DELETE("/collections/:id", handlers.DeleteCollection)
+	r.POST("/collections/:id/items", handlers.AddCollectionItem)
+	r.PUT("/collections/:id/items/order", handlers.ReorderCollectionItems)
+	r.PATCH("/collections/:id/items/:business_id", handlers.UpdateCollectionItem)
+	r.DELETE("/collections/:id/items/:business_id", handlers.RemoveCollectionItem)
+	r.GET("/users/:id/collections", handlers.GetUserCollections)
 
-	fmt.Printf("Business service starting on port %s\n", port)
-	log.Fatal(r.Run(":" + port))
+	// Internal routes for user data export, erasure and ownership lookups (not exposed by the gateway)
+	r.GET("/internal/users/:id/data", handlers.ExportUserData)
+	r.DELETE("/internal/users/:id/data", handlers.EraseUserData)
+	r.GET("/internal/users/:id/businesses", handlers.GetOwnedBusinesses)
+
+	// Once in-flight requests finish, finish the rollup in progress, deliver buffered
+	// events and spans and close the database pool
+	srv.OnShutdown("rollup", rollup.Stop)
+	srv.OnShutdown("events", events.Close)
+	srv.OnShutdown("database", func(context.Context) error { return database.Close() })
+	srv.OnShutdown("tracing", tracing.Close)
+
+	slog.Info("Business service starting", "addr", srv.HTTP.Addr)
+	if err := srv.Run(); err != nil {
+		logger.Fatal("Failed to start server", "error", err)
+	}
 }
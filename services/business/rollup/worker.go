@@ -0,0 +1,314 @@
+package rollup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/yelp-sample-v2/shared/events"
+	"github.com/yelp-sample-v2/shared/models"
+	"gorm.io/gorm"
+)
+
+type Config struct {
+	// LoggingURL is the base URL of the logging service, which owns the event log
+	LoggingURL string
+	// Interval is how often the current buckets are recomputed
+	Interval time.Duration
+	// Backfill is how far back hourly buckets are rebuilt when the worker starts
+	Backfill time.Duration
+	// HourlyRetention is how long hourly buckets are kept; daily buckets never expire
+	HourlyRetention time.Duration
+}
+
+// ConfigFromEnv reads LOGGING_SERVICE_URL and the ROLLUP_* environment variables
+func ConfigFromEnv() Config {
+	cfg := Config{
+		LoggingURL:      os.Getenv("LOGGING_SERVICE_URL"),
+		Interval:        5 * time.Minute,
+		Backfill:        48 * time.Hour,
+		HourlyRetention: 14 * 24 * time.Hour,
+	}
+	if cfg.LoggingURL == "" {
+		cfg.LoggingURL = "http://logging-service:8083"
+	}
+	if d, err := time.ParseDuration(os.Getenv("ROLLUP_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ROLLUP_BACKFILL")); err == nil && d > 0 {
+		cfg.Backfill = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ROLLUP_HOURLY_RETENTION")); err == nil && d > 0 {
+		cfg.HourlyRetention = d
+	}
+	return cfg
+}
+
+// Worker periodically rolls the event log up into hourly and daily activity buckets
+// per business and per category. Every run rebuilds whole buckets, so overlapping runs
+// and restarts never double count. Every replica runs a worker; a bucket is rebuilt by
+// one of them at a time.
+type Worker struct {
+	cfg        Config
+	db         *gorm.DB
+	httpClient *http.Client
+	stop       chan struct{}
+	done       chan struct{}
+
+	// lastHour is the most recent hourly bucket that has been rolled up
+	lastHour time.Time
+}
+
+// Default is the worker started by Start
+var Default *Worker
+
+// Start creates the default worker and starts rolling up in the background
+func Start(db *gorm.DB, cfg Config) {
+	Default = New(db, cfg)
+	go Default.run()
+}
+
+// Stop stops the default worker, waiting for a run in progress to finish
+func Stop(ctx context.Context) error {
+	if Default == nil {
+		return nil
+	}
+	return Default.Stop(ctx)
+}
+
+func New(db *gorm.DB, cfg Config) *Worker {
+	return &Worker{
+		cfg:        cfg,
+		db:         db,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (w *Worker) Stop(ctx context.Context) error {
+	close(w.stop)
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Worker) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.RunOnce(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// RunOnce rolls up every hour since the last run, recomputing the previous hour too
+// so events that arrived late are included.
+func (w *Worker) RunOnce(now time.Time) {
+	currentHour := now.UTC().Truncate(time.Hour)
+
+	from := currentHour.Add(-w.cfg.Backfill)
+	if !w.lastHour.IsZero() {
+		from = w.lastHour.Add(-time.Hour)
+	}
+
+	days := map[time.Time]bool{}
+	for hour := from; !hour.After(currentHour); hour = hour.Add(time.Hour) {
+		if err := w.rollupHour(hour); err != nil {
+			slog.Error("Hourly rollup failed", "hour", hour.Format(time.RFC3339), "error", err)
+			// Try again from this hour on the next run
+			return
+		}
+		days[hour.Truncate(24*time.Hour)] = true
+		w.lastHour = hour
+	}
+
+	for day := range days {
+		if err := w.rollupDay(day); err != nil {
+			slog.Error("Daily rollup failed", "day", day.Format("2006-01-02"), "error", err)
+		}
+	}
+
+	if err := w.prune(now); err != nil {
+		slog.Error("Pruning hourly rollups failed", "error", err)
+	}
+}
+
+// eventColumns maps the rolled-up event types to rollup columns
+var eventColumns = map[string]string{
+	events.TypeBusinessView:  "views",
+	events.TypeReviewCreated: "reviews",
+	events.TypeBookmarkAdded: "bookmarks",
+}
+
+// rollupHour rebuilds the business and category buckets of one hour from the event log
+func (w *Worker) rollupHour(hour time.Time) error {
+	rows := map[uint]*models.BusinessActivityRollup{}
+	for eventType, column := range eventColumns {
+		counts, err := w.countEvents(eventType, hour, hour.Add(time.Hour))
+		if err != nil {
+			return err
+		}
+
+		for businessID, count := range counts {
+			row, ok := rows[businessID]
+			if !ok {
+				row = &models.BusinessActivityRollup{BusinessID: businessID, Granularity: models.RollupHour, BucketStart: hour}
+				rows[businessID] = row
+			}
+			switch column {
+			case "views":
+				row.Views = count
+			case "reviews":
+				row.Reviews = count
+			case "bookmarks":
+				row.Bookmarks = count
+			}
+		}
+	}
+
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if locked, err := lockBucket(tx, models.RollupHour, hour); err != nil || !locked {
+			return err
+		}
+
+		if err := tx.Where("granularity = ? AND bucket_start = ?", models.RollupHour, hour).
+			Delete(&models.BusinessActivityRollup{}).Error; err != nil {
+			return err
+		}
+
+		if len(rows) > 0 {
+			batch := make([]models.BusinessActivityRollup, 0, len(rows))
+			for _, row := range rows {
+				batch = append(batch, *row)
+			}
+			if err := tx.CreateInBatches(batch, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		return rollupCategories(tx, models.RollupHour, hour)
+	})
+}
+
+// rollupDay rebuilds a day's buckets by summing its hourly buckets
+func (w *Worker) rollupDay(day time.Time) error {
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if locked, err := lockBucket(tx, models.RollupDay, day); err != nil || !locked {
+			return err
+		}
+
+		if err := tx.Where("granularity = ? AND bucket_start = ?", models.RollupDay, day).
+			Delete(&models.BusinessActivityRollup{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO business_activity_rollups (business_id, granularity, bucket_start, views, reviews, bookmarks, updated_at)
+			SELECT business_id, ?, ?, SUM(views), SUM(reviews), SUM(bookmarks), NOW()
+			FROM business_activity_rollups
+			WHERE granularity = ? AND bucket_start >= ? AND bucket_start < ?
+			GROUP BY business_id`,
+			models.RollupDay, day, models.RollupHour, day, day.Add(24*time.Hour),
+		).Error; err != nil {
+			return err
+		}
+
+		return rollupCategories(tx, models.RollupDay, day)
+	})
+}
+
+// lockBucket takes a transaction-scoped advisory lock on a bucket. It returns false when
+// another replica holds it: that replica is rebuilding the bucket from the same events,
+// and two delete-and-insert transactions on one bucket would collide on its primary key.
+func lockBucket(tx *gorm.DB, granularity string, bucketStart time.Time) (bool, error) {
+	var locked bool
+	err := tx.Raw(`SELECT pg_try_advisory_xact_lock(hashtext(?))`,
+		"rollup:"+granularity+":"+bucketStart.UTC().Format(time.RFC3339),
+	).Scan(&locked).Error
+	if err == nil && !locked {
+		slog.Debug("Bucket is being rolled up by another replica", "granularity", granularity, "bucket_start", bucketStart.Format(time.RFC3339))
+	}
+	return locked, err
+}
+
+// rollupCategories rebuilds the category buckets of one bucket from the business buckets
+func rollupCategories(tx *gorm.DB, granularity string, bucketStart time.Time) error {
+	if err := tx.Where("granularity = ? AND bucket_start = ?", granularity, bucketStart).
+		Delete(&models.CategoryActivityRollup{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Exec(`
+		INSERT INTO category_activity_rollups (category, granularity, bucket_start, views, reviews, bookmarks, updated_at)
+		SELECT b.category, r.granularity, r.bucket_start, SUM(r.views), SUM(r.reviews), SUM(r.bookmarks), NOW()
+		FROM business_activity_rollups r
+		JOIN businesses b ON b.id = r.business_id AND b.deleted_at IS NULL
+		WHERE r.granularity = ? AND r.bucket_start = ?
+		GROUP BY b.category, r.granularity, r.bucket_start`,
+		granularity, bucketStart,
+	).Error
+}
+
+// prune deletes hourly buckets past their retention
+func (w *Worker) prune(now time.Time) error {
+	cutoff := now.UTC().Add(-w.cfg.HourlyRetention)
+	if err := w.db.Where("granularity = ? AND bucket_start < ?", models.RollupHour, cutoff).
+		Delete(&models.BusinessActivityRollup{}).Error; err != nil {
+		return err
+	}
+	return w.db.Where("granularity = ? AND bucket_start < ?", models.RollupHour, cutoff).
+		Delete(&models.CategoryActivityRollup{}).Error
+}
+
+type eventCountsResponse struct {
+	Counts []struct {
+		BusinessID uint  `json:"business_id"`
+		Count      int64 `json:"count"`
+	} `json:"counts"`
+}
+
+// countEvents asks the logging service for per-business counts of an event type in [from, to)
+func (w *Worker) countEvents(eventType string, from, to time.Time) (map[uint]int64, error) {
+	query := url.Values{}
+	query.Set("type", eventType)
+	query.Set("from", from.Format(time.RFC3339))
+	query.Set("to", to.Format(time.RFC3339))
+
+	resp, err := w.httpClient.Get(w.cfg.LoggingURL + "/internal/events/counts?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("logging service returned status %d", resp.StatusCode)
+	}
+
+	var result eventCountsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(result.Counts))
+	for _, count := range result.Counts {
+		counts[count.BusinessID] = count.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,251 @@
+// Package cache keeps upstream responses in memory so the gateway can answer repeated
+// public reads itself.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	ETag   string
+	// Tags name the data the response was built from; purging a tag drops the entry
+	Tags []string
+
+	stored time.Time
+	ttl    time.Duration
+	stale  time.Duration
+}
+
+// NewEntry creates an entry, giving it an ETag from its body when the upstream didn't
+func NewEntry(status int, header http.Header, body []byte) *Entry {
+	e := &Entry{Status: status, Header: header, Body: body, ETag: header.Get("ETag"), stored: time.Now()}
+	if e.ETag == "" {
+		sum := sha256.Sum256(body)
+		e.ETag = `"` + hex.EncodeToString(sum[:12]) + `"`
+	}
+	return e
+}
+
+// Age is how long ago the response was received
+func (e *Entry) Age(now time.Time) time.Duration {
+	return now.Sub(e.stored)
+}
+
+func (e *Entry) size() int64 {
+	size := int64(len(e.Body))
+	for k, values := range e.Header {
+		for _, v := range values {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size + 256
+}
+
+// Matches reports whether an If-None-Match header names the entry
+func (e *Entry) Matches(ifNoneMatch string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == e.ETag {
+			return true
+		}
+	}
+	return false
+}
+
+// State is how fresh an entry is
+type State int
+
+const (
+	// Miss means there is no usable entry
+	Miss State = iota
+	// Fresh entries are served as they are
+	Fresh
+	// Stale entries are served while a new response is fetched in the background
+	Stale
+)
+
+// Cache is a least recently used cache bounded by the size of its entries
+type Cache struct {
+	maxBytes int64
+
+	mu       sync.Mutex
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+	tags     map[string]map[string]bool
+	inflight map[string]*call
+	// generation counts purges
+	generation uint64
+}
+
+type item struct {
+	key   string
+	entry *Entry
+}
+
+// call is a fetch that concurrent requests for the same key wait on
+type call struct {
+	done  chan struct{}
+	entry *Entry
+}
+
+func New(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		tags:     map[string]map[string]bool{},
+		inflight: map[string]*call{},
+	}
+}
+
+// Get returns the entry for key and how fresh it is
+func (c *Cache) Get(key string) (*Entry, State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, Miss
+	}
+	e := el.Value.(*item).entry
+	age := e.Age(time.Now())
+	switch {
+	case age < e.ttl:
+		c.lru.MoveToFront(el)
+		return e, Fresh
+	case age < e.ttl+e.stale:
+		c.lru.MoveToFront(el)
+		return e, Stale
+	}
+	c.remove(el)
+	return nil, Miss
+}
+
+// Generation changes whenever entries are purged
+func (c *Cache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// Set stores an entry that is fresh for ttl and may be served stale for another stale.
+// generation is Generation from before the response was requested: if anything was
+// purged since, the response may predate the change and is not stored. Entries larger
+// than an eighth of the cache are not stored either.
+func (c *Cache) Set(key string, e *Entry, ttl, stale time.Duration, generation uint64) {
+	e.ttl, e.stale = ttl, stale
+	size := e.size()
+	if size > c.maxBytes/8 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&item{key: key, entry: e})
+	c.size += size
+	for _, tag := range e.Tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = map[string]bool{}
+		}
+		c.tags[tag][key] = true
+	}
+
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Purge drops every entry tagged with any of tags and returns how many were dropped
+func (c *Cache) Purge(tags ...string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	purged := 0
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if el, ok := c.entries[key]; ok {
+				c.remove(el)
+				purged++
+			}
+		}
+	}
+	return purged
+}
+
+func (c *Cache) remove(el *list.Element) {
+	it := c.lru.Remove(el).(*item)
+	delete(c.entries, it.key)
+	c.size -= it.entry.size()
+	for _, tag := range it.entry.Tags {
+		delete(c.tags[tag], it.key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+// Do runs fetch once for concurrent callers with the same key and gives them all its
+// entry. leader reports whether this caller ran fetch.
+func (c *Cache) Do(key string, fetch func() *Entry) (e *Entry, leader bool) {
+	c.mu.Lock()
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-cl.done
+		return cl.entry, false
+	}
+	cl := &call{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+	cl.entry = fetch()
+	return cl.entry, true
+}
+
+// Refresh runs fetch in the background unless one is already running for key, and
+// reports whether it started one
+func (c *Cache) Refresh(key string, fetch func() *Entry) bool {
+	c.mu.Lock()
+	if _, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		return false
+	}
+	cl := &call{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.inflight, key)
+			c.mu.Unlock()
+			close(cl.done)
+		}()
+		cl.entry = fetch()
+	}()
+	return true
+}
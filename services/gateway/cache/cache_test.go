@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newEntry(body string, tags ...string) *Entry {
+	e := NewEntry(http.StatusOK, http.Header{}, []byte(body))
+	e.Tags = tags
+	return e
+}
+
+func TestGetFreshness(t *testing.T) {
+	c := New(1 << 20)
+	e := newEntry("cafe")
+	c.Set("/businesses/1?", e, time.Minute, time.Minute, c.Generation())
+
+	tests := []struct {
+		age  time.Duration
+		want State
+	}{
+		{0, Fresh},
+		{90 * time.Second, Stale},
+		{3 * time.Minute, Miss},
+	}
+	for _, tt := range tests {
+		e.stored = time.Now().Add(-tt.age)
+		if _, got := c.Get("/businesses/1?"); got != tt.want {
+			t.Errorf("Get of an entry %v old = %v, want %v", tt.age, got, tt.want)
+		}
+	}
+	// An expired entry is dropped
+	e.stored = time.Now()
+	if _, got := c.Get("/businesses/1?"); got != Miss {
+		t.Errorf("Get after expiry = %v, want Miss", got)
+	}
+}
+
+func TestPurgeDropsTaggedEntries(t *testing.T) {
+	c := New(1 << 20)
+	generation := c.Generation()
+	c.Set("/businesses/1?", newEntry("cafe", "business:1"), time.Minute, 0, generation)
+	c.Set("/businesses/1/reviews?", newEntry("reviews", "business:1", "reviews"), time.Minute, 0, generation)
+	c.Set("/businesses/2?", newEntry("bar", "business:2"), time.Minute, 0, generation)
+
+	if got := c.Purge("business:1", "unknown"); got != 2 {
+		t.Errorf("Purge dropped %d entries, want 2", got)
+	}
+	for key, want := range map[string]State{
+		"/businesses/1?":         Miss,
+		"/businesses/1/reviews?": Miss,
+		"/businesses/2?":         Fresh,
+	} {
+		if _, got := c.Get(key); got != want {
+			t.Errorf("Get(%q) after purge = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestSetSkipsResponsesFromBeforePurge(t *testing.T) {
+	c := New(1 << 20)
+
+	// A fetch starts, the business changes while it is in flight, then it returns
+	generation := c.Generation()
+	c.Purge("business:1")
+	if c.Generation() == generation {
+		t.Fatal("Purge didn't change the generation")
+	}
+	c.Set("/businesses/1?", newEntry("old cafe", "business:1"), time.Minute, 0, generation)
+	if _, state := c.Get("/businesses/1?"); state != Miss {
+		t.Errorf("response fetched before a purge was stored")
+	}
+
+	c.Set("/businesses/1?", newEntry("new cafe", "business:1"), time.Minute, 0, c.Generation())
+	if e, state := c.Get("/businesses/1?"); state != Fresh || string(e.Body) != "new cafe" {
+		t.Errorf("Get = %v, want the response fetched after the purge", state)
+	}
+}
+
+func TestSetEvictsLeastRecentlyUsed(t *testing.T) {
+	// Room for eight entries with a 100 byte body
+	body := string(make([]byte, 100))
+	c := New(8*newEntry(body).size() + 100)
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, key := range keys {
+		c.Set(key, newEntry(body), time.Minute, 0, c.Generation())
+	}
+	c.Get("a")
+	c.Set("i", newEntry(body), time.Minute, 0, c.Generation())
+
+	for _, key := range append(keys, "i") {
+		want := Fresh
+		if key == "b" {
+			want = Miss
+		}
+		if _, got := c.Get(key); got != want {
+			t.Errorf("Get(%q) = %v, want %v", key, got, want)
+		}
+	}
+
+	// Entries bigger than an eighth of the cache are never stored
+	c.Set("j", newEntry(string(make([]byte, 200))), time.Minute, 0, c.Generation())
+	if _, got := c.Get("j"); got != Miss {
+		t.Errorf("oversized entry was stored")
+	}
+}
+
+func TestDoSharesOneFetch(t *testing.T) {
+	c := New(1 << 20)
+	release := make(chan struct{})
+	var fetches, leaders atomic.Int32
+	fetch := func() *Entry {
+		fetches.Add(1)
+		<-release
+		return newEntry("cafe")
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	entries := make([]*Entry, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e, leader := c.Do("/businesses/1?", fetch)
+			if leader {
+				leaders.Add(1)
+			}
+			entries[i] = e
+		}(i)
+	}
+	// Let every caller reach Do before the fetch finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if fetches.Load() != 1 || leaders.Load() != 1 {
+		t.Errorf("%d fetches with %d leaders, want 1 of each", fetches.Load(), leaders.Load())
+	}
+	for i, e := range entries {
+		if e != entries[0] {
+			t.Errorf("caller %d got a different entry", i)
+		}
+	}
+
+	// Once it is done, the next miss fetches again
+	if _, leader := c.Do("/businesses/1?", func() *Entry { return newEntry("cafe") }); !leader {
+		t.Error("Do after the fetch finished waited on it")
+	}
+}
+
+func TestRefreshRunsOnceInBackground(t *testing.T) {
+	c := New(1 << 20)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	fetch := func() *Entry {
+		fetches.Add(1)
+		<-release
+		return newEntry("fresh cafe")
+	}
+
+	if !c.Refresh("/businesses/1?", fetch) {
+		t.Fatal("Refresh didn't start a fetch")
+	}
+	if c.Refresh("/businesses/1?", fetch) {
+		t.Error("Refresh started a second fetch while one was running")
+	}
+
+	// A miss while refreshing waits for the refresh instead of fetching too
+	done := make(chan *Entry)
+	go func() {
+		e, leader := c.Do("/businesses/1?", fetch)
+		if leader {
+			t.Error("Do fetched while a refresh was running")
+		}
+		done <- e
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if e := <-done; e == nil || string(e.Body) != "fresh cafe" {
+		t.Errorf("Do during a refresh returned %v, want the refreshed entry", e)
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("%d fetches, want 1", fetches.Load())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !c.Refresh("/businesses/1?", func() *Entry { return newEntry("cafe") }) {
+		if time.Now().After(deadline) {
+			t.Fatal("Refresh never ran again after the first one finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -1,99 +1,107 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"gateway/cache"
+	"gateway/middleware"
+	"gateway/ratelimit"
+	"gateway/routes"
+	"gateway/upstream"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/yelp-sample-v2/shared/events"
+	"github.com/yelp-sample-v2/shared/health"
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/metrics"
+	"github.com/yelp-sample-v2/shared/server"
+	"github.com/yelp-sample-v2/shared/tracing"
 )
 
-type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	jwt.RegisteredClaims
-}
-
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-super-secret-jwt-key"
+// emitSearchPerformed records a business search. Plain listings without a query or filters are not searches.
+func emitSearchPerformed(c *gin.Context) {
+	payload := events.SearchPerformed{
+		Query:   c.Query("name"),
+		Filters: map[string]string{},
+		Page:    1,
+		Limit:   10,
 	}
-	return secret
-}
-
-func authMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
-			return
-		}
-
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
-			c.Abort()
-			return
+	for _, key := range []string{"category", "location"} {
+		if value := c.Query(key); value != "" {
+			payload.Filters[key] = value
 		}
+	}
+	if payload.Query == "" && len(payload.Filters) == 0 {
+		return
+	}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		payload.Page = page
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		payload.Limit = limit
+	}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims := &Claims{}
+	var userID int
+	if id, ok := c.Get("user_id"); ok {
+		userID = int(id.(uint))
+	}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(getJWTSecret()), nil
-		})
+	event, err := events.New(events.TypeSearchPerformed, userID, 0, payload)
+	if err != nil {
+		return
+	}
+	event.IPAddress = c.ClientIP()
+	event.UserAgent = c.GetHeader("User-Agent")
+	events.Emit(event)
+}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
+// emitBusinessView records a business view answered from the cache, which the business
+// service records itself for the views it serves. Only anonymous views are cached.
+func emitBusinessView(c *gin.Context) {
+	businessID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return
+	}
+	event, err := events.New(events.TypeBusinessView, 0, businessID, events.BusinessView{
+		Referrer: c.GetHeader("Referer"),
+	})
+	if err != nil {
+		return
+	}
+	event.IPAddress = c.ClientIP()
+	event.UserAgent = c.GetHeader("User-Agent")
+	events.Emit(event)
+}
 
-		// Store user info in context and add headers for downstream services
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
-		c.Request.Header.Set("X-User-ID", strconv.FormatUint(uint64(claims.UserID), 10))
-		c.Request.Header.Set("X-User-Email", claims.Email)
-		c.Next()
+// cacheSize reads CACHE_MAX_BYTES, the memory the response cache may use (default 64MB)
+func cacheSize() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("CACHE_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		return n
 	}
+	return 64 << 20
 }
 
-func optionalAuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			claims := &Claims{}
-
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-				return []byte(getJWTSecret()), nil
-			})
-
-			if err == nil && token.Valid {
-				// Store user info in context and add headers for downstream services
-				c.Set("user_id", claims.UserID)
-				c.Set("user_email", claims.Email)
-				c.Request.Header.Set("X-User-ID", strconv.FormatUint(uint64(claims.UserID), 10))
-				c.Request.Header.Set("X-User-Email", claims.Email)
-				fmt.Printf("Gateway: Set X-User-ID header to %d\n", claims.UserID)
-			}
+// trustedProxies reads TRUSTED_PROXIES, a comma-separated list of IPs or CIDRs
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
 		}
-		// Continue regardless of token validity (optional auth)
-		c.Next()
 	}
+	return proxies
 }
 
-func main() {
-	r := gin.Default()
-
-	// Public routes
+// registerBaseRoutes adds the gateway's own endpoints to every router
+func registerBaseRoutes(r *gin.Engine, srv *server.Server, checks *health.Checker) {
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "API Gateway is running!",
@@ -106,111 +114,122 @@ func main() {
 		})
 	})
 
-	r.GET("/ready", func(c *gin.Context) {
+	r.GET("/ready", srv.CheckReady, checks.Ready)
+
+	// Prometheus metrics
+	r.GET("/metrics", metrics.Handler())
+}
+
+// registerAdminRoutes adds the gateway's own admin endpoints
+func registerAdminRoutes(r *gin.Engine, upstreams *upstream.Pool) {
+	admin := r.Group("/admin", middleware.Auth(), middleware.RequireRoles("admin"))
+
+	// Circuit breaker state and request counts per upstream
+	admin.GET("/upstreams", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
-			"status": "ready",
+			"upstreams": upstreams.Status(),
 		})
 	})
+}
 
-	// Auth service routes (public)
-	authServiceURL := os.Getenv("AUTH_SERVICE_URL")
-	if authServiceURL == "" {
-		authServiceURL = "http://auth-service:8084"
-	}
-	authURL, _ := url.Parse(authServiceURL)
-	authProxy := httputil.NewSingleHostReverseProxy(authURL)
+func main() {
+	// Log JSON to stdout, at LOG_LEVEL and above
+	logger.Start(logger.ConfigFromEnv("gateway"))
 
-	authGroup := r.Group("/auth")
-	{
-		authGroup.POST("/register", func(c *gin.Context) {
-			authProxy.ServeHTTP(c.Writer, c.Request)
-		})
-		authGroup.POST("/login", func(c *gin.Context) {
-			authProxy.ServeHTTP(c.Writer, c.Request)
-		})
-		authGroup.POST("/logout", func(c *gin.Context) {
-			authProxy.ServeHTTP(c.Writer, c.Request)
-		})
-		authGroup.GET("/me", authMiddleware(), func(c *gin.Context) {
-			authProxy.ServeHTTP(c.Writer, c.Request)
-		})
+	// Trace requests through the gateway and the services behind it
+	if err := tracing.Start(tracing.ConfigFromEnv("gateway")); err != nil {
+		logger.Fatal("Failed to start tracing", "error", err)
 	}
 
-	// Business service routes
-	businessServiceURL := os.Getenv("BUSINESS_SERVICE_URL")
-	if businessServiceURL == "" {
-		businessServiceURL = "http://business-service:8081"
+	// Start delivering analytics events to the logging service
+	events.Start(events.ConfigFromEnv("gateway"))
+
+	routesPath := os.Getenv("ROUTES_CONFIG")
+	if routesPath == "" {
+		routesPath = "routes.yaml"
 	}
-	businessURL, _ := url.Parse(businessServiceURL)
-	businessProxy := httputil.NewSingleHostReverseProxy(businessURL)
 
-	// Public business routes
-	r.GET("/businesses", func(c *gin.Context) {
-		businessProxy.ServeHTTP(c.Writer, c.Request)
-	})
+	// The router is set once the route table is loaded; its /ready uses the server
+	srv := server.New(server.ConfigFromEnv("8080"), nil)
 
-	r.GET("/businesses/:id", func(c *gin.Context) {
-		businessProxy.ServeHTTP(c.Writer, c.Request)
-	})
+	streams, endStreams := context.WithCancel(context.Background())
+	defer endStreams()
 
-	// Review service routes
-	reviewServiceURL := os.Getenv("REVIEW_SERVICE_URL")
-	if reviewServiceURL == "" {
-		reviewServiceURL = "http://review-service:8082"
-	}
-	reviewURL, _ := url.Parse(reviewServiceURL)
-	reviewProxy := httputil.NewSingleHostReverseProxy(reviewURL)
-
-	// Review routes (public but with optional auth for logging)
-	r.GET("/businesses/:id/reviews", optionalAuthMiddleware(), func(c *gin.Context) {
-		// Debug: check if user info is in context
-		if userID, exists := c.Get("user_id"); exists {
-			fmt.Printf("Gateway: Found user_id in context: %v\n", userID)
-		} else {
-			fmt.Printf("Gateway: No user_id in context\n")
-		}
-		reviewProxy.ServeHTTP(c.Writer, c.Request)
-	})
+	upstreams := upstream.NewPool()
 
-	// Protected review routes
-	r.POST("/businesses/:id/reviews", authMiddleware(), func(c *gin.Context) {
-		reviewProxy.ServeHTTP(c.Writer, c.Request)
-	})
-
-	r.GET("/reviews", authMiddleware(), func(c *gin.Context) {
-		reviewProxy.ServeHTTP(c.Writer, c.Request)
-	})
-
-	r.GET("/reviews/:id", authMiddleware(), func(c *gin.Context) {
-		reviewProxy.ServeHTTP(c.Writer, c.Request)
+	loggingURL := os.Getenv("LOGGING_SERVICE_URL")
+	if loggingURL == "" {
+		loggingURL = "http://logging-service:8083"
+	}
+	reviewViews := newReviewViewLog(loggingURL)
+
+	// Report the depth and drops of every queue logs are delivered through
+	metrics.RegisterQueue("events", events.Default)
+	metrics.RegisterQueue("review_views", reviewViews)
+
+	// Report whether each upstream is reachable. The gateway stays ready without them:
+	// it still answers with 502s and cached responses, and restarts wouldn't help.
+	checks := health.New(health.ConfigFromEnv())
+	checks.OptionalEach("upstream", upstreams.Reachable)
+
+	table, err := routes.NewTable(routesPath, &routes.Builder{
+		Base: func(r *gin.Engine) {
+			registerBaseRoutes(r, srv, checks)
+			registerAdminRoutes(r, upstreams)
+		},
+		Hooks: map[string]gin.HandlerFunc{
+			"search_performed": emitSearchPerformed,
+			"business_view":    emitBusinessView,
+			"review_views":     reviewViews.hook,
+		},
+		TrustedProxies: trustedProxies(),
+		Limiter:        ratelimit.FromEnv(),
+		Upstreams:      upstreams,
+		Cache:          cache.New(cacheSize()),
+		Streams:        streams,
 	})
+	if err != nil {
+		logger.Fatal("Failed to load routes", "error", err)
+	}
 
-	// Logging service routes
-	loggingServiceURL := os.Getenv("LOGGING_SERVICE_URL")
-	if loggingServiceURL == "" {
-		loggingServiceURL = "http://logging-service:8083"
+	// Reload the route table when the file changes (0 disables watching)
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	watchInterval := 5 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("ROUTES_WATCH_INTERVAL")); err == nil {
+		watchInterval = d
+	}
+	if watchInterval > 0 {
+		go table.Watch(watchCtx, watchInterval)
 	}
-	loggingURL, _ := url.Parse(loggingServiceURL)
-	loggingProxy := httputil.NewSingleHostReverseProxy(loggingURL)
 
-	// Protected logging routes
-	r.POST("/logs/review-view", authMiddleware(), func(c *gin.Context) {
-		loggingProxy.ServeHTTP(c.Writer, c.Request)
-	})
+	// Reload the route table on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := table.Reload(); err != nil {
+				slog.Error("Keeping current routes, reload failed", "error", err)
+			}
+		}
+	}()
 
-	r.GET("/logs/user/:user_id/history", authMiddleware(), func(c *gin.Context) {
-		loggingProxy.ServeHTTP(c.Writer, c.Request)
-	})
+	srv.HTTP.Handler = table
+	// Streams never finish on their own; end them so Shutdown can wait for the rest
+	srv.HTTP.RegisterOnShutdown(endStreams)
 
-	r.GET("/logs/business/:business_id/stats", authMiddleware(), func(c *gin.Context) {
-		loggingProxy.ServeHTTP(c.Writer, c.Request)
+	// Once in-flight requests finish, stop health checks and deliver buffered review
+	// views, events and spans
+	srv.OnShutdown("upstreams", func(context.Context) error {
+		upstreams.Close()
+		return nil
 	})
+	srv.OnShutdown("review views", reviewViews.Close)
+	srv.OnShutdown("events", events.Close)
+	srv.OnShutdown("tracing", tracing.Close)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	slog.Info("API Gateway starting", "addr", srv.HTTP.Addr)
+	if err := srv.Run(); err != nil {
+		logger.Fatal("Failed to start server", "error", err)
 	}
-
-	fmt.Printf("API Gateway starting on port %s\n", port)
-	log.Fatal(r.Run(":" + port))
 }
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/yelp-sample-v2/shared/logger"
+)
+
+// authFailures counts requests rejected for missing or invalid credentials or roles
+var authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_auth_failures_total",
+	Help: "Requests the gateway rejected before proxying them, by route template and reason.",
+}, []string{"method", "route", "reason"})
+
+// reject answers with an error and records why the request was turned away
+func reject(c *gin.Context, status int, reason, message string) {
+	authFailures.WithLabelValues(c.Request.Method, c.FullPath(), reason).Inc()
+	c.JSON(status, gin.H{"error": message})
+	c.Abort()
+}
+
+type Claims struct {
+	UserID uint   `json:"user_id"`
+	Email  string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+func getJWTSecret() string {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = "your-super-secret-jwt-key"
+	}
+	return secret
+}
+
+// parseToken returns the claims of a valid bearer token in the Authorization header
+func parseToken(c *gin.Context) (*Claims, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, false
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(getJWTSecret()), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	return claims, true
+}
+
+// setUser stores user info in the context and adds headers for downstream services
+func setUser(c *gin.Context, claims *Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("user_email", claims.Email)
+	c.Request.Header.Set("X-User-ID", strconv.FormatUint(uint64(claims.UserID), 10))
+	c.Request.Header.Set("X-User-Email", claims.Email)
+	logger.With(c, "user_id", claims.UserID)
+}
+
+// Anonymous drops identity headers sent by the client; only the gateway may set them
+func Anonymous() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Header.Del("X-User-ID")
+		c.Request.Header.Del("X-User-Email")
+		c.Next()
+	}
+}
+
+// Auth rejects requests without a valid token
+func Auth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Header.Del("X-User-ID")
+		c.Request.Header.Del("X-User-Email")
+
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			reject(c, http.StatusUnauthorized, "missing_token", "Authorization header required")
+			return
+		}
+
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			reject(c, http.StatusUnauthorized, "invalid_format", "Invalid authorization format")
+			return
+		}
+
+		claims, ok := parseToken(c)
+		if !ok {
+			reject(c, http.StatusUnauthorized, "invalid_token", "Invalid token")
+			return
+		}
+
+		setUser(c, claims)
+		c.Next()
+	}
+}
+
+// OptionalAuth identifies the caller when a valid token is sent
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Header.Del("X-User-ID")
+		c.Request.Header.Del("X-User-Email")
+
+		if claims, ok := parseToken(c); ok {
+			setUser(c, claims)
+		}
+		// Continue regardless of token validity (optional auth)
+		c.Next()
+	}
+}
+
+// roles maps each role a route may require to how it is checked
+var roles = map[string]func(userID uint) bool{
+	"admin": isAdmin,
+}
+
+// KnownRole reports whether routes may require the role
+func KnownRole(role string) bool {
+	_, ok := roles[role]
+	return ok
+}
+
+// isAdmin reports whether the user is listed in ADMIN_USER_IDS (comma-separated)
+func isAdmin(userID uint) bool {
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if adminID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64); err == nil && uint(adminID) == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRoles rejects callers missing any of the roles. It must run after Auth.
+func RequireRoles(required ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		id, ok := userID.(uint)
+		for _, role := range required {
+			if !ok || !roles[role](id) {
+				reject(c, http.StatusForbidden, "missing_role", "Role "+role+" required")
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/logger"
+)
+
+// What requests are counted against
+const (
+	// KeyUser limits each signed-in user; anonymous callers are limited by IP
+	KeyUser = "user"
+	// KeyIP limits each client IP
+	KeyIP = "ip"
+	// KeyAPIKey limits each API key in X-API-Key; requests without a known key are limited by IP
+	KeyAPIKey = "api_key"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Requests per Per
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rate is the refill rate in tokens per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until a token is available; zero when allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps the buckets. MemoryStore serves a single gateway; a shared store such as
+// RedisStore makes every replica draw from the same buckets.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// take refills a bucket holding tokens since elapsed and takes one token from it
+func take(tokens float64, elapsed time.Duration, limit Limit) (float64, Result) {
+	capacity, rate := limit.capacity(), limit.rate()
+	tokens = math.Min(capacity, tokens+elapsed.Seconds()*rate)
+
+	var result Result
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	result.Remaining = int(tokens)
+	result.Reset = seconds((capacity - tokens) / rate)
+	return tokens, result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Limiter applies per-route limits with a shared store
+type Limiter struct {
+	store   Store
+	apiKeys map[string]bool
+}
+
+// New creates a limiter. Only the listed API keys get their own buckets, so callers
+// can't dodge a limit by sending a new key with every request.
+func New(store Store, apiKeys []string) *Limiter {
+	l := &Limiter{store: store, apiKeys: map[string]bool{}}
+	for _, key := range apiKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			l.apiKeys[key] = true
+		}
+	}
+	return l
+}
+
+// FromEnv creates a limiter from RATE_LIMIT_STORE (memory or redis), RATE_LIMIT_REDIS_ADDR,
+// RATE_LIMIT_REDIS_PASSWORD and API_KEYS (comma-separated)
+func FromEnv() *Limiter {
+	var store Store
+	switch os.Getenv("RATE_LIMIT_STORE") {
+	case "redis":
+		addr := os.Getenv("RATE_LIMIT_REDIS_ADDR")
+		if addr == "" {
+			addr = "redis:6379"
+		}
+		store = NewRedisStore(addr, os.Getenv("RATE_LIMIT_REDIS_PASSWORD"))
+	case "", "memory":
+		store = NewMemoryStore()
+	default:
+		slog.Warn("Unknown RATE_LIMIT_STORE, limiting in memory", "rate_limit_store", os.Getenv("RATE_LIMIT_STORE"))
+		store = NewMemoryStore()
+	}
+	return New(store, strings.Split(os.Getenv("API_KEYS"), ","))
+}
+
+// Handler limits requests to a route. For KeyUser it must run after the auth middleware.
+func (l *Limiter) Handler(route string, key string, limit Limit) gin.HandlerFunc {
+	policy := fmt.Sprintf("%d;w=%d;burst=%d", limit.Requests, int(math.Ceil(limit.Per.Seconds())), int(limit.capacity()))
+
+	return func(c *gin.Context) {
+		bucket := "ratelimit:" + route + ":" + l.subject(c, key)
+
+		result, err := l.store.Take(c.Request.Context(), bucket, limit)
+		if err != nil {
+			// Fail open: an unavailable store must not take the API down with it
+			logger.From(c.Request.Context()).Error("Rate limit store unavailable", "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(int(limit.capacity())))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// subject identifies who a request is counted against
+func (l *Limiter) subject(c *gin.Context, key string) string {
+	switch key {
+	case KeyUser:
+		if userID, ok := c.Get("user_id"); ok {
+			return fmt.Sprintf("user:%v", userID)
+		}
+	case KeyAPIKey:
+		if apiKey := c.GetHeader("X-API-Key"); l.apiKeys[apiKey] {
+			// Keys are hashed so they never reach the store
+			sum := sha256.Sum256([]byte(apiKey))
+			return "key:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
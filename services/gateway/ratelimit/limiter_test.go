@@ -0,0 +1,166 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTake(t *testing.T) {
+	// One token a second, ten at once
+	limit := Limit{Requests: 60, Per: time.Minute, Burst: 10}
+
+	tests := []struct {
+		name       string
+		limit      Limit
+		tokens     float64
+		elapsed    time.Duration
+		wantTokens float64
+		want       Result
+	}{
+		{"full bucket", limit, 10, 0, 9, Result{Allowed: true, Remaining: 9, Reset: time.Second}},
+		{"refill is capped", limit, 2, time.Hour, 9, Result{Allowed: true, Remaining: 9, Reset: time.Second}},
+		{"partial refill", limit, 0, 2500 * time.Millisecond, 1.5, Result{Allowed: true, Remaining: 1, Reset: 8500 * time.Millisecond}},
+		{"empty bucket", limit, 0, 0, 0, Result{RetryAfter: time.Second, Reset: 10 * time.Second}},
+		{"half a token", limit, 0, 500 * time.Millisecond, 0.5, Result{RetryAfter: 500 * time.Millisecond, Reset: 9500 * time.Millisecond}},
+		{"burst defaults to requests", Limit{Requests: 5, Per: 10 * time.Second}, 5, 0, 4, Result{Allowed: true, Remaining: 4, Reset: 2 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, got := take(tt.tokens, tt.elapsed, tt.limit)
+			if tokens != tt.wantTokens || got != tt.want {
+				t.Errorf("take(%v, %v) = %v, %+v; want %v, %+v", tt.tokens, tt.elapsed, tokens, got, tt.wantTokens, tt.want)
+			}
+		})
+	}
+}
+
+// recordingStore remembers the buckets taken from, failing when err is set
+type recordingStore struct {
+	*MemoryStore
+	keys []string
+	err  error
+}
+
+func (s *recordingStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.keys = append(s.keys, key)
+	if s.err != nil {
+		return Result{}, s.err
+	}
+	return s.MemoryStore.Take(ctx, key, limit)
+}
+
+// newTestRouter serves GET /r behind a limit keyed by key. X-User-ID stands in for the
+// auth middleware.
+func newTestRouter(store Store, key string, limit Limit, apiKeys ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/r", func(c *gin.Context) {
+		if userID := c.GetHeader("X-User-ID"); userID != "" {
+			c.Set("user_id", userID)
+		}
+	}, New(store, apiKeys).Handler("GET /r", key, limit), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func request(r *gin.Engine, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/r", nil)
+	req.RemoteAddr = remoteAddr
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandlerHeaders(t *testing.T) {
+	r := newTestRouter(NewMemoryStore(), KeyIP, Limit{Requests: 60, Per: time.Minute, Burst: 2})
+
+	tests := []struct {
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{http.StatusOK, "1", "1", ""},
+		{http.StatusOK, "0", "2", ""},
+		{http.StatusTooManyRequests, "0", "2", "1"},
+	}
+	for i, tt := range tests {
+		w := request(r, "192.0.2.1:1234", nil)
+		if w.Code != tt.status {
+			t.Fatalf("request %d answered %d, want %d", i+1, w.Code, tt.status)
+		}
+		for name, want := range map[string]string{
+			"RateLimit-Policy":    "60;w=60;burst=2",
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": tt.remaining,
+			"RateLimit-Reset":     tt.reset,
+			"Retry-After":         tt.retryAfter,
+		} {
+			if got := w.Header().Get(name); got != want {
+				t.Errorf("request %d: %s = %q, want %q", i+1, name, got, want)
+			}
+		}
+	}
+
+	// Another client has its own bucket
+	if w := request(r, "192.0.2.2:1234", nil); w.Code != http.StatusOK {
+		t.Errorf("request from another IP answered %d, want 200", w.Code)
+	}
+}
+
+func TestHandlerSubjects(t *testing.T) {
+	const apiKey = "partner-key"
+	tests := []struct {
+		name   string
+		key    string
+		header http.Header
+		want   string
+	}{
+		{"ip", KeyIP, http.Header{"X-User-Id": {"7"}}, "ratelimit:GET /r:ip:192.0.2.1"},
+		{"user", KeyUser, http.Header{"X-User-Id": {"7"}}, "ratelimit:GET /r:user:7"},
+		{"anonymous user", KeyUser, nil, "ratelimit:GET /r:ip:192.0.2.1"},
+		{"unknown api key", KeyAPIKey, http.Header{"X-Api-Key": {"made-up"}}, "ratelimit:GET /r:ip:192.0.2.1"},
+		{"no api key", KeyAPIKey, nil, "ratelimit:GET /r:ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &recordingStore{MemoryStore: NewMemoryStore()}
+			request(newTestRouter(store, tt.key, Limit{Requests: 10, Per: time.Minute}, apiKey), "192.0.2.1:1234", tt.header)
+			if len(store.keys) != 1 || store.keys[0] != tt.want {
+				t.Errorf("took from %q, want %q", store.keys, tt.want)
+			}
+		})
+	}
+
+	// A known API key gets its own bucket without the key reaching the store
+	store := &recordingStore{MemoryStore: NewMemoryStore()}
+	request(newTestRouter(store, KeyAPIKey, Limit{Requests: 10, Per: time.Minute}, apiKey), "192.0.2.1:1234", http.Header{"X-Api-Key": {apiKey}})
+	if len(store.keys) != 1 || !strings.HasPrefix(store.keys[0], "ratelimit:GET /r:key:") || strings.Contains(store.keys[0], apiKey) {
+		t.Errorf("took from %q, want a bucket named after the hashed key", store.keys)
+	}
+}
+
+func TestHandlerFailsOpen(t *testing.T) {
+	store := &recordingStore{MemoryStore: NewMemoryStore(), err: errors.New("connection refused")}
+	r := newTestRouter(store, KeyIP, Limit{Requests: 1, Per: time.Minute})
+	for i := 0; i < 3; i++ {
+		w := request(r, "192.0.2.1:1234", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d answered %d with the store down, want 200", i+1, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != "" {
+			t.Errorf("request %d sent RateLimit-Remaining %q without a store", i+1, got)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    interface{}
+		wantErr error
+	}{
+		{"simple string", "+OK\r\n", "OK", nil},
+		{"integer", ":42\r\n", int64(42), nil},
+		{"bulk string", "$5\r\nhello\r\n", "hello", nil},
+		{"bulk string with CRLF", "$4\r\na\r\nb\r\n", "a\r\nb", nil},
+		{"nil bulk string", "$-1\r\n", nil, nil},
+		{"error", "-ERR unknown command\r\n", nil, redisError("ERR unknown command")},
+		{"array", "*2\r\n:1\r\n$3\r\n0.5\r\n", []interface{}{int64(1), "0.5"}, nil},
+		{"nested array", "*2\r\n*1\r\n+a\r\n:2\r\n", []interface{}{[]interface{}{"a"}, int64(2)}, nil},
+		{"error in array", "*2\r\n-ERR bad\r\n:1\r\n", []interface{}{nil, int64(1)}, nil},
+		{"empty array", "*0\r\n", []interface{}{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.reply)))
+			if err != tt.wantErr {
+				t.Fatalf("readReply(%q) error = %v, want %v", tt.reply, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readReply(%q) = %#v, want %#v", tt.reply, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplyRejectsMalformedReplies(t *testing.T) {
+	for _, reply := range []string{
+		"OK\r\n",         // no type
+		"+OK\n",          // no CR
+		":x\r\n",         // not an integer
+		"$5\r\nhi\r\n",   // bulk string cut short
+		"*2\r\n:1\r\n",   // array cut short
+		"",               // connection closed
+		"?unknown\r\n",   // unknown type
+		"$abc\r\nxx\r\n", // bad length
+	} {
+		if _, err := readReply(bufio.NewReader(strings.NewReader(reply))); err == nil {
+			t.Errorf("readReply(%q) succeeded, want an error", reply)
+		}
+	}
+}
+
+func TestRedisStoreTake(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewRedisStore(mr.Addr(), "")
+	limit := Limit{Requests: 2, Per: time.Minute}
+	ctx := context.Background()
+
+	// The bucket starts full and refills at one token every 30s
+	for i, want := range []Result{
+		{Allowed: true, Remaining: 1, Reset: 30 * time.Second},
+		{Allowed: true, Remaining: 0, Reset: time.Minute},
+		{Allowed: false, Remaining: 0, RetryAfter: 30 * time.Second, Reset: time.Minute},
+	} {
+		got, err := store.Take(ctx, "user:1", limit)
+		if err != nil {
+			t.Fatalf("Take #%d: %v", i+1, err)
+		}
+		if got.Allowed != want.Allowed || got.Remaining != want.Remaining ||
+			!near(got.RetryAfter, want.RetryAfter) || !near(got.Reset, want.Reset) {
+			t.Errorf("Take #%d = %+v, want %+v", i+1, got, want)
+		}
+	}
+
+	// Other keys have their own bucket
+	if got, err := store.Take(ctx, "user:2", limit); err != nil || !got.Allowed {
+		t.Errorf("Take of another key = %+v, %v, want allowed", got, err)
+	}
+
+	// Buckets expire once they would be full again
+	if ttl := mr.TTL("user:1"); ttl <= time.Minute || ttl > time.Minute+2*time.Second {
+		t.Errorf("bucket TTL = %v, want a minute and a second", ttl)
+	}
+}
+
+func TestRedisStoreRefillsWithRedisClock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	now := time.Now()
+	mr.SetTime(now)
+	store := NewRedisStore(mr.Addr(), "")
+	limit := Limit{Requests: 2, Per: time.Minute}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := store.Take(ctx, "ip:192.0.2.1", limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Half a minute later one token is back
+	mr.SetTime(now.Add(30 * time.Second))
+	got, err := store.Take(ctx, "ip:192.0.2.1", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Allowed || got.Remaining != 0 {
+		t.Errorf("Take after 30s = %+v, want allowed with none remaining", got)
+	}
+}
+
+func TestRedisStoreAuthenticates(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+	limit := Limit{Requests: 1, Per: time.Second}
+
+	if _, err := NewRedisStore(mr.Addr(), "secret").Take(context.Background(), "k", limit); err != nil {
+		t.Errorf("Take with the password: %v", err)
+	}
+	if _, err := NewRedisStore(mr.Addr(), "wrong").Take(context.Background(), "k", limit); err == nil {
+		t.Error("Take with a wrong password succeeded")
+	}
+}
+
+func TestRedisStoreKeepsConnectionAfterErrorReply(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewRedisStore(mr.Addr(), "")
+
+	var replyErr redisError
+	if _, err := store.do(context.Background(), "NOSUCHCOMMAND"); !errors.As(err, &replyErr) {
+		t.Fatalf("do(NOSUCHCOMMAND) error = %v, want a redis error reply", err)
+	}
+	if got := len(store.idle); got != 1 {
+		t.Errorf("%d idle connections after an error reply, want 1", got)
+	}
+	if _, err := store.Take(context.Background(), "k", Limit{Requests: 1, Per: time.Second}); err != nil {
+		t.Errorf("Take after an error reply: %v", err)
+	}
+	if got := mr.TotalConnectionCount(); got != 1 {
+		t.Errorf("opened %d connections, want 1", got)
+	}
+}
+
+// near reports whether two durations are within the rounding of the script's millisecond clock
+func near(a, b time.Duration) bool {
+	d := a - b
+	return d > -100*time.Millisecond && d < 100*time.Millisecond
+}
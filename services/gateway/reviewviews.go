@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gateway/cache"
+	"gateway/routes"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/batch"
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// guestUserID is the user the review service records anonymous review views under
+const guestUserID = 1
+
+type reviewView struct {
+	UserID     int       `json:"user_id"`
+	BusinessID int       `json:"business_id"`
+	ReviewID   int       `json:"review_id"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	ViewedAt   time.Time `json:"viewed_at"`
+
+	// request is the span of the request the view was seen in
+	request trace.SpanContext
+}
+
+// SpanContext links the delivery of the view to the request it was seen in
+func (v reviewView) SpanContext() trace.SpanContext {
+	return v.request
+}
+
+// reviewViewLog records the review views of review lists answered from the gateway
+// cache, which the review service never sees. Views are batched to the logging
+// service; when it can't keep up they are dropped rather than slowing down reads.
+type reviewViewLog struct {
+	*batch.Client[reviewView]
+}
+
+func newReviewViewLog(loggingURL string) *reviewViewLog {
+	return &reviewViewLog{batch.New(batch.Config{
+		URL:           loggingURL + "/logs/review-views:batch",
+		Name:          "review_views",
+		QueueSize:     10000,
+		BatchSize:     batch.MaxBatchSize,
+		FlushInterval: 2 * time.Second,
+		Workers:       1,
+		MaxRetries:    3,
+		Timeout:       5 * time.Second,
+		Transport:     tracing.NewTransport("logging-service", nil),
+	}, batch.EncodeEvents[reviewView])}
+}
+
+// hook is the review_views on_hit hook for GET /businesses/:id/reviews
+func (l *reviewViewLog) hook(c *gin.Context) {
+	value, _ := c.Get(routes.CachedEntryKey)
+	entry, ok := value.(*cache.Entry)
+	if !ok || entry.Status != http.StatusOK {
+		return
+	}
+	businessID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return
+	}
+	var reviews []struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(entry.Body, &reviews); err != nil {
+		return
+	}
+
+	now := time.Now()
+	request := trace.SpanContextFromContext(c.Request.Context())
+	for _, review := range reviews {
+		view := reviewView{
+			UserID:     guestUserID,
+			BusinessID: businessID,
+			ReviewID:   review.ID,
+			IPAddress:  c.ClientIP(),
+			UserAgent:  c.GetHeader("User-Agent"),
+			ViewedAt:   now,
+			request:    request,
+		}
+		if !l.Enqueue(view) {
+			logger.From(c.Request.Context()).Warn("Review view queue full, dropping view", "review_id", review.ID)
+		}
+	}
+}
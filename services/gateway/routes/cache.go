@@ -0,0 +1,201 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gateway/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CachedEntryKey is where on_hit hooks find the *cache.Entry the request was answered with
+const CachedEntryKey = "cache_entry"
+
+// cacheFetch marks requests made to fill the cache, whose X-Cache-Tags are kept
+type cacheFetch struct{}
+
+// cacheHandler answers anonymous requests from the cache. Concurrent misses share one
+// upstream request, and stale entries are served while one request refreshes them.
+// Signed-in callers may get responses made for them, so they always go upstream.
+func (b *Builder) cacheHandler(route Route, proxy http.Handler, timeout time.Duration, serve gin.HandlerFunc) gin.HandlerFunc {
+	rc := route.Cache
+	ttl, stale := time.Duration(rc.TTL), time.Duration(rc.StaleWhileRevalidate)
+
+	var onHit []gin.HandlerFunc
+	for _, hook := range rc.OnHit {
+		onHit = append(onHit, b.Hooks[hook])
+	}
+
+	return func(c *gin.Context) {
+		if _, ok := c.Get("user_id"); ok || c.GetHeader("Authorization") != "" {
+			c.Header("X-Cache", "BYPASS")
+			serve(c)
+			return
+		}
+
+		key := cacheKey(c.Request, rc.Vary)
+		fetcher := func() func() *cache.Entry {
+			// The fetch may outlive this request, so it gets its own copy and a context
+			// that isn't cancelled with it but stays in its trace
+			req := upstreamRequest(c, route, c.Request.Context()).Clone(context.WithoutCancel(c.Request.Context()))
+			req.Body = http.NoBody
+
+			return func() *cache.Entry {
+				ctx, cancel := context.WithTimeout(context.WithValue(req.Context(), cacheFetch{}, true), timeout)
+				defer cancel()
+
+				generation := b.Cache.Generation()
+				rec := &recorder{header: http.Header{}}
+				proxy.ServeHTTP(rec, req.WithContext(ctx))
+				entry := rec.entry()
+				if storable(entry, rc.Vary) {
+					b.Cache.Set(key, entry, ttl, stale, generation)
+				}
+				return entry
+			}
+		}
+
+		entry, state := b.Cache.Get(key)
+		status, upstreamSaw := "HIT", false
+		switch state {
+		case cache.Stale:
+			status = "STALE"
+			upstreamSaw = b.Cache.Refresh(key, fetcher())
+		case cache.Miss:
+			entry, upstreamSaw = b.Cache.Do(key, fetcher())
+			if upstreamSaw {
+				status = "MISS"
+			}
+		}
+
+		if !upstreamSaw {
+			c.Set(CachedEntryKey, entry)
+			for _, hook := range onHit {
+				hook(c)
+			}
+		}
+		writeEntry(c, entry, status, rc.Vary)
+	}
+}
+
+// cacheKey tells apart requests that may get different responses
+func cacheKey(req *http.Request, vary []string) string {
+	var key strings.Builder
+	key.WriteString(req.URL.EscapedPath())
+	key.WriteString("?")
+	key.WriteString(req.URL.Query().Encode())
+	for _, header := range vary {
+		key.WriteString("\n")
+		key.WriteString(header)
+		key.WriteString(": ")
+		key.WriteString(strings.Join(req.Header.Values(header), ", "))
+	}
+	return key.String()
+}
+
+// storable reports whether a response may be cached and served to other clients
+func storable(e *cache.Entry, vary []string) bool {
+	if e.Status != http.StatusOK || e.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, directive := range strings.Split(strings.ToLower(e.Header.Get("Cache-Control")), ",") {
+		switch strings.TrimSpace(directive) {
+		case "no-store", "private", "no-cache":
+			return false
+		}
+	}
+	// The key must cover every header the upstream says the response depends on
+	for _, value := range e.Header.Values("Vary") {
+		for _, header := range strings.Split(value, ",") {
+			header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+			if header != "" && !contains(vary, header) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEntry answers with an entry, or with 304 when the client already has it
+func writeEntry(c *gin.Context, e *cache.Entry, status string, vary []string) {
+	header := c.Writer.Header()
+	for k, values := range e.Header {
+		header[k] = append([]string(nil), values...)
+	}
+	header.Set("X-Cache", status)
+	if e.Status != http.StatusOK {
+		c.Status(e.Status)
+		c.Writer.Write(e.Body)
+		return
+	}
+
+	// Responses depend on who is signed in, so clients must revalidate before reuse
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Vary", strings.Join(append([]string{"Authorization"}, vary...), ", "))
+	header.Set("ETag", e.ETag)
+	if status != "MISS" {
+		header.Set("Age", strconv.Itoa(int(e.Age(time.Now()).Seconds())))
+	}
+
+	if e.Matches(c.GetHeader("If-None-Match")) {
+		header.Del("Content-Length")
+		header.Del("Content-Type")
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	header.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	c.Status(e.Status)
+	c.Writer.Write(e.Body)
+}
+
+// recorder captures a proxied response
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(p)
+}
+
+func (r *recorder) entry() *cache.Entry {
+	header := r.header.Clone()
+	tags := strings.Fields(strings.Join(header.Values("X-Cache-Tags"), " "))
+	header.Del("X-Cache-Tags")
+	header.Del("Content-Length")
+	header.Del("Date")
+
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	e := cache.NewEntry(r.status, header, r.body.Bytes())
+	e.Tags = tags
+	return e
+}
@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newCachingRouter builds a router caching GET /businesses/:id from svc, which also
+// takes POST /businesses/:id
+func newCachingRouter(t *testing.T, svc *httptest.Server) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg, err := Load(writeTable(t, `
+defaults:
+  upstream:
+    health_check: { interval: 0s }
+upstreams:
+  business:
+    url: `+svc.URL+`
+routes:
+  - { method: GET, path: /businesses/:id, upstream: business, auth: optional, cache: { ttl: 1m } }
+  - { method: POST, path: /businesses/:id, upstream: business, auth: optional }
+`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	router, err := (&Builder{}).Build(cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return router
+}
+
+func TestCacheBypassesSignedInCallers(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	var hits atomic.Int32
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		w.Header().Set("X-Cache-Tags", "business:1")
+		fmt.Fprintf(w, `{"name":"Cafe","viewer":%q,"response":%d}`, r.Header.Get("X-User-ID"), n)
+	}))
+	defer svc.Close()
+	r := newCachingRouter(t, svc)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 7, "email": "alice@example.com"}).
+		SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCache     string
+		wantHits      int32
+	}{
+		// Responses for signed-in callers are never stored for others
+		{"signed in", "Bearer " + token, "BYPASS", 1},
+		{"anonymous", "", "MISS", 2},
+		{"anonymous again", "", "HIT", 2},
+		{"signed in after caching", "Bearer " + token, "BYPASS", 3},
+		// Even a token the gateway can't verify may mean the service answers differently
+		{"invalid token", "Bearer not-a-token", "BYPASS", 4},
+		{"anonymous after bypasses", "", "HIT", 4},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/businesses/1", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: answered %d", tt.name, w.Code)
+		}
+		if got := w.Header().Get("X-Cache"); got != tt.wantCache {
+			t.Errorf("%s: X-Cache = %q, want %q", tt.name, got, tt.wantCache)
+		}
+		if got := hits.Load(); got != tt.wantHits {
+			t.Errorf("%s: upstream got %d requests, want %d", tt.name, got, tt.wantHits)
+		}
+		if got := w.Header().Get("X-Cache-Tags"); got != "" {
+			t.Errorf("%s: X-Cache-Tags %q reached the client", tt.name, got)
+		}
+	}
+}
+
+func TestCachePurgedByUpstream(t *testing.T) {
+	var hits atomic.Int32
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Header().Set("X-Cache-Purge", "business:1")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		hits.Add(1)
+		w.Header().Set("X-Cache-Tags", "business:"+r.URL.Path[len("/businesses/"):])
+		fmt.Fprint(w, `{"name":"Cafe"}`)
+	}))
+	defer svc.Close()
+	r := newCachingRouter(t, svc)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	serve(http.MethodGet, "/businesses/1")
+	serve(http.MethodGet, "/businesses/2")
+
+	w := serve(http.MethodPost, "/businesses/1")
+	if got := w.Header().Get("X-Cache-Purge"); got != "" {
+		t.Errorf("X-Cache-Purge %q reached the client", got)
+	}
+
+	for path, want := range map[string]string{"/businesses/1": "MISS", "/businesses/2": "HIT"} {
+		if got := serve(http.MethodGet, path).Header().Get("X-Cache"); got != want {
+			t.Errorf("GET %s after purging business:1: X-Cache = %q, want %q", path, got, want)
+		}
+	}
+	if got := hits.Load(); got != 3 {
+		t.Errorf("upstream got %d GETs, want 3", got)
+	}
+}
@@ -0,0 +1,538 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gateway/middleware"
+	"gateway/ratelimit"
+	"gateway/upstream"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Auth modes of a route
+const (
+	// AuthNone forwards the request anonymously
+	AuthNone = "none"
+	// AuthOptional identifies the caller when a valid token is sent
+	AuthOptional = "optional"
+	// AuthRequired rejects requests without a valid token
+	AuthRequired = "required"
+)
+
+// Config is the gateway's route table. It is read from YAML; JSON files are valid YAML.
+type Config struct {
+	Defaults  Defaults            `yaml:"defaults"`
+	Upstreams map[string]Upstream `yaml:"upstreams"`
+	Routes    []Route             `yaml:"routes"`
+}
+
+type Defaults struct {
+	// Timeout applies to routes that don't set their own
+	Timeout Duration `yaml:"timeout"`
+	// RateLimit applies to routes that don't set their own
+	RateLimit *RateLimit `yaml:"rate_limit"`
+	// Upstream applies to upstreams that don't set their own values
+	Upstream Policy `yaml:"upstream"`
+}
+
+// Upstream is a service requests are proxied to. Its instances are listed in URL or
+// URLs, or found in DNS by Discovery.
+type Upstream struct {
+	// URL may reference environment variables as ${NAME} or ${NAME:-default} and may
+	// expand to a comma-separated list of instances
+	URL  string   `yaml:"url"`
+	URLs []string `yaml:"urls"`
+	// Discovery finds the instances in DNS, e.g. a Kubernetes headless service
+	Discovery *Discovery `yaml:"discovery"`
+	Policy    `yaml:",inline"`
+
+	target   *url.URL
+	settings upstream.Settings
+}
+
+// Policy is how requests to an upstream are sent
+type Policy struct {
+	// ConnectTimeout bounds connecting to the upstream
+	ConnectTimeout Duration `yaml:"connect_timeout"`
+	// ResponseTimeout bounds waiting for the response headers of each attempt
+	ResponseTimeout Duration `yaml:"response_timeout"`
+	// Retries is how often failed GET, HEAD, OPTIONS, PUT and DELETE requests are retried
+	Retries *int `yaml:"retries"`
+	// RetryBackoff is the base delay between retries
+	RetryBackoff Duration `yaml:"retry_backoff"`
+	Breaker      *Breaker `yaml:"breaker"`
+	// Balance is round_robin or least_connections
+	Balance     string       `yaml:"balance"`
+	HealthCheck *HealthCheck `yaml:"health_check"`
+}
+
+// Discovery finds instances in the A/AAAA records of DNS, listening on Port, or in the
+// SRV records of SRV
+type Discovery struct {
+	DNS  string `yaml:"dns"`
+	SRV  string `yaml:"srv"`
+	Port int    `yaml:"port"`
+	// Scheme is http (default) or https
+	Scheme string `yaml:"scheme"`
+	// Interval is how often the records are looked up (default 10s)
+	Interval Duration `yaml:"interval"`
+}
+
+// HealthCheck probes each instance every Interval by requesting all of Paths. An
+// instance is ejected after Unhealthy failed probes in a row and restored after Healthy
+// good ones. Interval: 0 disables it.
+type HealthCheck struct {
+	Paths     []string `yaml:"paths"`
+	Interval  Duration `yaml:"interval"`
+	Timeout   Duration `yaml:"timeout"`
+	Unhealthy int      `yaml:"unhealthy"`
+	Healthy   int      `yaml:"healthy"`
+}
+
+// Breaker opens after Failures consecutive failures and rejects requests for OpenFor.
+// Failures: 0 disables it.
+type Breaker struct {
+	Failures int      `yaml:"failures"`
+	OpenFor  Duration `yaml:"open_for"`
+}
+
+type Route struct {
+	Method   string `yaml:"method"`
+	Path     string `yaml:"path"`
+	Upstream string `yaml:"upstream"`
+	// Auth is none, optional or required
+	Auth string `yaml:"auth"`
+	// Roles the caller must all have; requires auth: required
+	Roles []string `yaml:"roles"`
+	// Timeout bounds the upstream request, including the response body.
+	// Zero uses the default; streaming routes have no timeout.
+	Timeout Duration `yaml:"timeout"`
+	// Stream flushes the response to the client as it arrives (Server-Sent Events)
+	Stream bool `yaml:"stream"`
+	// Hooks are named gateway handlers run before the request is proxied
+	Hooks   []string `yaml:"hooks"`
+	Rewrite *Rewrite `yaml:"rewrite"`
+	// RateLimit overrides defaults.rate_limit; set requests: 0 to disable it
+	RateLimit *RateLimit `yaml:"rate_limit"`
+	// Cache answers anonymous GET requests from the gateway's cache
+	Cache *Cache `yaml:"cache"`
+}
+
+// Cache keeps responses for TTL and then serves them for up to StaleWhileRevalidate
+// more while a fresh one is fetched. Requests are told apart by path, query and the
+// Vary headers. OnHit hooks run for requests answered without the upstream, so it can
+// record what it would have recorded itself.
+type Cache struct {
+	TTL                  Duration `yaml:"ttl"`
+	StaleWhileRevalidate Duration `yaml:"stale_while_revalidate"`
+	Vary                 []string `yaml:"vary"`
+	OnHit                []string `yaml:"on_hit"`
+}
+
+// RateLimit is a token bucket per caller: Burst requests at once (default Requests),
+// refilled at Requests per Per. Key is user, ip or api_key.
+type RateLimit struct {
+	Key      string   `yaml:"key"`
+	Requests int      `yaml:"requests"`
+	Per      Duration `yaml:"per"`
+	Burst    int      `yaml:"burst"`
+}
+
+// Rewrite changes the path sent upstream. Path replaces it entirely and may use the
+// route's :params; otherwise StripPrefix is removed and AddPrefix prepended.
+type Rewrite struct {
+	Path        string `yaml:"path"`
+	StripPrefix string `yaml:"strip_prefix"`
+	AddPrefix   string `yaml:"add_prefix"`
+}
+
+func (r Route) String() string {
+	return r.Method + " " + r.Path
+}
+
+// Duration reads Go duration strings such as "30s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Load reads and validates a route table
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var cfg Config
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+var methods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// validate checks the whole table and reports every problem at once
+func (cfg *Config) validate() error {
+	var errs []error
+
+	if cfg.Defaults.Timeout < 0 {
+		errs = append(errs, errors.New("defaults.timeout must not be negative"))
+	}
+	if cfg.Defaults.Timeout == 0 {
+		cfg.Defaults.Timeout = Duration(30 * time.Second)
+	}
+	if err := cfg.Defaults.RateLimit.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("defaults.rate_limit: %w", err))
+	}
+	if err := cfg.Defaults.Upstream.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("defaults.upstream: %w", err))
+	}
+	defaults := cfg.Defaults.Upstream.inherit(builtinPolicy)
+
+	for name, up := range cfg.Upstreams {
+		endpoints, target, err := up.endpoints()
+		if err == nil {
+			err = up.Policy.validate()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("upstreams.%s: %w", name, err))
+			continue
+		}
+		up.target = target
+		up.settings = up.Policy.inherit(defaults).settings(endpoints)
+		cfg.Upstreams[name] = up
+	}
+
+	if len(cfg.Routes) == 0 {
+		errs = append(errs, errors.New("no routes defined"))
+	}
+
+	seen := map[string]bool{}
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		route.Method = strings.ToUpper(route.Method)
+		if route.Auth == "" {
+			route.Auth = AuthNone
+		}
+
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, fmt.Errorf("routes[%d] (%s): %s", i, route, fmt.Sprintf(format, args...)))
+		}
+
+		if !methods[route.Method] {
+			fail("unsupported method %q", route.Method)
+		}
+		if !strings.HasPrefix(route.Path, "/") {
+			fail("path must start with /")
+		}
+		if seen[route.String()] {
+			fail("duplicate route")
+		}
+		seen[route.String()] = true
+
+		if _, ok := cfg.Upstreams[route.Upstream]; !ok {
+			fail("unknown upstream %q", route.Upstream)
+		}
+
+		switch route.Auth {
+		case AuthNone, AuthOptional, AuthRequired:
+		default:
+			fail("auth must be none, optional or required")
+		}
+		for _, role := range route.Roles {
+			if !middleware.KnownRole(role) {
+				fail("unknown role %q", role)
+			}
+		}
+		if len(route.Roles) > 0 && route.Auth != AuthRequired {
+			fail("roles require auth: required")
+		}
+
+		if route.Timeout < 0 {
+			fail("timeout must not be negative")
+		}
+		if err := route.RateLimit.validate(); err != nil {
+			fail("rate_limit: %v", err)
+		}
+		if route.RateLimit == nil {
+			route.RateLimit = cfg.Defaults.RateLimit
+		}
+
+		if rc := route.Cache; rc != nil {
+			if route.Method != http.MethodGet || route.Stream {
+				fail("cache is only for GET routes that don't stream")
+			}
+			if rc.TTL <= 0 || rc.StaleWhileRevalidate < 0 {
+				fail("cache.ttl must be positive and cache.stale_while_revalidate must not be negative")
+			}
+			for i, header := range rc.Vary {
+				rc.Vary[i] = http.CanonicalHeaderKey(header)
+			}
+		}
+
+		if rw := route.Rewrite; rw != nil {
+			if rw.Path != "" && (rw.StripPrefix != "" || rw.AddPrefix != "") {
+				fail("rewrite.path can't be combined with strip_prefix or add_prefix")
+			}
+			if rw.Path != "" && !strings.HasPrefix(rw.Path, "/") {
+				fail("rewrite.path must start with /")
+			}
+			if rw.StripPrefix != "" && !strings.HasPrefix(route.Path, rw.StripPrefix) {
+				fail("path doesn't start with rewrite.strip_prefix %q", rw.StripPrefix)
+			}
+			if rw.AddPrefix != "" && !strings.HasPrefix(rw.AddPrefix, "/") {
+				fail("rewrite.add_prefix must start with /")
+			}
+			for _, param := range pathParams(rw.Path) {
+				if !containsParam(route.Path, param) {
+					fail("rewrite.path uses :%s, which is not in the route path", param)
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (rl *RateLimit) validate() error {
+	if rl == nil || rl.Requests == 0 {
+		return nil
+	}
+	switch rl.Key {
+	case ratelimit.KeyUser, ratelimit.KeyIP, ratelimit.KeyAPIKey:
+	default:
+		return fmt.Errorf("key must be user, ip or api_key")
+	}
+	if rl.Requests < 0 || rl.Per <= 0 || rl.Burst < 0 {
+		return fmt.Errorf("requests and per must be positive and burst must not be negative")
+	}
+	return nil
+}
+
+// endpoints returns the upstream's instances and the URL requests are rewritten to;
+// its host is replaced by the instance chosen for each request
+func (up Upstream) endpoints() (upstream.Endpoints, *url.URL, error) {
+	var endpoints upstream.Endpoints
+
+	if d := up.Discovery; d != nil {
+		if up.URL != "" || len(up.URLs) > 0 {
+			return endpoints, nil, errors.New("discovery can't be combined with url or urls")
+		}
+		if (d.DNS == "") == (d.SRV == "") {
+			return endpoints, nil, errors.New("discovery needs exactly one of dns or srv")
+		}
+		if d.DNS != "" && (d.Port <= 0 || d.Port > 65535) {
+			return endpoints, nil, errors.New("discovery.dns needs a port")
+		}
+		if d.Scheme == "" {
+			d.Scheme = "http"
+		}
+		if d.Scheme != "http" && d.Scheme != "https" {
+			return endpoints, nil, errors.New("discovery.scheme must be http or https")
+		}
+		if d.Interval < 0 {
+			return endpoints, nil, errors.New("discovery.interval must not be negative")
+		}
+		if d.Interval == 0 {
+			d.Interval = Duration(10 * time.Second)
+		}
+
+		name := expandEnv(d.DNS + d.SRV)
+		endpoints.Scheme = d.Scheme
+		endpoints.Discovery = &upstream.Discovery{
+			Name:     name,
+			SRV:      d.SRV != "",
+			Port:     d.Port,
+			Interval: time.Duration(d.Interval),
+		}
+		return endpoints, &url.URL{Scheme: d.Scheme, Host: name}, nil
+	}
+
+	var raw []string
+	for _, u := range append([]string{up.URL}, up.URLs...) {
+		for _, part := range strings.Split(expandEnv(u), ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				raw = append(raw, part)
+			}
+		}
+	}
+	if len(raw) == 0 {
+		return endpoints, nil, errors.New("url, urls or discovery is required")
+	}
+
+	var target *url.URL
+	for _, u := range raw {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return endpoints, nil, fmt.Errorf("url %q must be an absolute http(s) URL", u)
+		}
+		if target == nil {
+			target = parsed
+		} else if parsed.Scheme != target.Scheme || parsed.Path != target.Path {
+			return endpoints, nil, fmt.Errorf("url %q must have the same scheme and path as %q", u, target)
+		}
+		endpoints.Hosts = append(endpoints.Hosts, parsed.Host)
+	}
+	endpoints.Scheme = target.Scheme
+	return endpoints, target, nil
+}
+
+// builtinPolicy applies to whatever neither the upstream nor defaults.upstream sets
+var builtinPolicy = Policy{
+	ConnectTimeout:  Duration(2 * time.Second),
+	ResponseTimeout: Duration(10 * time.Second),
+	Retries:         intPtr(2),
+	RetryBackoff:    Duration(100 * time.Millisecond),
+	Breaker:         &Breaker{Failures: 5, OpenFor: Duration(30 * time.Second)},
+	Balance:         upstream.BalanceRoundRobin,
+	HealthCheck: &HealthCheck{
+		Paths:     []string{"/health", "/ready"},
+		Interval:  Duration(5 * time.Second),
+		Timeout:   Duration(time.Second),
+		Unhealthy: 2,
+		Healthy:   2,
+	},
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func (p Policy) validate() error {
+	var errs []error
+	if p.ConnectTimeout < 0 || p.ResponseTimeout < 0 || p.RetryBackoff < 0 {
+		errs = append(errs, errors.New("timeouts and retry_backoff must not be negative"))
+	}
+	if p.Retries != nil && (*p.Retries < 0 || *p.Retries > 5) {
+		errs = append(errs, errors.New("retries must be between 0 and 5"))
+	}
+	if b := p.Breaker; b != nil && (b.Failures < 0 || (b.Failures > 0 && b.OpenFor <= 0)) {
+		errs = append(errs, errors.New("breaker.failures must not be negative and breaker.open_for must be positive"))
+	}
+	switch p.Balance {
+	case "", upstream.BalanceRoundRobin, upstream.BalanceLeastConnections:
+	default:
+		errs = append(errs, errors.New("balance must be round_robin or least_connections"))
+	}
+	if hc := p.HealthCheck; hc != nil {
+		if hc.Interval < 0 || hc.Timeout < 0 || hc.Unhealthy < 0 || hc.Healthy < 0 {
+			errs = append(errs, errors.New("health_check values must not be negative"))
+		}
+		for _, path := range hc.Paths {
+			if !strings.HasPrefix(path, "/") {
+				errs = append(errs, fmt.Errorf("health_check path %q must start with /", path))
+			}
+		}
+		if hc.Interval > 0 && len(hc.Paths) == 0 {
+			errs = append(errs, errors.New("health_check needs paths"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// inherit fills in what p doesn't set from defaults
+func (p Policy) inherit(defaults Policy) Policy {
+	if p.ConnectTimeout == 0 {
+		p.ConnectTimeout = defaults.ConnectTimeout
+	}
+	if p.ResponseTimeout == 0 {
+		p.ResponseTimeout = defaults.ResponseTimeout
+	}
+	if p.Retries == nil {
+		p.Retries = defaults.Retries
+	}
+	if p.RetryBackoff == 0 {
+		p.RetryBackoff = defaults.RetryBackoff
+	}
+	if p.Breaker == nil {
+		p.Breaker = defaults.Breaker
+	}
+	if p.Balance == "" {
+		p.Balance = defaults.Balance
+	}
+	if p.HealthCheck == nil {
+		p.HealthCheck = defaults.HealthCheck
+	}
+	return p
+}
+
+func (p Policy) settings(endpoints upstream.Endpoints) upstream.Settings {
+	endpoints.Balance = p.Balance
+
+	hc := *p.HealthCheck
+	if hc.Timeout == 0 {
+		hc.Timeout = Duration(time.Second)
+	}
+	endpoints.HealthCheck = upstream.HealthCheck{
+		Paths:     hc.Paths,
+		Interval:  time.Duration(hc.Interval),
+		Timeout:   time.Duration(hc.Timeout),
+		Unhealthy: max(hc.Unhealthy, 1),
+		Healthy:   max(hc.Healthy, 1),
+	}
+
+	return upstream.Settings{
+		ConnectTimeout:   time.Duration(p.ConnectTimeout),
+		ResponseTimeout:  time.Duration(p.ResponseTimeout),
+		Retries:          *p.Retries,
+		RetryBackoff:     time.Duration(p.RetryBackoff),
+		FailureThreshold: p.Breaker.Failures,
+		OpenFor:          time.Duration(p.Breaker.OpenFor),
+		Endpoints:        endpoints,
+	}
+}
+
+// pathParams returns the names of the :params and *params in a path
+func pathParams(path string) []string {
+	var params []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+		}
+	}
+	return params
+}
+
+func containsParam(path, name string) bool {
+	for _, param := range pathParams(path) {
+		if param == name {
+			return true
+		}
+	}
+	return false
+}
+
+// expandEnv replaces ${NAME} and ${NAME:-default} with environment variables
+func expandEnv(s string) string {
+	return os.Expand(s, func(key string) string {
+		name, fallback, hasDefault := strings.Cut(key, ":-")
+		if value := os.Getenv(name); value != "" || !hasDefault {
+			return value
+		}
+		return fallback
+	})
+}
@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTable writes a route table to a temporary file and returns its path
+func writeTable(t *testing.T, table string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	if err := os.WriteFile(path, []byte(table), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testTable is a valid table with a review upstream; routes are appended to it
+const testTable = `
+defaults:
+  upstream:
+    health_check: { interval: 0s }
+upstreams:
+  review:
+    url: http://review-service:8082
+routes:
+`
+
+func TestLoadValidatesTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes string
+		want   []string
+	}{
+		{
+			name:   "valid",
+			routes: `  - { method: get, path: /reviews/:id, upstream: review, rewrite: { path: /internal/reviews/:id } }`,
+		},
+		{
+			name:   "unsupported method",
+			routes: `  - { method: TRACE, path: /reviews, upstream: review }`,
+			want:   []string{`routes[0] (TRACE /reviews): unsupported method "TRACE"`},
+		},
+		{
+			name:   "relative path",
+			routes: `  - { method: GET, path: reviews, upstream: review }`,
+			want:   []string{"path must start with /"},
+		},
+		{
+			name: "duplicate route",
+			routes: `  - { method: GET, path: /reviews, upstream: review }
+  - { method: get, path: /reviews, upstream: review }`,
+			want: []string{"routes[1] (GET /reviews): duplicate route"},
+		},
+		{
+			name:   "unknown upstream",
+			routes: `  - { method: GET, path: /reviews, upstream: reviews }`,
+			want:   []string{`unknown upstream "reviews"`},
+		},
+		{
+			name:   "bad auth",
+			routes: `  - { method: GET, path: /reviews, upstream: review, auth: maybe }`,
+			want:   []string{"auth must be none, optional or required"},
+		},
+		{
+			name:   "roles without auth",
+			routes: `  - { method: GET, path: /admin, upstream: review, auth: optional, roles: [admin] }`,
+			want:   []string{"roles require auth: required"},
+		},
+		{
+			name:   "unknown role",
+			routes: `  - { method: GET, path: /admin, upstream: review, auth: required, roles: [owner] }`,
+			want:   []string{`unknown role "owner"`},
+		},
+		{
+			name:   "rate limit key",
+			routes: `  - { method: GET, path: /reviews, upstream: review, rate_limit: { key: cookie, requests: 10, per: 1m } }`,
+			want:   []string{"rate_limit: key must be user, ip or api_key"},
+		},
+		{
+			name:   "cache on POST",
+			routes: `  - { method: POST, path: /reviews, upstream: review, cache: { ttl: 30s } }`,
+			want:   []string{"cache is only for GET routes that don't stream"},
+		},
+		{
+			name:   "cache without ttl",
+			routes: `  - { method: GET, path: /reviews, upstream: review, cache: { stale_while_revalidate: 30s } }`,
+			want:   []string{"cache.ttl must be positive"},
+		},
+		{
+			name:   "rewrite param not in path",
+			routes: `  - { method: GET, path: /reviews/:id, upstream: review, rewrite: { path: /internal/:review_id } }`,
+			want:   []string{"rewrite.path uses :review_id, which is not in the route path"},
+		},
+		{
+			name:   "strip prefix not in path",
+			routes: `  - { method: GET, path: /reviews, upstream: review, rewrite: { strip_prefix: /api } }`,
+			want:   []string{`path doesn't start with rewrite.strip_prefix "/api"`},
+		},
+		{
+			name: "every problem is reported",
+			routes: `  - { method: GET, path: /reviews, upstream: business }
+  - { method: GET, path: /reviews, upstream: review, timeout: -1s }`,
+			want: []string{`unknown upstream "business"`, "routes[1] (GET /reviews): duplicate route", "timeout must not be negative"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeTable(t, testTable+tt.routes+"\n"))
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Load: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Load accepted the table, want %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load error %q doesn't contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadValidatesUpstreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream string
+		want     string
+	}{
+		{"no url", `{ response_timeout: 2m }`, "url, urls or discovery is required"},
+		{"relative url", `{ url: review-service:8082 }`, `url "review-service:8082" must be an absolute http(s) URL`},
+		{"mixed paths", `{ urls: [http://review-1:8082, http://review-2:8082/v2] }`, `url "http://review-2:8082/v2" must have the same scheme and path`},
+		{"discovery and url", `{ url: http://review-service:8082, discovery: { dns: review-service, port: 8082 } }`, "discovery can't be combined with url or urls"},
+		{"dns without port", `{ discovery: { dns: review-service } }`, "discovery.dns needs a port"},
+		{"too many retries", `{ url: http://review-service:8082, retries: 6 }`, "retries must be between 0 and 5"},
+		{"bad balance", `{ url: http://review-service:8082, balance: random }`, "balance must be round_robin or least_connections"},
+		{"health check without paths", `{ url: http://review-service:8082, health_check: { interval: 5s } }`, "health_check needs paths"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := "upstreams:\n  review: " + tt.upstream + "\nroutes:\n  - { method: GET, path: /reviews, upstream: review }\n"
+			_, err := Load(writeTable(t, table))
+			if err == nil || !strings.Contains(err.Error(), "upstreams.review: "+tt.want) {
+				t.Errorf("Load error = %v, want upstreams.review: %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownFields(t *testing.T) {
+	_, err := Load(writeTable(t, testTable+"  - { method: GET, path: /reviews, upstream: review, cache_ttl: 30s }\n"))
+	if err == nil || !strings.Contains(err.Error(), "cache_ttl") {
+		t.Errorf("Load error = %v, want one naming cache_ttl", err)
+	}
+}
+
+func TestLoadExpandsEnvironment(t *testing.T) {
+	t.Setenv("REVIEW_SERVICE_URL", "http://review.test:9000")
+	table := "upstreams:\n  review: { url: \"${REVIEW_SERVICE_URL:-http://review-service:8082}\" }\n" +
+		"  business: { url: \"${BUSINESS_SERVICE_URL_UNSET:-http://business-service:8081}\" }\n" +
+		"routes:\n  - { method: GET, path: /reviews, upstream: review }\n"
+	cfg, err := Load(writeTable(t, table))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := cfg.Upstreams["review"].target.String(); got != "http://review.test:9000" {
+		t.Errorf("review upstream = %s, want the URL from the environment", got)
+	}
+	if got := cfg.Upstreams["business"].target.String(); got != "http://business-service:8081" {
+		t.Errorf("business upstream = %s, want the default", got)
+	}
+}
@@ -0,0 +1,286 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+
+	"gateway/cache"
+	"gateway/middleware"
+	"gateway/ratelimit"
+	"gateway/upstream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/metrics"
+	"github.com/yelp-sample-v2/shared/server"
+	"github.com/yelp-sample-v2/shared/tracing"
+)
+
+// upstreamErrors counts proxied requests that got no usable answer from the upstream
+var upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_upstream_errors_total",
+	Help: "Proxied requests that failed, by upstream, route template and reason.",
+}, []string{"upstream", "method", "route", "reason"})
+
+// Builder turns a route table into a router
+type Builder struct {
+	// Base registers the gateway's own endpoints, such as health checks, on every router
+	Base func(r *gin.Engine)
+	// Hooks are the handlers routes can name in hooks
+	Hooks map[string]gin.HandlerFunc
+	// TrustedProxies are the proxies whose X-Forwarded-For is believed when finding the
+	// client IP. Trusting none stops clients from choosing the IP they are limited by.
+	TrustedProxies []string
+	// Limiter enforces rate limits; its buckets outlive reloads of the table
+	Limiter *ratelimit.Limiter
+	// Upstreams sends proxied requests; circuit breakers outlive reloads of the table
+	Upstreams *upstream.Pool
+	// Cache keeps responses of routes with a cache block
+	Cache *cache.Cache
+	// Streams, when cancelled, ends streaming responses so they don't hold up shutdown.
+	// Clients reconnect and resume elsewhere.
+	Streams context.Context
+}
+
+// Build creates a router for the table. Conflicting paths are reported as an error
+// rather than the panic gin raises for them.
+func (b *Builder) Build(cfg *Config) (router *gin.Engine, err error) {
+	for i, route := range cfg.Routes {
+		hooks := route.Hooks
+		if route.Cache != nil {
+			hooks = append(hooks[:len(hooks):len(hooks)], route.Cache.OnHit...)
+		}
+		for _, hook := range hooks {
+			if _, ok := b.Hooks[hook]; !ok {
+				return nil, fmt.Errorf("routes[%d] (%s): unknown hook %q", i, route, hook)
+			}
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			router = nil
+			err = fmt.Errorf("conflicting routes: %v", r)
+		}
+	}()
+
+	if b.Upstreams == nil {
+		b.Upstreams = upstream.NewPool()
+	}
+	if b.Cache == nil {
+		b.Cache = cache.New(64 << 20)
+	}
+
+	router = gin.New()
+	router.Use(tracing.Middleware(), logger.Middleware(""), metrics.Middleware(), logger.Recovery())
+	if err := router.SetTrustedProxies(b.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	if b.Base != nil {
+		b.Base(router)
+	}
+
+	for _, route := range cfg.Routes {
+		router.Handle(route.Method, route.Path, b.handlers(cfg, route)...)
+	}
+
+	// Only a table that built applies its upstream settings
+	settings := map[string]upstream.Settings{}
+	for name, up := range cfg.Upstreams {
+		settings[name] = up.settings
+	}
+	b.Upstreams.Configure(settings)
+	return router, nil
+}
+
+func (b *Builder) handlers(cfg *Config, route Route) []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+
+	switch route.Auth {
+	case AuthRequired:
+		handlers = append(handlers, middleware.Auth())
+	case AuthOptional:
+		handlers = append(handlers, middleware.OptionalAuth())
+	default:
+		handlers = append(handlers, middleware.Anonymous())
+	}
+	// Limits are checked after auth so they can be per user
+	if rl := route.RateLimit; rl != nil && rl.Requests > 0 && b.Limiter != nil {
+		handlers = append(handlers, b.Limiter.Handler(route.String(), rl.Key, ratelimit.Limit{
+			Requests: rl.Requests,
+			Per:      time.Duration(rl.Per),
+			Burst:    rl.Burst,
+		}))
+	}
+	if len(route.Roles) > 0 {
+		handlers = append(handlers, middleware.RequireRoles(route.Roles...))
+	}
+	for _, hook := range route.Hooks {
+		handlers = append(handlers, b.Hooks[hook])
+	}
+
+	return append(handlers, b.proxyHandler(cfg, route))
+}
+
+func (b *Builder) proxyHandler(cfg *Config, route Route) gin.HandlerFunc {
+	target := cfg.Upstreams[route.Upstream].target
+
+	timeout := time.Duration(route.Timeout)
+	if timeout == 0 {
+		timeout = time.Duration(cfg.Defaults.Timeout)
+	}
+	if route.Stream {
+		timeout = 0
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// Keep the chain of proxies in front of the gateway, then add the client
+			pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+			pr.SetXForwarded()
+			pr.SetURL(target)
+		},
+		Transport: b.Upstreams.Get(route.Upstream),
+		ModifyResponse: func(resp *http.Response) error {
+			// Services name what changed so cached responses built from it are dropped.
+			// Only this gateway's cache is purged; other replicas catch up within the TTL.
+			for _, purge := range resp.Header.Values("X-Cache-Purge") {
+				b.Cache.Purge(strings.Fields(purge)...)
+			}
+			resp.Header.Del("X-Cache-Purge")
+			if resp.Request.Context().Value(cacheFetch{}) == nil {
+				resp.Header.Del("X-Cache-Tags")
+			}
+			// The client already has the request ID from the gateway, and cached
+			// responses must not replay it
+			resp.Header.Del(tracing.RequestIDHeader)
+
+			// Error pages from something between the gateway and the service are
+			// replaced so clients always get the same JSON error body
+			switch resp.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+					return statusError(resp.StatusCode)
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			var open *upstream.OpenError
+			var status statusError
+			var netErr net.Error
+			switch {
+			case errors.As(err, &status):
+				upstreamErrors.WithLabelValues(route.Upstream, route.Method, route.Path, "bad_gateway_page").Inc()
+				writeError(w, int(status), status.Error())
+			case errors.As(err, &open):
+				upstreamErrors.WithLabelValues(route.Upstream, route.Method, route.Path, "circuit_open").Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.RetryAfter.Seconds()))))
+				writeError(w, http.StatusServiceUnavailable, "Upstream temporarily unavailable")
+			case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+				// The client went away; there is nobody to answer
+				upstreamErrors.WithLabelValues(route.Upstream, route.Method, route.Path, "client_canceled").Inc()
+			case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+				upstreamErrors.WithLabelValues(route.Upstream, route.Method, route.Path, "timeout").Inc()
+				writeError(w, http.StatusGatewayTimeout, "Upstream timed out")
+			default:
+				upstreamErrors.WithLabelValues(route.Upstream, route.Method, route.Path, "unavailable").Inc()
+				logger.From(r.Context()).Error("Proxy failed", "upstream", route.Upstream, "error", err)
+				writeError(w, http.StatusBadGateway, "Upstream unavailable")
+			}
+		},
+	}
+	if route.Stream {
+		proxy.FlushInterval = -1
+	}
+
+	serve := func(c *gin.Context) {
+		// The route's timeout, not the server's write timeout, bounds the response.
+		// The margin leaves time to answer 504 when it expires.
+		if timeout > 0 {
+			server.WriteDeadline(c, timeout+5*time.Second)
+		} else {
+			server.WriteDeadline(c, 0)
+		}
+
+		ctx := c.Request.Context()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if route.Stream && b.Streams != nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(ctx)
+			defer cancel()
+			stop := context.AfterFunc(b.Streams, cancel)
+			defer stop()
+		}
+		proxy.ServeHTTP(c.Writer, upstreamRequest(c, route, ctx))
+	}
+	if route.Cache != nil {
+		return b.cacheHandler(route, proxy, timeout, serve)
+	}
+	return serve
+}
+
+// upstreamRequest is the client's request as sent upstream, with its path rewritten
+func upstreamRequest(c *gin.Context, route Route, ctx context.Context) *http.Request {
+	req := c.Request.WithContext(ctx)
+	if route.Rewrite != nil {
+		u := *req.URL
+		u.Path = rewritePath(route, c)
+		u.RawPath = ""
+		req.URL = &u
+	}
+	return req
+}
+
+// rewritePath returns the path to request upstream
+func rewritePath(route Route, c *gin.Context) string {
+	rw := route.Rewrite
+	if rw.Path != "" {
+		segments := strings.Split(rw.Path, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+				segments[i] = strings.TrimPrefix(c.Param(segment[1:]), "/")
+			}
+		}
+		return strings.Join(segments, "/")
+	}
+
+	path := strings.TrimPrefix(c.Request.URL.Path, rw.StripPrefix)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return strings.TrimSuffix(rw.AddPrefix, "/") + path
+}
+
+// statusError is a gateway error status answered by the upstream
+type statusError int
+
+func (e statusError) Error() string {
+	switch e {
+	case http.StatusServiceUnavailable:
+		return "Upstream temporarily unavailable"
+	case http.StatusGatewayTimeout:
+		return "Upstream timed out"
+	}
+	return "Upstream unavailable"
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "{\"error\":%q}\n", message)
+}
@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Table serves requests with the router built from a route table file and swaps in a
+// new router when the file is reloaded. Requests already being served finish on the
+// router they started on.
+type Table struct {
+	path    string
+	builder *Builder
+	router  atomic.Pointer[gin.Engine]
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewTable loads the route table at path. An invalid table is an error here;
+// on reload it is logged and the current routes are kept.
+func NewTable(path string, builder *Builder) (*Table, error) {
+	t := &Table{path: path, builder: builder}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Table) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.router.Load().ServeHTTP(w, r)
+}
+
+// Reload reads, validates and builds the route table, replacing the current routes
+// only if every step succeeds
+func (t *Table) Reload() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := Load(t.path)
+	if err != nil {
+		return err
+	}
+	router, err := t.builder.Build(cfg)
+	if err != nil {
+		return err
+	}
+
+	t.router.Store(router)
+	t.modTime, t.size = info.ModTime(), info.Size()
+	slog.Info("Loaded routes", "routes", len(cfg.Routes), "path", t.path)
+	return nil
+}
+
+// Watch reloads the table whenever the file changes, until ctx is done
+func (t *Table) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(t.path)
+		if err != nil {
+			continue
+		}
+		t.mu.Lock()
+		changed := !info.ModTime().Equal(t.modTime) || info.Size() != t.size
+		t.mu.Unlock()
+		if !changed {
+			continue
+		}
+
+		if err := t.Reload(); err != nil {
+			slog.Error("Keeping current routes, reload failed", "error", err)
+			// Don't retry the same broken file every tick
+			t.mu.Lock()
+			t.modTime, t.size = info.ModTime(), info.Size()
+			t.mu.Unlock()
+		}
+	}
+}
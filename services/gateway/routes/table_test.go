@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReloadKeepsRoutesOnError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer svc.Close()
+
+	table := func(routes string) string {
+		return "defaults:\n  upstream:\n    health_check: { interval: 0s }\n" +
+			"upstreams:\n  review: { url: " + svc.URL + " }\nroutes:\n" + routes
+	}
+	path := writeTable(t, table("  - { method: GET, path: /old, upstream: review }\n"))
+	tbl, err := NewTable(path, &Builder{Hooks: map[string]gin.HandlerFunc{}})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		tbl.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	if code := serve("/old"); code != http.StatusOK {
+		t.Fatalf("GET /old answered %d", code)
+	}
+
+	// A table that fails validation and one that fails to build both keep /old
+	for name, routes := range map[string]string{
+		"invalid":  "  - { method: GET, path: /new, upstream: business }\n",
+		"unbuilt":  "  - { method: GET, path: /new, upstream: review, hooks: [record_view] }\n",
+		"conflict": "  - { method: GET, path: /new/:id, upstream: review }\n  - { method: GET, path: /new/:name, upstream: review }\n",
+	} {
+		if err := os.WriteFile(path, []byte(table(routes)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := tbl.Reload(); err == nil {
+			t.Errorf("Reload accepted the %s table", name)
+		}
+		if code := serve("/old"); code != http.StatusOK {
+			t.Errorf("GET /old answered %d after the %s table was rejected, want 200", code, name)
+		}
+		if code := serve("/new"); code != http.StatusNotFound {
+			t.Errorf("GET /new answered %d after the %s table was rejected, want 404", code, name)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(table("  - { method: GET, path: /new, upstream: review }\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if code := serve("/new"); code != http.StatusOK {
+		t.Errorf("GET /new answered %d after reload, want 200", code)
+	}
+	if code := serve("/old"); code != http.StatusNotFound {
+		t.Errorf("GET /old answered %d after reload, want 404", code)
+	}
+}
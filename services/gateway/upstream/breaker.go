@@ -0,0 +1,165 @@
+package upstream
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Breaker states
+const (
+	// StateClosed lets every request through
+	StateClosed = "closed"
+	// StateOpen rejects requests until the cool-down has passed
+	StateOpen = "open"
+	// StateHalfOpen lets one probe request through to see whether the upstream recovered
+	StateHalfOpen = "half_open"
+)
+
+// Outcome is how a request to the upstream went, as far as the breaker is concerned
+type Outcome int
+
+const (
+	// Success closes a half-open breaker and resets the failure count
+	Success Outcome = iota
+	// Failure counts towards opening the breaker
+	Failure
+	// Ignored neither helps nor hurts, e.g. when the client went away
+	Ignored
+)
+
+// OpenError is returned instead of sending a request while a breaker is open
+type OpenError struct {
+	Upstream string
+	// RetryAfter is how long until the breaker lets a probe through
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open", e.Upstream)
+}
+
+// Breaker stops sending requests to an upstream for a while after too many consecutive
+// failures. Then a single probe decides whether it closes again or stays open.
+type Breaker struct {
+	name string
+
+	mu        sync.Mutex
+	threshold int
+	openFor   time.Duration
+	state     string
+	since     time.Time
+	// failed counts consecutive failures
+	failed   int
+	probing  bool
+	opened   int
+	rejected int64
+	lastErr  string
+}
+
+// newBreaker creates a closed breaker; a threshold of zero never opens it
+func newBreaker(name string, threshold int, openFor time.Duration) *Breaker {
+	return &Breaker{name: name, threshold: threshold, openFor: openFor, state: StateClosed, since: time.Now()}
+}
+
+// configure changes the thresholds, keeping the current state
+func (b *Breaker) configure(threshold int, openFor time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.threshold, b.openFor = threshold, openFor
+	if threshold <= 0 && b.state != StateClosed {
+		b.setState(StateClosed)
+	}
+}
+
+// Allow reports whether a request may be sent. Every allowed request must be reported
+// with the returned function exactly once.
+func (b *Breaker) Allow() (func(outcome Outcome, err error), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	probe := false
+	switch b.state {
+	case StateOpen:
+		if wait := b.since.Add(b.openFor).Sub(now); wait > 0 {
+			b.rejected++
+			return nil, &OpenError{Upstream: b.name, RetryAfter: wait}
+		}
+		b.setState(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.probing {
+			b.rejected++
+			return nil, &OpenError{Upstream: b.name, RetryAfter: time.Second}
+		}
+		b.probing = true
+		probe = true
+	}
+
+	return func(outcome Outcome, err error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if probe {
+			b.probing = false
+		}
+		if err != nil && outcome == Failure {
+			b.lastErr = err.Error()
+		}
+
+		switch outcome {
+		case Success:
+			b.failed = 0
+			if b.state != StateClosed {
+				b.setState(StateClosed)
+			}
+		case Failure:
+			b.failed++
+			if b.threshold <= 0 {
+				return
+			}
+			if probe || (b.state == StateClosed && b.failed >= b.threshold) {
+				b.setState(StateOpen)
+				b.opened++
+			}
+		}
+	}, nil
+}
+
+func (b *Breaker) setState(state string) {
+	b.state = state
+	b.since = time.Now()
+}
+
+// BreakerStatus is a snapshot of a breaker for the admin endpoint
+type BreakerStatus struct {
+	State string    `json:"state"`
+	Since time.Time `json:"since"`
+	// RetryAt is when an open breaker lets a probe through
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	FailureThreshold    int        `json:"failure_threshold"`
+	TimesOpened         int        `json:"times_opened"`
+	Rejected            int64      `json:"rejected"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+func (b *Breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		State:               b.state,
+		Since:               b.since,
+		ConsecutiveFailures: b.failed,
+		FailureThreshold:    b.threshold,
+		TimesOpened:         b.opened,
+		Rejected:            b.rejected,
+		LastError:           b.lastErr,
+	}
+	if b.state == StateOpen {
+		retryAt := b.since.Add(b.openFor)
+		status.RetryAt = &retryAt
+	}
+	return status
+}
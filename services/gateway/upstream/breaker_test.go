@@ -0,0 +1,95 @@
+package upstream
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// outcomes reports each outcome as one request through b
+func outcomes(t *testing.T, b *Breaker, results ...Outcome) {
+	t.Helper()
+	for _, outcome := range results {
+		report, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		report(outcome, errors.New("upstream answered 503 Service Unavailable"))
+	}
+}
+
+func wantState(t *testing.T, b *Breaker, want string) {
+	t.Helper()
+	if got := b.status().State; got != want {
+		t.Fatalf("breaker is %s, want %s", got, want)
+	}
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b := newBreaker("review", 3, time.Minute)
+
+	// A success ends a run of failures; an ignored request doesn't
+	outcomes(t, b, Failure, Failure, Success, Failure, Failure, Ignored)
+	wantState(t, b, StateClosed)
+	if got := b.status().ConsecutiveFailures; got != 2 {
+		t.Errorf("ConsecutiveFailures = %d, want 2", got)
+	}
+
+	outcomes(t, b, Failure)
+	wantState(t, b, StateOpen)
+
+	_, err := b.Allow()
+	var open *OpenError
+	if !errors.As(err, &open) || open.Upstream != "review" || open.RetryAfter <= 0 || open.RetryAfter > time.Minute {
+		t.Fatalf("Allow on an open breaker = %v, want an OpenError with the time left", err)
+	}
+	status := b.status()
+	if status.TimesOpened != 1 || status.Rejected != 1 || status.RetryAt == nil {
+		t.Errorf("status = %+v, want opened once, one rejection and a retry time", status)
+	}
+}
+
+func TestBreakerProbesAfterCoolDown(t *testing.T) {
+	tests := []struct {
+		probe Outcome
+		want  string
+	}{
+		{Success, StateClosed},
+		{Failure, StateOpen},
+	}
+	for _, tt := range tests {
+		b := newBreaker("review", 1, 20*time.Millisecond)
+		outcomes(t, b, Failure)
+		wantState(t, b, StateOpen)
+		time.Sleep(30 * time.Millisecond)
+
+		report, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow after the cool-down: %v", err)
+		}
+		wantState(t, b, StateHalfOpen)
+		// Only one probe is in flight at a time
+		if _, err := b.Allow(); err == nil {
+			t.Fatal("a half-open breaker let a second request through")
+		}
+
+		report(tt.probe, errors.New("upstream answered 503 Service Unavailable"))
+		wantState(t, b, tt.want)
+		if _, err := b.Allow(); (err == nil) != (tt.want == StateClosed) {
+			t.Errorf("Allow after a probe leaving the breaker %s: %v", tt.want, err)
+		}
+	}
+}
+
+func TestBreakerWithoutThresholdNeverOpens(t *testing.T) {
+	b := newBreaker("review", 0, time.Minute)
+	outcomes(t, b, Failure, Failure, Failure, Failure, Failure)
+	wantState(t, b, StateClosed)
+
+	// Disabling an open breaker closes it
+	b.configure(1, time.Minute)
+	outcomes(t, b, Failure)
+	wantState(t, b, StateOpen)
+	b.configure(0, time.Minute)
+	wantState(t, b, StateClosed)
+}
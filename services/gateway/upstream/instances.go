@@ -0,0 +1,412 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How requests are spread over an upstream's instances
+const (
+	// BalanceRoundRobin takes the healthy instances in turn
+	BalanceRoundRobin = "round_robin"
+	// BalanceLeastConnections picks the healthy instance with the fewest requests in
+	// flight, which suits long-lived streams
+	BalanceLeastConnections = "least_connections"
+)
+
+// Endpoints are where an upstream's requests go
+type Endpoints struct {
+	// Scheme is http or https
+	Scheme string
+	// Hosts are the instances as host:port; Discovery finds them instead when set
+	Hosts     []string
+	Discovery *Discovery
+	Balance   string
+	// HealthCheck probes every instance; a zero Interval disables it
+	HealthCheck HealthCheck
+}
+
+// Discovery finds instances in DNS, e.g. a Kubernetes headless service
+type Discovery struct {
+	// Name is looked up as A/AAAA records, or as SRV records when SRV is set
+	Name string
+	SRV  bool
+	// Port is used with A/AAAA records; SRV records carry their own
+	Port int
+	// Interval is how often the records are looked up again
+	Interval time.Duration
+}
+
+// HealthCheck marks an instance unhealthy after Unhealthy failed probes in a row and
+// healthy again after Healthy good ones. A probe requests every path and fails unless
+// all of them answer 2xx.
+type HealthCheck struct {
+	Paths     []string
+	Interval  time.Duration
+	Timeout   time.Duration
+	Unhealthy int
+	Healthy   int
+}
+
+// ErrNoInstances is returned when discovery has found no instances yet
+var ErrNoInstances = errors.New("no upstream instances")
+
+type instance struct {
+	host   string
+	active atomic.Int64
+
+	mu        sync.Mutex
+	healthy   bool
+	streak    int
+	lastError string
+	checked   time.Time
+}
+
+func (i *instance) isHealthy() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.healthy
+}
+
+// group is the current instances of one upstream, kept up to date by discovery and
+// health checks until it is stopped
+type group struct {
+	name      string
+	endpoints Endpoints
+	stop      context.CancelFunc
+	done      sync.WaitGroup
+
+	mu        sync.RWMutex
+	instances []*instance
+	next      atomic.Uint64
+}
+
+// newGroup starts keeping the instances of endpoints up to date. Instances already in
+// previous keep their health so a reload doesn't send traffic to ejected ones.
+func newGroup(name string, endpoints Endpoints, previous *group) *group {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &group{name: name, endpoints: endpoints, stop: cancel}
+
+	if previous != nil {
+		g.instances = previous.snapshot()
+	}
+	if endpoints.Discovery == nil {
+		g.setHosts(endpoints.Hosts)
+	} else {
+		g.done.Add(1)
+		go g.discover(ctx)
+	}
+
+	if endpoints.HealthCheck.Interval > 0 {
+		g.done.Add(1)
+		go g.check(ctx)
+	}
+	return g
+}
+
+// close stops discovery and health checks
+func (g *group) close() {
+	g.stop()
+	g.done.Wait()
+}
+
+func (g *group) snapshot() []*instance {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.instances
+}
+
+// setHosts replaces the instances, keeping the ones still listed
+func (g *group) setHosts(hosts []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	current := map[string]*instance{}
+	for _, inst := range g.instances {
+		current[inst.host] = inst
+	}
+
+	instances := make([]*instance, 0, len(hosts))
+	for _, host := range hosts {
+		inst, ok := current[host]
+		if !ok {
+			// New instances get traffic until a health check says otherwise
+			inst = &instance{host: host, healthy: true}
+		}
+		instances = append(instances, inst)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].host < instances[j].host })
+	g.instances = instances
+}
+
+// pick chooses an instance, avoiding the ones already tried for this request. If no
+// instance is healthy, all of them are tried rather than failing every request.
+func (g *group) pick(tried map[*instance]bool) (*instance, error) {
+	all := g.snapshot()
+	if len(all) == 0 {
+		return nil, ErrNoInstances
+	}
+
+	candidates := make([]*instance, 0, len(all))
+	for _, inst := range all {
+		if inst.isHealthy() && !tried[inst] {
+			candidates = append(candidates, inst)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, inst := range all {
+			if !tried[inst] {
+				candidates = append(candidates, inst)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		// Every instance was tried; start over
+		candidates = all
+	}
+
+	start := int(g.next.Add(1) % uint64(len(candidates)))
+	if g.endpoints.Balance != BalanceLeastConnections {
+		return candidates[start], nil
+	}
+	best := candidates[start]
+	for n := 1; n < len(candidates); n++ {
+		inst := candidates[(start+n)%len(candidates)]
+		if inst.active.Load() < best.active.Load() {
+			best = inst
+		}
+	}
+	return best, nil
+}
+
+// discover looks up the instances until ctx is done. A failed lookup keeps the
+// instances found before.
+func (g *group) discover(ctx context.Context) {
+	defer g.done.Done()
+
+	d := g.endpoints.Discovery
+	for {
+		hosts, err := lookup(ctx, d)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				slog.Warn("Discovering instances failed", "upstream", g.name, "discovery", d.Name, "error", err)
+			}
+		case len(hosts) == 0:
+			slog.Warn("Discovering instances found none", "upstream", g.name, "discovery", d.Name)
+		default:
+			g.setHosts(hosts)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.Interval):
+		}
+	}
+}
+
+func lookup(ctx context.Context, d *Discovery) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var hosts []string
+	if d.SRV {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", d.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range records {
+			hosts = append(hosts, net.JoinHostPort(trimDot(srv.Target), strconv.Itoa(int(srv.Port))))
+		}
+		return hosts, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, d.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		hosts = append(hosts, net.JoinHostPort(addr, strconv.Itoa(d.Port)))
+	}
+	return hosts, nil
+}
+
+func trimDot(name string) string {
+	if len(name) > 0 && name[len(name)-1] == '.' {
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// check probes every instance each interval until ctx is done
+func (g *group) check(ctx context.Context) {
+	defer g.done.Done()
+
+	hc := g.endpoints.HealthCheck
+	transport := newTransport(Settings{ConnectTimeout: hc.Timeout})
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: hc.Timeout}
+
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for _, inst := range g.snapshot() {
+			wg.Add(1)
+			go func(inst *instance) {
+				defer wg.Done()
+				g.record(inst, g.probe(ctx, client, inst))
+			}(inst)
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *group) probe(ctx context.Context, client *http.Client, inst *instance) error {
+	for _, path := range g.endpoints.HealthCheck.Paths {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.endpoints.Scheme+"://"+inst.host+path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return errors.New(path + " answered " + resp.Status)
+		}
+	}
+	return nil
+}
+
+// record counts a probe towards ejecting or restoring the instance
+func (g *group) record(inst *instance, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	hc := g.endpoints.HealthCheck
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	inst.checked = time.Now()
+
+	inst.lastError = ""
+	if err != nil {
+		inst.lastError = err.Error()
+	}
+	if (err == nil) == inst.healthy {
+		inst.streak = 0
+		return
+	}
+	inst.streak++
+	if inst.healthy && inst.streak >= hc.Unhealthy {
+		inst.healthy, inst.streak = false, 0
+		slog.Warn("Ejecting instance", "upstream", g.name, "instance", inst.host, "error", err)
+	} else if !inst.healthy && inst.streak >= hc.Healthy {
+		inst.healthy, inst.streak = true, 0
+		slog.Info("Instance recovered", "upstream", g.name, "instance", inst.host)
+	}
+}
+
+// reachable returns nil if an instance is healthy. Without health checks it connects
+// to the instances instead, and without either the last error is returned.
+func (g *group) reachable(ctx context.Context) error {
+	instances := g.snapshot()
+	if len(instances) == 0 {
+		return ErrNoInstances
+	}
+
+	var err error
+	if g.endpoints.HealthCheck.Interval > 0 {
+		for _, inst := range instances {
+			inst.mu.Lock()
+			healthy, lastError := inst.healthy, inst.lastError
+			inst.mu.Unlock()
+			if healthy {
+				return nil
+			}
+			err = fmt.Errorf("%s unhealthy: %s", inst.host, lastError)
+		}
+		return err
+	}
+
+	var dialer net.Dialer
+	for _, inst := range instances {
+		host := inst.host
+		if _, _, splitErr := net.SplitHostPort(host); splitErr != nil {
+			host = net.JoinHostPort(host, g.endpoints.Scheme)
+		}
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", host); err == nil {
+			conn.Close()
+			return nil
+		}
+	}
+	return err
+}
+
+// InstanceStatus is a snapshot of an instance for the admin endpoint
+type InstanceStatus struct {
+	Host        string     `json:"host"`
+	Healthy     bool       `json:"healthy"`
+	Active      int64      `json:"active"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+func (g *group) status() []InstanceStatus {
+	instances := g.snapshot()
+	statuses := make([]InstanceStatus, 0, len(instances))
+	for _, inst := range instances {
+		inst.mu.Lock()
+		status := InstanceStatus{
+			Host:      inst.host,
+			Healthy:   inst.healthy,
+			Active:    inst.active.Load(),
+			LastError: inst.lastError,
+		}
+		if !inst.checked.IsZero() {
+			checked := inst.checked
+			status.LastChecked = &checked
+		}
+		inst.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func sameEndpoints(a, b Endpoints) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// trackedBody ends an instance's active request when the response body is closed
+type trackedBody struct {
+	io.ReadCloser
+	once sync.Once
+	inst *instance
+}
+
+func (b *trackedBody) Close() error {
+	b.once.Do(func() { b.inst.active.Add(-1) })
+	return b.ReadCloser.Close()
+}
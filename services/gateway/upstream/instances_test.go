@@ -0,0 +1,169 @@
+package upstream
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestGroup(balance string, hosts ...string) *group {
+	g := &group{name: "review", endpoints: Endpoints{
+		Balance:     balance,
+		HealthCheck: HealthCheck{Unhealthy: 2, Healthy: 2},
+	}}
+	g.setHosts(hosts)
+	return g
+}
+
+func (g *group) instance(host string) *instance {
+	for _, inst := range g.snapshot() {
+		if inst.host == host {
+			return inst
+		}
+	}
+	return nil
+}
+
+// picks returns how often each host is picked in n requests
+func picks(t *testing.T, g *group, tried map[*instance]bool, n int) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		inst, err := g.pick(tried)
+		if err != nil {
+			t.Fatalf("pick: %v", err)
+		}
+		counts[inst.host]++
+	}
+	return counts
+}
+
+func TestPickRoundRobin(t *testing.T) {
+	g := newTestGroup(BalanceRoundRobin, "review-1:8082", "review-2:8082", "review-3:8082")
+	got := picks(t, g, nil, 30)
+	for _, host := range []string{"review-1:8082", "review-2:8082", "review-3:8082"} {
+		if got[host] != 10 {
+			t.Errorf("%s picked %d times out of 30, want 10", host, got[host])
+		}
+	}
+}
+
+func TestPickEjectsUnhealthyInstances(t *testing.T) {
+	g := newTestGroup(BalanceRoundRobin, "review-1:8082", "review-2:8082")
+	sick := g.instance("review-1:8082")
+	probeErr := errors.New("/ready answered 503 Service Unavailable")
+
+	// One failed probe is not enough
+	g.record(sick, probeErr)
+	if got := picks(t, g, nil, 10); got["review-1:8082"] == 0 {
+		t.Fatal("instance was ejected after a single failed probe")
+	}
+
+	g.record(sick, probeErr)
+	if got := picks(t, g, nil, 10); got["review-1:8082"] != 0 {
+		t.Fatalf("ejected instance was picked %d times", got["review-1:8082"])
+	}
+
+	// It needs two good probes in a row to come back
+	g.record(sick, nil)
+	g.record(sick, probeErr)
+	g.record(sick, nil)
+	if got := picks(t, g, nil, 10); got["review-1:8082"] != 0 {
+		t.Fatal("instance was restored without two good probes in a row")
+	}
+	g.record(sick, nil)
+	if got := picks(t, g, nil, 10); got["review-1:8082"] != 5 {
+		t.Errorf("restored instance was picked %d times out of 10, want 5", got["review-1:8082"])
+	}
+}
+
+func TestPickFallsBack(t *testing.T) {
+	g := newTestGroup(BalanceRoundRobin, "review-1:8082", "review-2:8082")
+	first, second := g.instance("review-1:8082"), g.instance("review-2:8082")
+
+	// A retry avoids the instance already tried
+	if got := picks(t, g, map[*instance]bool{first: true}, 10); got["review-2:8082"] != 10 {
+		t.Errorf("retries went to %v, want only review-2:8082", got)
+	}
+
+	// An ejected instance is still better than none
+	for _, inst := range []*instance{first, second} {
+		inst.healthy = false
+	}
+	if got := picks(t, g, nil, 10); got["review-1:8082"] != 5 || got["review-2:8082"] != 5 {
+		t.Errorf("with every instance ejected picks were %v, want both in turn", got)
+	}
+	if got := picks(t, g, map[*instance]bool{second: true}, 10); got["review-1:8082"] != 10 {
+		t.Errorf("retries with every instance ejected went to %v, want the untried one", got)
+	}
+
+	// Once every instance was tried, any of them may be tried again
+	if got := picks(t, g, map[*instance]bool{first: true, second: true}, 10); got["review-1:8082"]+got["review-2:8082"] != 10 {
+		t.Errorf("picks after trying every instance were %v", got)
+	}
+
+	if _, err := newTestGroup(BalanceRoundRobin).pick(nil); !errors.Is(err, ErrNoInstances) {
+		t.Errorf("pick without instances = %v, want ErrNoInstances", err)
+	}
+}
+
+func TestPickLeastConnections(t *testing.T) {
+	g := newTestGroup(BalanceLeastConnections, "review-1:8082", "review-2:8082", "review-3:8082")
+	g.instance("review-1:8082").active.Store(3)
+	g.instance("review-2:8082").active.Store(1)
+	g.instance("review-3:8082").active.Store(2)
+
+	if got := picks(t, g, nil, 10); got["review-2:8082"] != 10 {
+		t.Errorf("picks were %v, want only the instance with the fewest requests", got)
+	}
+	// The least busy instance is skipped once it was tried
+	tried := map[*instance]bool{g.instance("review-2:8082"): true}
+	if got := picks(t, g, tried, 10); got["review-3:8082"] != 10 {
+		t.Errorf("retries went to %v, want review-3:8082", got)
+	}
+}
+
+func TestHealthCheckEjectsFailingInstance(t *testing.T) {
+	var ready atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" && !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	g := newGroup("review", Endpoints{
+		Scheme: "http",
+		Hosts:  []string{target.Host},
+		HealthCheck: HealthCheck{
+			Paths:     []string{"/health", "/ready"},
+			Interval:  5 * time.Millisecond,
+			Timeout:   time.Second,
+			Unhealthy: 2,
+			Healthy:   2,
+		},
+	}, nil)
+	defer g.close()
+
+	waitHealthy := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for g.instance(target.Host).isHealthy() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("instance never became healthy=%v", want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitHealthy(false)
+	if status := g.status(); status[0].LastError == "" || status[0].LastChecked == nil {
+		t.Errorf("status of ejected instance = %+v, want its last error", status[0])
+	}
+	ready.Store(true)
+	waitHealthy(true)
+}
@@ -0,0 +1,354 @@
+// Package upstream sends proxied requests to the backing services: balanced over their
+// healthy instances, with connect and response timeouts, bounded retries and a circuit
+// breaker per service.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yelp-sample-v2/shared/tracing"
+)
+
+// Settings are how requests to one upstream are sent
+type Settings struct {
+	// ConnectTimeout bounds dialing the upstream
+	ConnectTimeout time.Duration
+	// ResponseTimeout bounds waiting for response headers on each attempt; zero leaves
+	// it to the request's own deadline
+	ResponseTimeout time.Duration
+	// Retries is how many times a failed idempotent request is sent again
+	Retries int
+	// RetryBackoff is the base delay before a retry; it doubles per attempt, with jitter
+	RetryBackoff time.Duration
+	// FailureThreshold consecutive failures open the breaker; zero disables it
+	FailureThreshold int
+	// OpenFor is how long an open breaker rejects requests before probing
+	OpenFor time.Duration
+	// Endpoints are the service's instances
+	Endpoints Endpoints
+}
+
+// maxBackoff caps the delay between retries
+const maxBackoff = 2 * time.Second
+
+// Upstream is an http.RoundTripper for one service. Its breaker and connections
+// outlive reloads of the route table.
+type Upstream struct {
+	name    string
+	breaker *Breaker
+	current atomic.Pointer[config]
+
+	requests atomic.Int64
+	retries  atomic.Int64
+	failures atomic.Int64
+}
+
+type config struct {
+	settings  Settings
+	transport *http.Transport
+	// client sends each attempt over transport as a span of the request's trace
+	client    http.RoundTripper
+	instances *group
+}
+
+// Pool keeps an Upstream per service name
+type Pool struct {
+	mu        sync.Mutex
+	upstreams map[string]*Upstream
+}
+
+func NewPool() *Pool {
+	return &Pool{upstreams: map[string]*Upstream{}}
+}
+
+// Get returns the upstream called name. It can't be used until Configure has given it
+// settings.
+func (p *Pool) Get(name string) *Upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	u, ok := p.upstreams[name]
+	if !ok {
+		u = &Upstream{name: name, breaker: newBreaker(name, 0, 0)}
+		p.upstreams[name] = u
+	}
+	return u
+}
+
+// Configure applies the settings of every upstream in the route table and forgets the
+// rest. Breaker state is kept; connections are replaced only when the timeouts change.
+func (p *Pool) Configure(settings map[string]Settings) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for name, u := range p.upstreams {
+		if _, ok := settings[name]; !ok {
+			if cfg := u.current.Load(); cfg != nil {
+				cfg.transport.CloseIdleConnections()
+				go cfg.instances.close()
+			}
+			delete(p.upstreams, name)
+		}
+	}
+
+	for name, s := range settings {
+		u, ok := p.upstreams[name]
+		if !ok {
+			u = &Upstream{name: name, breaker: newBreaker(name, 0, 0)}
+			p.upstreams[name] = u
+		}
+		u.breaker.configure(s.FailureThreshold, s.OpenFor)
+
+		old := u.current.Load()
+		var transport *http.Transport
+		if old != nil && old.settings.ConnectTimeout == s.ConnectTimeout &&
+			old.settings.ResponseTimeout == s.ResponseTimeout {
+			transport = old.transport
+		} else {
+			transport = newTransport(s)
+			if old != nil {
+				// Requests still using them finish first; only idle connections are closed
+				old.transport.CloseIdleConnections()
+			}
+		}
+
+		var instances *group
+		if old != nil && sameEndpoints(old.settings.Endpoints, s.Endpoints) {
+			instances = old.instances
+		} else {
+			var previous *group
+			if old != nil {
+				previous = old.instances
+				// Probes in flight may take a moment to give up
+				go previous.close()
+			}
+			instances = newGroup(name, s.Endpoints, previous)
+		}
+		u.current.Store(&config{
+			settings:  s,
+			transport: transport,
+			client:    tracing.NewTransport(name, transport),
+			instances: instances,
+		})
+	}
+}
+
+// Close stops discovery and health checks
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, u := range p.upstreams {
+		if cfg := u.current.Load(); cfg != nil {
+			cfg.instances.close()
+			cfg.transport.CloseIdleConnections()
+		}
+	}
+}
+
+// Status is a snapshot of an upstream for the admin endpoint
+type Status struct {
+	Name      string           `json:"name"`
+	Balance   string           `json:"balance,omitempty"`
+	Instances []InstanceStatus `json:"instances"`
+	Breaker   BreakerStatus    `json:"breaker"`
+	Requests  int64            `json:"requests"`
+	Retries   int64            `json:"retries"`
+	Failures  int64            `json:"failures"`
+}
+
+// Status reports every upstream, sorted by name
+func (p *Pool) Status() []Status {
+	p.mu.Lock()
+	upstreams := make([]*Upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		upstreams = append(upstreams, u)
+	}
+	p.mu.Unlock()
+
+	statuses := make([]Status, 0, len(upstreams))
+	for _, u := range upstreams {
+		status := Status{
+			Name:      u.name,
+			Instances: []InstanceStatus{},
+			Breaker:   u.breaker.status(),
+			Requests:  u.requests.Load(),
+			Retries:   u.retries.Load(),
+			Failures:  u.failures.Load(),
+		}
+		if cfg := u.current.Load(); cfg != nil {
+			status.Balance = cfg.settings.Endpoints.Balance
+			status.Instances = cfg.instances.status()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Reachable reports for every upstream whether it can take requests: its breaker isn't
+// open and an instance is healthy, or accepts connections when health checks are off
+func (p *Pool) Reachable(ctx context.Context) map[string]error {
+	p.mu.Lock()
+	upstreams := make([]*Upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		upstreams = append(upstreams, u)
+	}
+	p.mu.Unlock()
+
+	errs := make(map[string]error, len(upstreams))
+	for _, u := range upstreams {
+		cfg := u.current.Load()
+		switch {
+		case cfg == nil:
+			errs[u.name] = ErrNoInstances
+		case u.breaker.status().State == StateOpen:
+			errs[u.name] = &OpenError{Upstream: u.name}
+		default:
+			errs[u.name] = cfg.instances.reachable(ctx)
+		}
+	}
+	return errs
+}
+
+func newTransport(settings Settings) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: settings.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.ResponseHeaderTimeout = settings.ResponseTimeout
+	// Every request from the gateway goes to a handful of hosts
+	transport.MaxIdleConnsPerHost = 32
+	return transport
+}
+
+// RoundTrip sends the request to one of the instances, retrying idempotent requests
+// that failed to connect, timed out or were answered with 502, 503 or 504 on another
+func (u *Upstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	cfg := u.current.Load()
+	u.requests.Add(1)
+
+	retries := cfg.settings.Retries
+	if !idempotent(req) {
+		retries = 0
+	}
+
+	tried := map[*instance]bool{}
+	for attempt := 0; ; attempt++ {
+		report, err := u.breaker.Allow()
+		if err != nil {
+			return nil, err
+		}
+		inst, err := cfg.instances.pick(tried)
+		if err != nil {
+			report(Ignored, nil)
+			return nil, err
+		}
+		tried[inst] = true
+
+		resp, err := u.send(cfg, inst, req)
+		outcome, reason := classify(req, resp, err)
+		if outcome == Failure {
+			u.failures.Add(1)
+		}
+		report(outcome, reason)
+
+		if outcome != Failure || attempt >= retries {
+			return resp, err
+		}
+		delay := backoff(cfg.settings.RetryBackoff, attempt)
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < delay {
+			// There is no time left for another attempt
+			return resp, err
+		}
+		if resp != nil {
+			// Drain a little so the connection can be reused
+			io.CopyN(io.Discard, resp.Body, 4<<10)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		u.retries.Add(1)
+	}
+}
+
+// send sends one attempt to inst, counting it as active until the response is done
+func (u *Upstream) send(cfg *config, inst *instance, req *http.Request) (*http.Response, error) {
+	out := *req
+	target := *req.URL
+	target.Scheme = cfg.settings.Endpoints.Scheme
+	target.Host = inst.host
+	out.URL = &target
+
+	inst.active.Add(1)
+	resp, err := cfg.client.RoundTrip(&out)
+	if err != nil {
+		inst.active.Add(-1)
+		return nil, err
+	}
+	resp.Body = &trackedBody{ReadCloser: resp.Body, inst: inst}
+	return resp, nil
+}
+
+// idempotent reports whether the request may safely be sent more than once. Bodies
+// the gateway can't replay are never retried.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// classify decides what an attempt means for the breaker, and why it failed
+func classify(req *http.Request, resp *http.Response, err error) (Outcome, error) {
+	if err != nil {
+		if errors.Is(req.Context().Err(), context.Canceled) {
+			// The client went away; that says nothing about the upstream
+			return Ignored, nil
+		}
+		return Failure, err
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return Failure, errors.New("upstream answered " + resp.Status)
+	}
+	return Success, nil
+}
+
+// backoff is the delay before retry attempt+1: exponential with full jitter, so
+// gateways retrying at once don't hit a recovering upstream together
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	ceiling := base << attempt
+	if ceiling > maxBackoff || ceiling <= 0 {
+		ceiling = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
@@ -0,0 +1,173 @@
+package upstream
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestUpstream sends requests to the servers with the given settings
+func newTestUpstream(t *testing.T, s Settings, servers ...*httptest.Server) *Upstream {
+	t.Helper()
+	s.Endpoints.Scheme = "http"
+	for _, srv := range servers {
+		u, err := url.Parse(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Endpoints.Hosts = append(s.Endpoints.Hosts, u.Host)
+	}
+	pool := NewPool()
+	pool.Configure(map[string]Settings{"review": s})
+	t.Cleanup(pool.Close)
+	return pool.Get("review")
+}
+
+// countingServer answers every request with status and counts the requests and the
+// bodies it received
+type countingServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	hits   int
+	bodies []string
+}
+
+func newCountingServer(status int) *countingServer {
+	s := &countingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.hits++
+		s.bodies = append(s.bodies, string(body))
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *countingServer) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hits, s.bodies = 0, nil
+}
+
+func TestRoundTripRetriesIdempotentRequestsOnly(t *testing.T) {
+	srv := newCountingServer(http.StatusServiceUnavailable)
+	defer srv.Close()
+	u := newTestUpstream(t, Settings{Retries: 2}, srv.Server)
+
+	tests := []struct {
+		name     string
+		method   string
+		body     io.Reader
+		wantHits int
+	}{
+		{"GET", http.MethodGet, nil, 3},
+		{"DELETE", http.MethodDelete, nil, 3},
+		{"PUT with a replayable body", http.MethodPut, strings.NewReader(`{"rating":5}`), 3},
+		{"PUT with a body that can't be replayed", http.MethodPut, io.NopCloser(strings.NewReader(`{"rating":5}`)), 1},
+		{"POST", http.MethodPost, strings.NewReader(`{"rating":5}`), 1},
+		{"PATCH", http.MethodPatch, strings.NewReader(`{"rating":5}`), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.reset()
+			req, err := http.NewRequest(tt.method, "http://review/reviews/1", tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := u.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want the upstream's 503", resp.StatusCode)
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if srv.hits != tt.wantHits {
+				t.Errorf("upstream got %d attempts, want %d", srv.hits, tt.wantHits)
+			}
+			if tt.body != nil {
+				for i, body := range srv.bodies {
+					if body != `{"rating":5}` {
+						t.Errorf("attempt %d sent body %q", i+1, body)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTripRetriesOnlyUpstreamFailures(t *testing.T) {
+	srv := newCountingServer(http.StatusInternalServerError)
+	defer srv.Close()
+	u := newTestUpstream(t, Settings{Retries: 2}, srv.Server)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://review/reviews/1", nil)
+	resp, err := u.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	// A 500 is the service's answer, not a sign that it is unavailable
+	if srv.hits != 1 {
+		t.Errorf("upstream got %d attempts for a 500, want 1", srv.hits)
+	}
+}
+
+func TestRoundTripRetriesOnAnotherInstance(t *testing.T) {
+	down := newCountingServer(http.StatusBadGateway)
+	defer down.Close()
+	up := newCountingServer(http.StatusOK)
+	defer up.Close()
+	u := newTestUpstream(t, Settings{Retries: 1}, down.Server, up.Server)
+
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://review/reviews/1", nil)
+		resp, err := u.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("request %d answered %d, want 200 from the other instance", i+1, resp.StatusCode)
+		}
+	}
+	if up.hits != 4 {
+		t.Errorf("healthy instance got %d requests, want 4", up.hits)
+	}
+}
+
+func TestRoundTripStopsAtOpenBreaker(t *testing.T) {
+	srv := newCountingServer(http.StatusServiceUnavailable)
+	defer srv.Close()
+	u := newTestUpstream(t, Settings{FailureThreshold: 2, OpenFor: time.Minute}, srv.Server)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://review/reviews/1", nil)
+		resp, err := u.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://review/reviews/1", nil)
+	_, err := u.RoundTrip(req)
+	var open *OpenError
+	if !errors.As(err, &open) {
+		t.Fatalf("RoundTrip after 2 failures = %v, want an OpenError", err)
+	}
+	if srv.hits != 2 {
+		t.Errorf("upstream got %d requests, want none once the breaker opened", srv.hits)
+	}
+}
@@ -0,0 +1,135 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Mode is how client IPs are anonymized before they are stored
+type Mode string
+
+const (
+	// ModeTruncate zeroes the host part: IPv4 to /24, IPv6 to /48
+	ModeTruncate Mode = "truncate"
+	// ModeHash replaces the IP with a keyed hash whose salt rotates
+	ModeHash Mode = "hash"
+	// ModeNone stores the IP as received
+	ModeNone Mode = "none"
+)
+
+type Config struct {
+	Mode Mode
+	// SaltRotation is how long a hash salt is used. The same IP hashes to the same value
+	// within a period, so visits can be correlated for a day but not across days.
+	SaltRotation time.Duration
+	// Secret, when set, derives each period's salt so every replica hashes alike.
+	// Without it salts are random and live only in memory.
+	Secret string
+}
+
+// ConfigFromEnv reads IP_ANONYMIZATION, IP_SALT_ROTATION and IP_HASH_SECRET
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Mode:         ModeTruncate,
+		SaltRotation: 24 * time.Hour,
+		Secret:       os.Getenv("IP_HASH_SECRET"),
+	}
+	switch mode := Mode(os.Getenv("IP_ANONYMIZATION")); mode {
+	case ModeTruncate, ModeHash, ModeNone:
+		cfg.Mode = mode
+	case "":
+	default:
+		slog.Warn("Unknown IP_ANONYMIZATION, truncating IPs", "ip_anonymization", mode)
+	}
+	if d, err := time.ParseDuration(os.Getenv("IP_SALT_ROTATION")); err == nil && d > 0 {
+		cfg.SaltRotation = d
+	}
+	return cfg
+}
+
+type Anonymizer struct {
+	cfg Config
+
+	mu         sync.Mutex
+	period     int64
+	salt       []byte
+	saltSource func(period int64) []byte
+}
+
+// Default is the anonymizer applied at log ingestion
+var Default = New(Config{Mode: ModeTruncate, SaltRotation: 24 * time.Hour})
+
+func New(cfg Config) *Anonymizer {
+	a := &Anonymizer{cfg: cfg, period: -1}
+	if cfg.Secret != "" {
+		a.saltSource = a.derivedSalt
+	} else {
+		a.saltSource = randomSalt
+	}
+	return a
+}
+
+// IP anonymizes a client IP using the default anonymizer
+func IP(raw string) string {
+	return Default.IP(raw)
+}
+
+// IP anonymizes a client IP. Values that are not IPs are dropped.
+func (a *Anonymizer) IP(raw string) string {
+	if raw == "" || a.cfg.Mode == ModeNone {
+		return raw
+	}
+
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return ""
+	}
+
+	if a.cfg.Mode == ModeHash {
+		mac := hmac.New(sha256.New, a.currentSalt(time.Now()))
+		mac.Write([]byte(ip.String()))
+		return hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// currentSalt returns the salt for the rotation period containing now.
+// Old salts are discarded so hashes from earlier periods can't be recomputed.
+func (a *Anonymizer) currentSalt(now time.Time) []byte {
+	period := now.UnixNano() / int64(a.cfg.SaltRotation)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if period != a.period {
+		a.period = period
+		a.salt = a.saltSource(period)
+	}
+	return a.salt
+}
+
+func (a *Anonymizer) derivedSalt(period int64) []byte {
+	mac := hmac.New(sha256.New, []byte(a.cfg.Secret))
+	binary.Write(mac, binary.BigEndian, period)
+	return mac.Sum(nil)
+}
+
+func randomSalt(int64) []byte {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		slog.Error("Failed to generate IP hash salt", "error", err)
+	}
+	return salt
+}
@@ -0,0 +1,107 @@
+package anonymize
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTruncate(t *testing.T) {
+	a := New(Config{Mode: ModeTruncate})
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.77", "203.0.113.0"},
+		{"::ffff:203.0.113.77", "203.0.113.0"},
+		{"2001:db8:1234:5678:9abc::1", "2001:db8:1234::"},
+		{"", ""},
+		{"not-an-ip", ""},
+		{"203.0.113.77:51234", ""},
+	}
+	for _, tt := range tests {
+		if got := a.IP(tt.ip); got != tt.want {
+			t.Errorf("IP(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestNone(t *testing.T) {
+	a := New(Config{Mode: ModeNone})
+	if got := a.IP("203.0.113.77"); got != "203.0.113.77" {
+		t.Errorf("IP = %q, want it unchanged", got)
+	}
+}
+
+func TestHash(t *testing.T) {
+	a := New(Config{Mode: ModeHash, SaltRotation: 24 * time.Hour, Secret: "secret"})
+	first := a.IP("203.0.113.77")
+	if len(first) != 16 || first == "203.0.113.77" {
+		t.Fatalf("IP = %q, want a 16 character hash", first)
+	}
+	if got := a.IP("203.0.113.77"); got != first {
+		t.Errorf("the same IP hashed to %q and %q within a period", first, got)
+	}
+	if got := a.IP("203.0.113.78"); got == first {
+		t.Errorf("different IPs hashed alike")
+	}
+	// Equal IPs written differently are one visitor
+	if got := a.IP("::ffff:203.0.113.77"); got != first {
+		t.Errorf("IPv4-mapped form hashed to %q, want %q", got, first)
+	}
+	if got := a.IP("bogus"); got != "" {
+		t.Errorf("IP(bogus) = %q, want it dropped", got)
+	}
+
+	// Replicas sharing the secret hash alike
+	if got := New(Config{Mode: ModeHash, SaltRotation: 24 * time.Hour, Secret: "secret"}).IP("203.0.113.77"); got != first {
+		t.Errorf("another anonymizer with the same secret hashed to %q, want %q", got, first)
+	}
+	if got := New(Config{Mode: ModeHash, SaltRotation: 24 * time.Hour, Secret: "other"}).IP("203.0.113.77"); got == first {
+		t.Errorf("anonymizers with different secrets hashed alike")
+	}
+}
+
+func TestSaltRotates(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for name, cfg := range map[string]Config{
+		"derived": {Mode: ModeHash, SaltRotation: 24 * time.Hour, Secret: "secret"},
+		"random":  {Mode: ModeHash, SaltRotation: 24 * time.Hour},
+	} {
+		a := New(cfg)
+		today := append([]byte(nil), a.currentSalt(now)...)
+		if later := a.currentSalt(now.Add(time.Hour)); !bytes.Equal(later, today) {
+			t.Errorf("%s: salt changed within a period", name)
+		}
+		if tomorrow := a.currentSalt(now.Add(24 * time.Hour)); bytes.Equal(tomorrow, today) {
+			t.Errorf("%s: salt didn't change in the next period", name)
+		}
+	}
+
+	// Without a secret every anonymizer has its own salt
+	random := Config{Mode: ModeHash, SaltRotation: 24 * time.Hour}
+	if bytes.Equal(New(random).currentSalt(now), New(random).currentSalt(now)) {
+		t.Error("random salts of two anonymizers are equal")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		mode     string
+		rotation string
+		want     Config
+	}{
+		{"", "", Config{Mode: ModeTruncate, SaltRotation: 24 * time.Hour}},
+		{"hash", "1h", Config{Mode: ModeHash, SaltRotation: time.Hour}},
+		{"none", "-1h", Config{Mode: ModeNone, SaltRotation: 24 * time.Hour}},
+		{"scramble", "often", Config{Mode: ModeTruncate, SaltRotation: 24 * time.Hour}},
+	}
+	for _, tt := range tests {
+		t.Setenv("IP_ANONYMIZATION", tt.mode)
+		t.Setenv("IP_SALT_ROTATION", tt.rotation)
+		t.Setenv("IP_HASH_SECRET", "")
+		if got := ConfigFromEnv(); got != tt.want {
+			t.Errorf("ConfigFromEnv with IP_ANONYMIZATION=%q IP_SALT_ROTATION=%q = %+v, want %+v", tt.mode, tt.rotation, got, tt.want)
+		}
+	}
+}
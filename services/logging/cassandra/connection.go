@@ -1,17 +1,27 @@
 package cassandra
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gocql/gocql"
 	"github.com/scylladb/gocqlx/v2"
+	"github.com/yelp-sample-v2/shared/metrics/cqlmetrics"
+	"github.com/yelp-sample-v2/shared/tracing/cqltrace"
 )
 
 var Session gocqlx.Session
 
+// EventCountsSince is the first hour fully counted in business_hourly_event_counts.
+// Earlier hours are counted from the event rows.
+var EventCountsSince time.Time
+
 func Connect() error {
 	hosts := os.Getenv("CASSANDRA_HOSTS")
 	if hosts == "" {
@@ -36,6 +46,9 @@ func Connect() error {
 	//- 失敗時の再試行回数: 3回
 	//- ネットワークエラーや一時的な障害に対応
 	cluster.RetryPolicy = &gocql.SimpleRetryPolicy{NumRetries: 3}
+	//- すべてのクエリのレイテンシをメトリクスとして記録
+	//- リクエストのコンテキストで実行したクエリはトレースのスパンとしても記録
+	cluster.QueryObserver = cqlmetrics.Observer{Next: cqltrace.Observer{}}
 
 	session, err := gocqlx.WrapSession(cluster.CreateSession())
 	if err != nil {
@@ -43,19 +56,26 @@ func Connect() error {
 	}
 
 	Session = session
-	log.Println("Connected to Cassandra successfully")
+	slog.Info("Connected to Cassandra")
 	return nil
 }
 
 func Close() {
 	if Session.Session != nil {
 		Session.Close()
-		log.Println("Cassandra connection closed")
+		slog.Info("Cassandra connection closed")
 	}
 }
 
+// Ping checks that Cassandra answers a query, for the readiness probe. It reads the
+// local node's system table, so it needs no replicas and no keyspace.
+func Ping(ctx context.Context) error {
+	return Session.Session.Query(`SELECT now() FROM system.local`).
+		WithContext(ctx).Consistency(gocql.One).Exec()
+}
+
 func AutoMigrate() error {
-	log.Println("Running Cassandra migrations...")
+	slog.Info("Running Cassandra migrations")
 
 	// Create keyspace
 	//replication_factor: 1
@@ -89,6 +109,128 @@ func AutoMigrate() error {
 		return fmt.Errorf("failed to create review_view_logs table: %w", err)
 	}
 
+	// Create business-partitioned view statistics tables
+	//- review_view_logsはuser_idでパーティション分割されているため、ビジネス単位の集計用に日次バケットのテーブルを用意する
+	createBusinessDailyViewCounts := `
+		CREATE TABLE IF NOT EXISTS yelp_logs.business_daily_view_counts (
+			business_id INT,
+			view_date DATE,
+			views COUNTER,
+			PRIMARY KEY (business_id, view_date)
+		) WITH CLUSTERING ORDER BY (view_date DESC)
+	`
+
+	if err := Session.ExecStmt(createBusinessDailyViewCounts); err != nil {
+		return fmt.Errorf("failed to create business_daily_view_counts table: %w", err)
+	}
+
+	createBusinessDailyReviewViewCounts := `
+		CREATE TABLE IF NOT EXISTS yelp_logs.business_daily_review_view_counts (
+			business_id INT,
+			view_date DATE,
+			review_id INT,
+			views COUNTER,
+			PRIMARY KEY ((business_id, view_date), review_id)
+		)
+	`
+
+	if err := Session.ExecStmt(createBusinessDailyReviewViewCounts); err != nil {
+		return fmt.Errorf("failed to create business_daily_review_view_counts table: %w", err)
+	}
+
+	createBusinessDailyViewers := `
+		CREATE TABLE IF NOT EXISTS yelp_logs.business_daily_viewers (
+			business_id INT,
+			view_date DATE,
+			user_id INT,
+			PRIMARY KEY ((business_id, view_date), user_id)
+		)
+	`
+
+	if err := Session.ExecStmt(createBusinessDailyViewers); err != nil {
+		return fmt.Errorf("failed to create business_daily_viewers table: %w", err)
+	}
+
+	// Create checkin_logs table (with keyspace prefix)
+	createCheckinTable := `
+		CREATE TABLE IF NOT EXISTS yelp_logs.checkin_logs (
+			user_id INT,
+			business_id INT,
+			checkin_id INT,
+			checked_in_at TIMESTAMP,
+			distance_meters DOUBLE,
+			ip_address TEXT,
+			user_agent TEXT,
+			PRIMARY KEY (user_id, checked_in_at, business_id)
+		) WITH CLUSTERING ORDER BY (checked_in_at DESC)
+	`
+
+	if err := Session.ExecStmt(createCheckinTable); err != nil {
+		return fmt.Errorf("failed to create checkin_logs table: %w", err)
+	}
+
+	// Create generic event tables, one per access pattern
+	//- events_by_user: ユーザー単位の行動履歴（ユーザージャーニー分析）
+	//- events_by_type: イベント種別・日単位の集計
+	//- events_by_business: ビジネス単位・日単位のタイムライン
+	createEventsByUser := `
+		CREATE TABLE IF NOT EXISTS yelp_logs.events_by_user (
+			user_id INT,
+			occurred_at TIMESTAMP,
+			event_id TEXT,
+			event_type TEXT,
+			version INT,
+			source TEXT,
+			business_id INT,
+			ip_address TEXT,
+			user_agent TEXT,
+			payload TEXT,
+			PRIMARY KEY (user_id, occurred_at, event_id)
+		) WITH CLUSTERING ORDER BY (occurred_at DESC, event_id ASC)
+	`
+
+	if err := Session.ExecStmt(createEventsByUser); err != nil {
+		return fmt.Errorf("failed to create events_by_user table: %w", err)
+	}
+
+	createEventsByType := `
+		CREATE TABLE IF NOT EXISTS yelp_logs.events_by_type (
+			event_type TEXT,
+			event_date DATE,
+			occurred_at TIMESTAMP,
+			event_id TEXT,
+			version INT,
+			source TEXT,
+			user_id INT,
+			business_id INT,
+			payload TEXT,
+			PRIMARY KEY ((event_type, event_date), occurred_at, event_id)
+		) WITH CLUSTERING ORDER BY (occurred_at DESC, event_id ASC)
+	`
+
+	if err := Session.ExecStmt(createEventsByType); err != nil {
+		return fmt.Errorf("failed to create events_by_type table: %w", err)
+	}
+
+	createEventsByBusiness := `
+		CREATE TABLE IF NOT EXISTS yelp_logs.events_by_business (
+			business_id INT,
+			event_date DATE,
+			occurred_at TIMESTAMP,
+			event_id TEXT,
+			event_type TEXT,
+			version INT,
+			source TEXT,
+			user_id INT,
+			payload TEXT,
+			PRIMARY KEY ((business_id, event_date), occurred_at, event_id)
+		) WITH CLUSTERING ORDER BY (occurred_at DESC, event_id ASC)
+	`
+
+	if err := Session.ExecStmt(createEventsByBusiness); err != nil {
+		return fmt.Errorf("failed to create events_by_business table: %w", err)
+	}
+
 	// Create schema_migrations table for tracking (with keyspace prefix)
 	createMigrationTable := `
 		CREATE TABLE IF NOT EXISTS yelp_logs.schema_migrations (
@@ -102,6 +244,137 @@ func AutoMigrate() error {
 		return fmt.Errorf("failed to create schema_migrations table: %w", err)
 	}
 
-	log.Println("Cassandra migrations completed successfully")
+	// Columns added to existing tables
+	//- ユーザーエージェントの解析結果と、統計から除外したクローラーの閲覧数
+	if err := applyMigration("001_user_agent_details",
+		`ALTER TABLE yelp_logs.review_view_logs ADD (browser TEXT, os TEXT, device_type TEXT, is_bot BOOLEAN)`,
+		`ALTER TABLE yelp_logs.business_daily_view_counts ADD bot_views COUNTER`,
+	); err != nil {
+		return err
+	}
+
+	// review_view_logs has no review_id in its key, so the reviews seen in one request
+	// overwrote each other; views are written here instead
+	if err := applyMigration("002_review_views_by_user",
+		`CREATE TABLE IF NOT EXISTS yelp_logs.review_views_by_user (
+			user_id INT,
+			business_id INT,
+			review_id INT,
+			viewed_at TIMESTAMP,
+			ip_address TEXT,
+			user_agent TEXT,
+			browser TEXT,
+			os TEXT,
+			device_type TEXT,
+			is_bot BOOLEAN,
+			PRIMARY KEY (user_id, viewed_at, business_id, review_id)
+		) WITH CLUSTERING ORDER BY (viewed_at DESC)`,
+	); err != nil {
+		return err
+	}
+
+	// Retried batches deliver the same view again; a view is added to the counters only
+	// when its row here is inserted
+	if err := applyMigration("003_counted_review_views",
+		`CREATE TABLE IF NOT EXISTS yelp_logs.counted_review_views (
+			user_id INT,
+			viewed_at TIMESTAMP,
+			business_id INT,
+			review_id INT,
+			PRIMARY KEY (user_id, viewed_at, business_id, review_id)
+		)`,
+	); err != nil {
+		return err
+	}
+
+	// events_by_type put every event of a type and day in one partition; events are
+	// spread over buckets instead, and counted per business and hour as they arrive
+	if err := applyMigration("004_event_buckets_and_counts",
+		`CREATE TABLE IF NOT EXISTS yelp_logs.events_by_type_bucket (
+			event_type TEXT,
+			event_date DATE,
+			bucket INT,
+			occurred_at TIMESTAMP,
+			event_id TEXT,
+			version INT,
+			source TEXT,
+			user_id INT,
+			business_id INT,
+			payload TEXT,
+			PRIMARY KEY ((event_type, event_date, bucket), occurred_at, event_id)
+		) WITH CLUSTERING ORDER BY (occurred_at DESC, event_id ASC)`,
+		`CREATE TABLE IF NOT EXISTS yelp_logs.business_hourly_event_counts (
+			event_type TEXT,
+			event_hour TIMESTAMP,
+			business_id INT,
+			events COUNTER,
+			PRIMARY KEY ((event_type, event_hour), business_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS yelp_logs.counted_events (
+			event_id TEXT PRIMARY KEY
+		)`,
+	); err != nil {
+		return err
+	}
+	appliedAt, err := migrationAppliedAt("004_event_buckets_and_counts")
+	if err != nil {
+		return err
+	}
+	EventCountsSince = appliedAt.UTC().Truncate(time.Hour).Add(time.Hour)
+
+	// Signed-out visitors share one user ID, so their views are counted apart from the unique viewers
+	if err := applyMigration("005_guest_views",
+		`ALTER TABLE yelp_logs.business_daily_view_counts ADD guest_views COUNTER`,
+	); err != nil {
+		return err
+	}
+
+	slog.Info("Cassandra migrations completed")
 	return nil
 }
+
+// applyMigration runs schema statements once, recording the version in schema_migrations.
+// Columns that already exist are skipped so a partially applied migration can be re-run.
+func applyMigration(version string, statements ...string) error {
+	var applied []string
+	if err := Session.Query(`SELECT version FROM yelp_logs.schema_migrations WHERE version = ?`, nil).
+		Bind(version).SelectRelease(&applied); err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	if len(applied) > 0 {
+		return nil
+	}
+
+	for _, stmt := range statements {
+		if err := Session.ExecStmt(stmt); err != nil && !isAlreadyExists(err) {
+			return fmt.Errorf("failed to apply migration %s: %w", version, err)
+		}
+	}
+
+	checksum := sha256.Sum256([]byte(strings.Join(statements, ";")))
+	if err := Session.Query(`INSERT INTO yelp_logs.schema_migrations (version, executed_at, checksum) VALUES (?, ?, ?)`, nil).
+		Bind(version, time.Now(), hex.EncodeToString(checksum[:])).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", version, err)
+	}
+
+	slog.Info("Applied Cassandra migration", "version", version)
+	return nil
+}
+
+// migrationAppliedAt returns when a migration was recorded in schema_migrations
+func migrationAppliedAt(version string) (time.Time, error) {
+	var executedAt []time.Time
+	if err := Session.Query(`SELECT executed_at FROM yelp_logs.schema_migrations WHERE version = ?`, nil).
+		Bind(version).SelectRelease(&executedAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	if len(executedAt) == 0 {
+		return time.Time{}, fmt.Errorf("migration %s was not recorded", version)
+	}
+	return executedAt[0], nil
+}
+
+func isAlreadyExists(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already exist") || strings.Contains(msg, "conflicts with an existing column")
+}
@@ -0,0 +1,131 @@
+package cassandra
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTTL is the longest TTL Cassandra accepts (20 years)
+const maxTTL = 630720000 * time.Second
+
+// RetentionPolicy is how long the rows of a table are kept.
+// A zero TTL keeps rows forever.
+type RetentionPolicy struct {
+	Table string
+	TTL   time.Duration
+	// PIIColumns hold raw personal data and expire after PIITTL, before the rest of the row
+	PIIColumns []string
+	PIITTL     time.Duration
+	// Counter tables can't be written with a TTL, so they are kept forever
+	Counter bool
+}
+
+// defaultRetention lists every table in yelp_logs.
+// Raw logs are kept for a year with PII for 30 days; anonymized aggregates outlive them.
+var defaultRetention = []RetentionPolicy{
+	{Table: "review_views_by_user", TTL: 365 * 24 * time.Hour, PIIColumns: []string{"ip_address", "user_agent"}, PIITTL: 30 * 24 * time.Hour},
+	{Table: "review_view_logs", TTL: 365 * 24 * time.Hour, PIIColumns: []string{"ip_address", "user_agent"}, PIITTL: 30 * 24 * time.Hour},
+	{Table: "checkin_logs", TTL: 365 * 24 * time.Hour, PIIColumns: []string{"ip_address", "user_agent"}, PIITTL: 30 * 24 * time.Hour},
+	{Table: "events_by_user", TTL: 365 * 24 * time.Hour, PIIColumns: []string{"ip_address", "user_agent"}, PIITTL: 30 * 24 * time.Hour},
+	{Table: "events_by_type", TTL: 365 * 24 * time.Hour},
+	{Table: "events_by_type_bucket", TTL: 365 * 24 * time.Hour},
+	{Table: "events_by_business", TTL: 365 * 24 * time.Hour},
+	{Table: "business_daily_viewers", TTL: 730 * 24 * time.Hour},
+	// Only needs to outlive the retries and spool replays of a view
+	{Table: "counted_review_views", TTL: 7 * 24 * time.Hour},
+	{Table: "counted_events", TTL: 7 * 24 * time.Hour},
+	{Table: "business_hourly_event_counts", Counter: true},
+	{Table: "business_daily_view_counts", Counter: true},
+	{Table: "business_daily_review_view_counts", Counter: true},
+}
+
+var retention = map[string]RetentionPolicy{}
+
+// LoadRetention reads per-table overrides from RETENTION_<TABLE> and RETENTION_<TABLE>_PII,
+// e.g. RETENTION_REVIEW_VIEW_LOGS=180d and RETENTION_REVIEW_VIEW_LOGS_PII=7d
+func LoadRetention() {
+	retention = map[string]RetentionPolicy{}
+
+	for _, policy := range defaultRetention {
+		env := "RETENTION_" + strings.ToUpper(policy.Table)
+
+		if value := os.Getenv(env); value != "" {
+			if policy.Counter {
+				slog.Warn("Ignoring retention of a counter table, counters can't expire", "env", env)
+			} else if ttl, err := parseRetention(value); err != nil {
+				slog.Warn("Ignoring invalid retention", "env", env, "error", err)
+			} else {
+				policy.TTL = ttl
+			}
+		}
+
+		if len(policy.PIIColumns) > 0 {
+			if value := os.Getenv(env + "_PII"); value != "" {
+				if ttl, err := parseRetention(value); err != nil {
+					slog.Warn("Ignoring invalid retention", "env", env+"_PII", "error", err)
+				} else {
+					policy.PIITTL = ttl
+				}
+			}
+			// PII never outlives the row it belongs to
+			if policy.TTL > 0 && (policy.PIITTL == 0 || policy.PIITTL > policy.TTL) {
+				policy.PIITTL = policy.TTL
+			}
+		}
+
+		retention[policy.Table] = policy
+	}
+}
+
+// parseRetention accepts a number of days ("90d"), a Go duration ("720h") or "0" for no expiry
+func parseRetention(value string) (time.Duration, error) {
+	var ttl time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention %q", value)
+		}
+		ttl = time.Duration(n) * 24 * time.Hour
+	} else if value == "0" {
+		ttl = 0
+	} else {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention %q", value)
+		}
+		ttl = d
+	}
+
+	if ttl < 0 {
+		return 0, fmt.Errorf("retention must not be negative: %q", value)
+	}
+	if ttl > 0 && ttl < time.Second {
+		return 0, fmt.Errorf("retention must be at least one second: %q", value)
+	}
+	if ttl > maxTTL {
+		return 0, fmt.Errorf("retention exceeds Cassandra's 20 year limit: %q", value)
+	}
+	return ttl, nil
+}
+
+// RetentionFor returns the policy of a table, with or without the keyspace prefix
+func RetentionFor(table string) RetentionPolicy {
+	name := strings.TrimPrefix(table, "yelp_logs.")
+	if policy, ok := retention[name]; ok {
+		return policy
+	}
+	return RetentionPolicy{Table: name}
+}
+
+// RetentionPolicies returns the effective policy of every table
+func RetentionPolicies() []RetentionPolicy {
+	policies := make([]RetentionPolicy, 0, len(defaultRetention))
+	for _, policy := range defaultRetention {
+		policies = append(policies, RetentionFor(policy.Table))
+	}
+	return policies
+}
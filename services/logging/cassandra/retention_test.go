@@ -0,0 +1,91 @@
+package cassandra
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90d", 90 * day, false},
+		{"0d", 0, false},
+		{"720h", 720 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"0", 0, false},
+		{"7300d", 7300 * day, false},
+		{"1s", time.Second, false},
+		{"", 0, true},
+		{"90", 0, true},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"ninety days", 0, true},
+		{"-1d", 0, true},
+		{"-5m", 0, true},
+		{"500ms", 0, true},
+		{"7301d", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRetention(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseRetention(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadRetention(t *testing.T) {
+	// Runs after the environment is restored
+	t.Cleanup(LoadRetention)
+
+	t.Setenv("RETENTION_REVIEW_VIEW_LOGS", "180d")
+	t.Setenv("RETENTION_REVIEW_VIEW_LOGS_PII", "7d")
+	// PII can't be kept longer than its row
+	t.Setenv("RETENTION_CHECKIN_LOGS", "14d")
+	// A row kept forever keeps its PII TTL
+	t.Setenv("RETENTION_EVENTS_BY_USER", "0")
+	// Invalid values and counter tables keep their defaults
+	t.Setenv("RETENTION_REVIEW_VIEWS_BY_USER", "forever")
+	t.Setenv("RETENTION_REVIEW_VIEWS_BY_USER_PII", "-1d")
+	t.Setenv("RETENTION_BUSINESS_DAILY_VIEW_COUNTS", "30d")
+	// Only tables with PII columns read _PII
+	t.Setenv("RETENTION_EVENTS_BY_BUSINESS_PII", "1d")
+	LoadRetention()
+
+	tests := []RetentionPolicy{
+		{Table: "review_view_logs", TTL: 180 * day, PIIColumns: []string{"ip_address", "user_agent"}, PIITTL: 7 * day},
+		{Table: "checkin_logs", TTL: 14 * day, PIIColumns: []string{"ip_address", "user_agent"}, PIITTL: 14 * day},
+		{Table: "events_by_user", PIIColumns: []string{"ip_address", "user_agent"}, PIITTL: 30 * day},
+		{Table: "review_views_by_user", TTL: 365 * day, PIIColumns: []string{"ip_address", "user_agent"}, PIITTL: 30 * day},
+		{Table: "business_daily_view_counts", Counter: true},
+		{Table: "events_by_business", TTL: 365 * day},
+	}
+	for _, want := range tests {
+		if got := RetentionFor("yelp_logs." + want.Table); !reflect.DeepEqual(got, want) {
+			t.Errorf("RetentionFor(%s) = %+v, want %+v", want.Table, got, want)
+		}
+	}
+}
+
+func TestRetentionFor(t *testing.T) {
+	t.Cleanup(LoadRetention)
+	LoadRetention()
+
+	if got := RetentionFor("counted_events"); got.TTL != 7*day {
+		t.Errorf("RetentionFor without keyspace = %+v, want the 7 day policy", got)
+	}
+	if got := RetentionFor("yelp_logs.counted_events"); got.TTL != 7*day {
+		t.Errorf("RetentionFor with keyspace = %+v, want the 7 day policy", got)
+	}
+	if got := RetentionFor("yelp_logs.unknown"); !reflect.DeepEqual(got, RetentionPolicy{Table: "unknown"}) {
+		t.Errorf("RetentionFor of an unlisted table = %+v, want no expiry", got)
+	}
+	if got := RetentionPolicies(); len(got) != len(defaultRetention) {
+		t.Errorf("RetentionPolicies returned %d policies, want %d", len(got), len(defaultRetention))
+	}
+}
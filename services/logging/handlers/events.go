@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"logging/anonymize"
+	"logging/models"
+	"net/http"
+	"time"
+
+	"logging/cassandra"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v2/qb"
+	"github.com/yelp-sample-v2/shared/events"
+)
+
+var eventsByUserTable = "yelp_logs.events_by_user"
+var eventsByTypeTable = "yelp_logs.events_by_type_bucket"
+var eventsByBusinessTable = "yelp_logs.events_by_business"
+
+// legacyEventsByTypeTable is no longer written; its rows are counted and erased until they expire
+var legacyEventsByTypeTable = "yelp_logs.events_by_type"
+
+// businessHourlyEventCountsTable counts events per type, hour and business for the rollup worker
+var businessHourlyEventCountsTable = "yelp_logs.business_hourly_event_counts"
+
+// countedEventsTable holds the events already added to businessHourlyEventCountsTable
+var countedEventsTable = "yelp_logs.counted_events"
+
+// eventBuckets is how many partitions the events of one type and day are spread over
+const eventBuckets = 16
+
+// eventBucket picks an event's bucket from its ID, so the bucket can be found again from events_by_user
+func eventBucket(eventID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(eventID))
+	return int(h.Sum32() % eventBuckets)
+}
+
+type IngestEventsRequest struct {
+	Events []events.Event `json:"events" binding:"required,min=1,max=500"`
+}
+
+// IngestEvents validates events per type and stores the valid ones.
+// Invalid events are reported by index and never retried by emitters.
+func IngestEvents(c *gin.Context) {
+	var req IngestEventsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.LogResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	response := models.IngestEventsResponse{
+		Rejected: []models.EventRejection{},
+		Failed:   []int{},
+	}
+
+	for i, event := range req.Events {
+		if err := event.Validate(); err != nil {
+			response.Rejected = append(response.Rejected, models.EventRejection{Index: i, Error: err.Error()})
+			continue
+		}
+		record := newEventRecord(event)
+		if err := insertEvent(c.Request.Context(), record); err != nil {
+			response.Failed = append(response.Failed, i)
+			continue
+		}
+		publishEvent(record)
+		response.Accepted++
+	}
+	response.Success = len(response.Rejected) == 0 && len(response.Failed) == 0
+
+	switch {
+	case len(response.Failed) > 0 && response.Accepted == 0:
+		// Storage is failing: let the emitter retry
+		c.JSON(http.StatusServiceUnavailable, response)
+	case len(response.Rejected) == len(req.Events):
+		c.JSON(http.StatusUnprocessableEntity, response)
+	default:
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func newEventRecord(event events.Event) models.EventRecord {
+	if event.ID == "" {
+		event.ID = gocql.TimeUUID().String()
+	}
+
+	return models.EventRecord{
+		EventID:    event.ID,
+		EventType:  event.Type,
+		EventDate:  viewDate(event.OccurredAt),
+		Bucket:     eventBucket(event.ID),
+		Version:    event.Version,
+		OccurredAt: event.OccurredAt,
+		Source:     event.Source,
+		UserID:     event.UserID,
+		BusinessID: event.BusinessID,
+		IPAddress:  anonymize.IP(event.IPAddress),
+		UserAgent:  event.UserAgent,
+		Payload:    string(event.Payload),
+	}
+}
+
+// insertEvent writes an event to every table whose access pattern it belongs to
+func insertEvent(ctx context.Context, record models.EventRecord) error {
+	if err := insertWithRetention(ctx, eventsByUserTable,
+		[]string{"user_id", "occurred_at", "event_id"},
+		[]string{
+			"user_id", "occurred_at", "event_id", "event_type", "version",
+			"source", "business_id", "ip_address", "user_agent", "payload",
+		},
+		&record,
+	); err != nil {
+		return err
+	}
+
+	if err := insertWithRetention(ctx, eventsByTypeTable,
+		[]string{"event_type", "event_date", "bucket", "occurred_at", "event_id"},
+		[]string{
+			"event_type", "event_date", "bucket", "occurred_at", "event_id", "version",
+			"source", "user_id", "business_id", "payload",
+		},
+		&record,
+	); err != nil {
+		return err
+	}
+
+	if record.BusinessID == 0 {
+		return nil
+	}
+
+	if err := insertWithRetention(ctx, eventsByBusinessTable,
+		[]string{"business_id", "event_date", "occurred_at", "event_id"},
+		[]string{
+			"business_id", "event_date", "occurred_at", "event_id", "event_type",
+			"version", "source", "user_id", "payload",
+		},
+		&record,
+	); err != nil {
+		return err
+	}
+
+	return countEvent(ctx, record)
+}
+
+// countEvent adds an event to its business's hourly count. An event delivered again,
+// as when the emitter retries, is not counted twice.
+func countEvent(ctx context.Context, record models.EventRecord) error {
+	claim := qb.Insert(countedEventsTable).Columns("event_id").Unique()
+	if ttl := cassandra.RetentionFor(countedEventsTable).TTL; ttl > 0 {
+		claim.TTL(ttl)
+	}
+	stmt, names := claim.ToCql()
+	claimed, err := cassandra.Session.ContextQuery(ctx, stmt, names).BindStruct(&record).ExecCASRelease()
+	if err != nil || !claimed {
+		return err
+	}
+
+	stmt, names = qb.Update(businessHourlyEventCountsTable).
+		Add("events").
+		Where(qb.Eq("event_type"), qb.Eq("event_hour"), qb.Eq("business_id")).
+		ToCql()
+	if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+		"events":      int64(1),
+		"event_type":  record.EventType,
+		"event_hour":  record.OccurredAt.UTC().Truncate(time.Hour),
+		"business_id": record.BusinessID,
+	}).ExecRelease(); err != nil {
+		// Let the retry count the event again
+		stmt, names := qb.Delete(countedEventsTable).Where(qb.Eq("event_id")).ToCql()
+		if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindStruct(&record).ExecRelease(); err != nil {
+			slog.Warn("Failed to release counted event", "event_id", record.EventID, "error", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// maxCountWindow bounds how many partitions a count reads
+const maxCountWindow = 24 * time.Hour
+
+// CountEvents returns per-business counts of one event type in [from, to).
+// It is an internal endpoint used by the business service's rollup worker, which asks
+// for whole hours; those are read from the hourly counts.
+func CountEvents(c *gin.Context) {
+	eventType := c.Query("type")
+	if eventType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type is required"})
+		return
+	}
+
+	from, errFrom := time.Parse(time.RFC3339, c.Query("from"))
+	to, errTo := time.Parse(time.RFC3339, c.Query("to"))
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be RFC 3339 timestamps"})
+		return
+	}
+	if !from.Before(to) || to.Sub(from) > maxCountWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the window must not exceed 24h"})
+		return
+	}
+
+	var counts map[int]int64
+	var err error
+	if from.Equal(from.Truncate(time.Hour)) && to.Equal(to.Truncate(time.Hour)) && !from.Before(cassandra.EventCountsSince) {
+		counts, err = readEventCounts(c.Request.Context(), eventType, from, to)
+	} else {
+		counts, err = scanEventCounts(c.Request.Context(), eventType, from, to)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count events"})
+		return
+	}
+
+	response := models.EventCountsResponse{
+		Type:   eventType,
+		From:   from,
+		To:     to,
+		Counts: make([]models.BusinessEventCount, 0, len(counts)),
+	}
+	for businessID, count := range counts {
+		response.Counts = append(response.Counts, models.BusinessEventCount{BusinessID: businessID, Count: count})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// readEventCounts sums the hourly per-business counts of whole hours in [from, to)
+func readEventCounts(ctx context.Context, eventType string, from, to time.Time) (map[int]int64, error) {
+	stmt, names := qb.Select(businessHourlyEventCountsTable).
+		Columns("business_id", "events").
+		Where(qb.Eq("event_type"), qb.Eq("event_hour")).
+		ToCql()
+
+	counts := map[int]int64{}
+	for hour := from.UTC(); hour.Before(to); hour = hour.Add(time.Hour) {
+		var rows []struct {
+			BusinessID int   `db:"business_id"`
+			Events     int64 `db:"events"`
+		}
+		if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+			"event_type": eventType,
+			"event_hour": hour,
+		}).SelectRelease(&rows); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			counts[row.BusinessID] += row.Events
+		}
+	}
+	return counts, nil
+}
+
+// scanEventCounts counts the event rows in [from, to), for windows the hourly counts
+// don't cover: partial hours and hours before the counts were kept
+func scanEventCounts(ctx context.Context, eventType string, from, to time.Time) (map[int]int64, error) {
+	legacy, legacyNames := qb.Select(legacyEventsByTypeTable).
+		Columns("business_id").
+		Where(qb.Eq("event_type"), qb.Eq("event_date"), qb.GtOrEqNamed("occurred_at", "from"), qb.LtNamed("occurred_at", "to")).
+		ToCql()
+	bucketed, bucketedNames := qb.Select(eventsByTypeTable).
+		Columns("business_id").
+		Where(qb.Eq("event_type"), qb.Eq("event_date"), qb.Eq("bucket"), qb.GtOrEqNamed("occurred_at", "from"), qb.LtNamed("occurred_at", "to")).
+		ToCql()
+
+	counts := map[int]int64{}
+	for day := viewDate(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		key := map[string]interface{}{
+			"event_type": eventType,
+			"event_date": day,
+			"from":       from,
+			"to":         to,
+		}
+
+		// Events stored before the buckets were introduced are in the legacy table
+		var businessIDs []int
+		if err := cassandra.Session.ContextQuery(ctx, legacy, legacyNames).BindMap(key).SelectRelease(&businessIDs); err != nil {
+			return nil, err
+		}
+		for bucket := 0; bucket < eventBuckets; bucket++ {
+			key["bucket"] = bucket
+			var ids []int
+			if err := cassandra.Session.ContextQuery(ctx, bucketed, bucketedNames).BindMap(key).SelectRelease(&ids); err != nil {
+				return nil, err
+			}
+			businessIDs = append(businessIDs, ids...)
+		}
+
+		for _, businessID := range businessIDs {
+			if businessID != 0 {
+				counts[businessID]++
+			}
+		}
+	}
+	return counts, nil
+}
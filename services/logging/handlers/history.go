@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"logging/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"logging/cassandra"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// historyFilter holds the filters of a history query. A cursor is only valid for the filters it was issued with.
+type historyFilter struct {
+	UserID     int
+	From       *time.Time
+	To         *time.Time // exclusive
+	BusinessID int
+}
+
+// fingerprint identifies the filters so a cursor can't be replayed against a different query
+func (f historyFilter) fingerprint() []byte {
+	var from, to int64
+	if f.From != nil {
+		from = f.From.UnixNano()
+	}
+	if f.To != nil {
+		to = f.To.UnixNano()
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%d|%d", f.UserID, from, to, f.BusinessID)))
+	return sum[:8]
+}
+
+// encodeHistoryCursor wraps Cassandra's page state in an opaque cursor
+func encodeHistoryCursor(f historyFilter, pageState []byte) string {
+	if len(pageState) == 0 {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(append(f.fingerprint(), pageState...))
+}
+
+func decodeHistoryCursor(f historyFilter, cursor string) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) <= 8 {
+		return nil, errInvalidCursor
+	}
+	if !bytes.Equal(raw[:8], f.fingerprint()) {
+		return nil, errInvalidCursor
+	}
+	return raw[8:], nil
+}
+
+// parseHistoryTime accepts RFC 3339 timestamps or YYYY-MM-DD dates.
+// A date used as an upper bound covers the whole day.
+func parseHistoryTime(value string, upper bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parseHistoryFilter reads the from/to/business_id query parameters, writing an error response if they are invalid
+func parseHistoryFilter(c *gin.Context, userID int) (historyFilter, bool) {
+	f := historyFilter{UserID: userID}
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := parseHistoryTime(fromStr, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected RFC 3339 or YYYY-MM-DD"})
+			return f, false
+		}
+		f.From = &from
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := parseHistoryTime(toStr, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected RFC 3339 or YYYY-MM-DD"})
+			return f, false
+		}
+		f.To = &to
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return f, false
+	}
+
+	if businessIDStr := c.Query("business_id"); businessIDStr != "" {
+		businessID, err := strconv.Atoi(businessIDStr)
+		if err != nil || businessID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business_id format"})
+			return f, false
+		}
+		f.BusinessID = businessID
+	}
+
+	return f, true
+}
+
+func GetUserViewHistory(c *gin.Context) {
+	userIDStr := c.Param("user_id")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id format"})
+		return
+	}
+
+	filter, ok := parseHistoryFilter(c, userID)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultHistoryLimit)))
+	if err != nil || limit < 1 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	groupBy := c.Query("group_by")
+	if groupBy != "" && groupBy != "business" && groupBy != "day" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be business or day"})
+		return
+	}
+
+	var pageState []byte
+	if cursor := c.Query("cursor"); cursor != "" {
+		pageState, err = decodeHistoryCursor(filter, cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+
+	// Query user's view history: a range scan over the viewed_at clustering column
+	bind := map[string]interface{}{"user_id": userID}
+	builder := qb.Select(reviewViewsTable).Where(qb.Eq("user_id"))
+	if filter.From != nil {
+		builder.Where(qb.GtOrEqNamed("viewed_at", "from"))
+		bind["from"] = *filter.From
+	}
+	if filter.To != nil {
+		builder.Where(qb.LtNamed("viewed_at", "to"))
+		bind["to"] = *filter.To
+	}
+	if filter.BusinessID != 0 {
+		// business_id follows viewed_at in the clustering key, so it is filtered within the user's partition
+		builder.Where(qb.Eq("business_id")).AllowFiltering()
+		bind["business_id"] = filter.BusinessID
+	}
+	stmt, names := builder.OrderBy("viewed_at", qb.DESC).ToCql()
+
+	q := cassandra.Session.ContextQuery(c.Request.Context(), stmt, names).BindMap(bind)
+	defer q.Release()
+	// Setting the page state (even when empty) turns off automatic paging, so only one page is read
+	q.PageState(pageState)
+	q.PageSize(limit)
+
+	iter := q.Iter()
+	nextPageState := iter.PageState()
+
+	logs := []models.ReviewViewLog{}
+	if err := iter.Select(&logs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch view history"})
+		return
+	}
+
+	response := models.ViewHistoryResponse{
+		UserID:     userID,
+		Views:      logs,
+		GroupBy:    groupBy,
+		NextCursor: encodeHistoryCursor(filter, nextPageState),
+	}
+	if groupBy != "" {
+		response.Groups = groupViewHistory(logs, groupBy)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// groupViewHistory groups views by business or by UTC day, keeping the most recent group first
+func groupViewHistory(logs []models.ReviewViewLog, groupBy string) []models.ViewHistoryGroup {
+	groups := []models.ViewHistoryGroup{}
+	index := map[string]int{}
+
+	for _, view := range logs {
+		var key string
+		group := models.ViewHistoryGroup{ReviewIDs: []int{}}
+		if groupBy == "business" {
+			key = strconv.Itoa(view.BusinessID)
+			group.BusinessID = view.BusinessID
+		} else {
+			key = viewDate(view.ViewedAt).Format(dateLayout)
+			group.Date = key
+		}
+
+		i, ok := index[key]
+		if !ok {
+			// Views arrive newest first, so the first view seen is the latest one
+			group.LastViewedAt = view.ViewedAt
+			groups = append(groups, group)
+			i = len(groups) - 1
+			index[key] = i
+		}
+
+		g := &groups[i]
+		g.ViewCount++
+		g.FirstViewedAt = view.ViewedAt
+		if !containsInt(g.ReviewIDs, view.ReviewID) {
+			g.ReviewIDs = append(g.ReviewIDs, view.ReviewID)
+		}
+	}
+
+	return groups
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
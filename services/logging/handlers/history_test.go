@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHistoryCursorRoundTrip(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	filter := historyFilter{UserID: 7, From: &from, To: &to, BusinessID: 42}
+	pageState := []byte{0x00, 0x12, 0xff, 0x7f, 0x01}
+
+	cursor := encodeHistoryCursor(filter, pageState)
+	if cursor == "" {
+		t.Fatal("encodeHistoryCursor returned no cursor for a page state")
+	}
+	got, err := decodeHistoryCursor(filter, cursor)
+	if err != nil {
+		t.Fatalf("decodeHistoryCursor: %v", err)
+	}
+	if string(got) != string(pageState) {
+		t.Errorf("decoded page state %x, want %x", got, pageState)
+	}
+
+	// The last page has no page state and gets no cursor
+	if cursor := encodeHistoryCursor(filter, nil); cursor != "" {
+		t.Errorf("cursor for the last page = %q, want none", cursor)
+	}
+}
+
+func TestHistoryCursorIsBoundToFilter(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	later := from.Add(time.Nanosecond)
+	filter := historyFilter{UserID: 7, From: &from, To: &to, BusinessID: 42}
+	cursor := encodeHistoryCursor(filter, []byte("page-2"))
+
+	tests := []struct {
+		name   string
+		filter historyFilter
+	}{
+		{"other user", historyFilter{UserID: 8, From: &from, To: &to, BusinessID: 42}},
+		{"other from", historyFilter{UserID: 7, From: &later, To: &to, BusinessID: 42}},
+		{"no from", historyFilter{UserID: 7, To: &to, BusinessID: 42}},
+		{"other to", historyFilter{UserID: 7, From: &from, To: &later, BusinessID: 42}},
+		{"no to", historyFilter{UserID: 7, From: &from, BusinessID: 42}},
+		{"other business", historyFilter{UserID: 7, From: &from, To: &to, BusinessID: 43}},
+		{"no business", historyFilter{UserID: 7, From: &from, To: &to}},
+	}
+	for _, tt := range tests {
+		if _, err := decodeHistoryCursor(tt.filter, cursor); !errors.Is(err, errInvalidCursor) {
+			t.Errorf("%s: decodeHistoryCursor = %v, want errInvalidCursor", tt.name, err)
+		}
+	}
+
+	// The same filters built separately match
+	sameFrom, sameTo := from, to
+	if _, err := decodeHistoryCursor(historyFilter{UserID: 7, From: &sameFrom, To: &sameTo, BusinessID: 42}, cursor); err != nil {
+		t.Errorf("decodeHistoryCursor with equal filters: %v", err)
+	}
+}
+
+func TestDecodeHistoryCursorRejectsMalformed(t *testing.T) {
+	filter := historyFilter{UserID: 7}
+	fingerprint := filter.fingerprint()
+
+	tests := map[string]string{
+		"not base64":           "not base64!",
+		"fingerprint only":     base64.RawURLEncoding.EncodeToString(fingerprint),
+		"short":                base64.RawURLEncoding.EncodeToString([]byte("abc")),
+		"tampered fingerprint": base64.RawURLEncoding.EncodeToString(append(append([]byte{fingerprint[0] ^ 1}, fingerprint[1:]...), "page-2"...)),
+	}
+	for name, cursor := range tests {
+		if _, err := decodeHistoryCursor(filter, cursor); !errors.Is(err, errInvalidCursor) {
+			t.Errorf("%s: decodeHistoryCursor(%q) = %v, want errInvalidCursor", name, cursor, err)
+		}
+	}
+}
+
+func TestParseHistoryTime(t *testing.T) {
+	tests := []struct {
+		value string
+		upper bool
+		want  time.Time
+	}{
+		{"2024-03-01T09:30:00Z", false, time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{"2024-03-01T09:30:00Z", true, time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{"2024-03-01", false, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// A date as the upper bound covers the whole day
+		{"2024-03-01", true, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseHistoryTime(tt.value, tt.upper)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseHistoryTime(%q, %v) = %v, %v; want %v", tt.value, tt.upper, got, err, tt.want)
+		}
+	}
+	if _, err := parseHistoryTime("03/01/2024", false); err == nil {
+		t.Error("parseHistoryTime accepted 03/01/2024")
+	}
+}
@@ -1,18 +1,22 @@
 package handlers
 
 import (
+	"context"
+	"logging/anonymize"
 	"logging/models"
+	"logging/useragent"
 	"net/http"
-	"strconv"
 	"time"
 
-	"logging/cassandra"
-
 	"github.com/gin-gonic/gin"
-	"github.com/scylladb/gocqlx/v2/qb"
 )
 
-var reviewViewLogsTable = "yelp_logs.review_view_logs"
+// reviewViewsTable keys views by review as well, so every review seen in one request is kept
+var reviewViewsTable = "yelp_logs.review_views_by_user"
+
+// legacyReviewViewLogsTable is no longer written; its rows are exported and erased until they expire
+var legacyReviewViewLogsTable = "yelp_logs.review_view_logs"
+var checkinLogsTable = "yelp_logs.checkin_logs"
 
 func LogReviewView(c *gin.Context) {
 	var req models.LogRequest
@@ -24,27 +28,7 @@ func LogReviewView(c *gin.Context) {
 		return
 	}
 
-	// User ID comes from the request payload
-	userID := req.UserID
-
-	// Create log entry
-	log := models.ReviewViewLog{
-		UserID:     userID,
-		BusinessID: req.BusinessID,
-		ReviewID:   req.ReviewID,
-		ViewedAt:   time.Now(),
-		IPAddress:  req.IPAddress,
-		UserAgent:  req.UserAgent,
-	}
-
-	// Insert into Cassandra
-	stmt, names := qb.Insert(reviewViewLogsTable).Columns(
-		"user_id", "business_id", "review_id", "viewed_at",
-		"ip_address", "user_agent",
-	).ToCql()
-
-	q := cassandra.Session.Query(stmt, names).BindStruct(&log)
-	if err := q.ExecRelease(); err != nil {
+	if err := insertReviewView(c.Request.Context(), newReviewViewLog(req)); err != nil {
 		c.JSON(http.StatusInternalServerError, models.LogResponse{
 			Success: false,
 			Message: "Failed to log review view: " + err.Error(),
@@ -58,49 +42,86 @@ func LogReviewView(c *gin.Context) {
 	})
 }
 
-func GetUserViewHistory(c *gin.Context) {
-	userIDStr := c.Param("user_id")
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id format"})
-		return
+// ReviewViewsAction dispatches custom methods on the review-views collection, e.g. "/logs/review-views:batch"
+func ReviewViewsAction(c *gin.Context) {
+	switch c.Param("action") {
+	case ":batch":
+		LogReviewViewsBatch(c)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown action"})
 	}
+}
 
-	// Query user's view history
-	stmt, names := qb.Select(reviewViewLogsTable).
-		Where(qb.Eq("user_id")).
-		OrderBy("viewed_at", qb.DESC).
-		Limit(100).
-		ToCql()
+// LogReviewViewsBatch stores many review views in one request.
+// Events that fail are reported by index so the client can retry just those.
+func LogReviewViewsBatch(c *gin.Context) {
+	var req models.BatchLogRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.LogResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
 
-	q := cassandra.Session.Query(stmt, names).BindMap(map[string]interface{}{
-		"user_id": userID,
-	})
+	response := models.BatchLogResponse{Failed: []int{}}
+	for i, event := range req.Events {
+		if err := insertReviewView(c.Request.Context(), newReviewViewLog(event)); err != nil {
+			response.Failed = append(response.Failed, i)
+			continue
+		}
+		response.Accepted++
+	}
+	response.Success = len(response.Failed) == 0
 
-	var logs []models.ReviewViewLog
-	if err := q.SelectRelease(&logs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch view history"})
+	// Nothing was stored: report a server error so the whole batch is retried
+	if response.Accepted == 0 {
+		c.JSON(http.StatusServiceUnavailable, response)
 		return
 	}
 
-	c.JSON(http.StatusOK, logs)
+	c.JSON(http.StatusOK, response)
 }
 
-func GetBusinessViewStats(c *gin.Context) {
-	businessIDStr := c.Param("business_id")
-	if businessIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "business_id is required"})
-		return
+func newReviewViewLog(req models.LogRequest) models.ReviewViewLog {
+	viewedAt := time.Now()
+	if req.ViewedAt != nil && !req.ViewedAt.IsZero() {
+		viewedAt = *req.ViewedAt
 	}
 
-	// Note: This is a simplified example. In a real scenario, you'd need to create
-	// additional tables or use materialized views for efficient business-based queries
-	// since Cassandra doesn't support secondary index queries efficiently
+	// Browser, OS, device type and the bot flag are read from the user agent
+	agent := useragent.Parse(req.UserAgent)
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":     "Business view stats endpoint - would require additional table design for efficient querying",
-		"business_id": businessIDStr,
-	})
+	// User ID comes from the request payload
+	return models.ReviewViewLog{
+		UserID:     req.UserID,
+		BusinessID: req.BusinessID,
+		ReviewID:   req.ReviewID,
+		ViewedAt:   viewedAt,
+		// The IP is anonymized before it is persisted
+		IPAddress:  anonymize.IP(req.IPAddress),
+		UserAgent:  req.UserAgent,
+		Browser:    agent.Browser,
+		OS:         agent.OS,
+		DeviceType: agent.DeviceType,
+		IsBot:      agent.IsBot,
+	}
+}
+
+// insertReviewView writes a review view and updates the business statistics
+func insertReviewView(ctx context.Context, log models.ReviewViewLog) error {
+	if err := insertWithRetention(ctx, reviewViewsTable,
+		[]string{"user_id", "viewed_at", "business_id", "review_id"},
+		[]string{
+			"user_id", "business_id", "review_id", "viewed_at", "ip_address", "user_agent",
+			"browser", "os", "device_type", "is_bot",
+		},
+		&log,
+	); err != nil {
+		return err
+	}
+
+	return recordBusinessView(ctx, log)
 }
 
 func HealthCheck(c *gin.Context) {
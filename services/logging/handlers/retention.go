@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"logging/models"
+	"net/http"
+	"time"
+
+	"logging/cassandra"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scylladb/gocqlx/v2/qb"
+	"github.com/yelp-sample-v2/shared/logger"
+)
+
+// insertWithRetention inserts a row with its table's TTL. PII columns are written
+// separately with the shorter PII TTL, so they expire while the rest of the row is kept.
+func insertWithRetention(ctx context.Context, table string, key []string, columns []string, record interface{}) error {
+	policy := cassandra.RetentionFor(table)
+
+	pii := map[string]bool{}
+	for _, column := range policy.PIIColumns {
+		pii[column] = true
+	}
+
+	var rowColumns, piiColumns []string
+	for _, column := range columns {
+		if pii[column] {
+			piiColumns = append(piiColumns, column)
+		} else {
+			rowColumns = append(rowColumns, column)
+		}
+	}
+
+	insert := qb.Insert(table).Columns(rowColumns...)
+	if policy.TTL > 0 {
+		insert.TTL(policy.TTL)
+	}
+	stmt, names := insert.ToCql()
+	if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindStruct(record).ExecRelease(); err != nil {
+		return err
+	}
+
+	if len(piiColumns) == 0 {
+		return nil
+	}
+
+	where := make([]qb.Cmp, 0, len(key))
+	for _, column := range key {
+		where = append(where, qb.Eq(column))
+	}
+	update := qb.Update(table).Set(piiColumns...).Where(where...)
+	if policy.PIITTL > 0 {
+		update.TTL(policy.PIITTL)
+	}
+	stmt, names = update.ToCql()
+	return cassandra.Session.ContextQuery(ctx, stmt, names).BindStruct(record).ExecRelease()
+}
+
+// GetRetention reports the effective retention settings and the estimated size of each table
+func GetRetention(c *gin.Context) {
+	estimates, err := estimateTableSizes(c.Request.Context())
+	if err != nil {
+		logger.From(c.Request.Context()).Warn("Failed to read size estimates", "error", err)
+	}
+
+	report := models.RetentionReport{
+		Keyspace:           "yelp_logs",
+		EstimatesAvailable: err == nil,
+		Tables:             []models.TableRetention{},
+	}
+
+	for _, policy := range cassandra.RetentionPolicies() {
+		table := models.TableRetention{
+			Table:      policy.Table,
+			Expires:    policy.TTL > 0,
+			TTLSeconds: int64(policy.TTL / time.Second),
+			PIIColumns: policy.PIIColumns,
+			Counter:    policy.Counter,
+		}
+		if table.PIIColumns == nil {
+			table.PIIColumns = []string{}
+		}
+		if len(policy.PIIColumns) > 0 {
+			table.PIITTLSeconds = int64(policy.PIITTL / time.Second)
+		}
+
+		if estimate, ok := estimates[policy.Table]; ok {
+			table.EstimatedPartitions = estimate.Partitions
+			table.EstimatedBytes = estimate.Bytes
+		}
+
+		report.EstimatedBytes += table.EstimatedBytes
+		report.Tables = append(report.Tables, table)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+type tableSizeEstimate struct {
+	Partitions int64
+	Bytes      int64
+}
+
+// estimateTableSizes sums Cassandra's per-token-range size estimates for this node.
+// Estimates are refreshed by Cassandra periodically and are approximate.
+func estimateTableSizes(ctx context.Context) (map[string]tableSizeEstimate, error) {
+	stmt, names := qb.Select("system.size_estimates").
+		Columns("table_name", "partitions_count", "mean_partition_size").
+		Where(qb.Eq("keyspace_name")).
+		ToCql()
+
+	var ranges []struct {
+		TableName         string `db:"table_name"`
+		PartitionsCount   int64  `db:"partitions_count"`
+		MeanPartitionSize int64  `db:"mean_partition_size"`
+	}
+	if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+		"keyspace_name": "yelp_logs",
+	}).SelectRelease(&ranges); err != nil {
+		return nil, err
+	}
+
+	estimates := map[string]tableSizeEstimate{}
+	for _, r := range ranges {
+		estimate := estimates[r.TableName]
+		estimate.Partitions += r.PartitionsCount
+		estimate.Bytes += r.PartitionsCount * r.MeanPartitionSize
+		estimates[r.TableName] = estimate
+	}
+	return estimates, nil
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"logging/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"logging/cassandra"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+var businessDailyViewCountsTable = "yelp_logs.business_daily_view_counts"
+var businessDailyReviewViewCountsTable = "yelp_logs.business_daily_review_view_counts"
+var businessDailyViewersTable = "yelp_logs.business_daily_viewers"
+
+// guestUserID is the user ID the review service and the gateway record signed-out visitors under
+const guestUserID = 1
+
+// countedReviewViewsTable holds the views already added to the counters, keyed like reviewViewsTable
+var countedReviewViewsTable = "yelp_logs.counted_review_views"
+
+const (
+	dateLayout        = "2006-01-02"
+	defaultStatsDays  = 7
+	maxStatsDays      = 90
+	defaultTopReviews = 10
+)
+
+// viewDate returns the UTC day bucket a view belongs to
+func viewDate(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// recordBusinessView updates the business-partitioned statistics for a review view.
+// Crawler views only increment bot_views so they never inflate the other figures.
+// A view delivered again, as when a batch is retried, is not counted twice.
+func recordBusinessView(ctx context.Context, log models.ReviewViewLog) error {
+	day := viewDate(log.ViewedAt)
+
+	if !log.IsBot && log.UserID != guestUserID {
+		// The viewer set is idempotent, so it is written on every delivery
+		viewers := qb.Insert(businessDailyViewersTable).Columns("business_id", "view_date", "user_id")
+		if ttl := cassandra.RetentionFor(businessDailyViewersTable).TTL; ttl > 0 {
+			viewers.TTL(ttl)
+		}
+		stmt, names := viewers.ToCql()
+		if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+			"business_id": log.BusinessID,
+			"view_date":   day,
+			"user_id":     log.UserID,
+		}).ExecRelease(); err != nil {
+			return err
+		}
+	}
+
+	claimed, err := claimViewCount(ctx, log)
+	if err != nil || !claimed {
+		return err
+	}
+	if err := incrementViewCounts(ctx, log, day); err != nil {
+		// Let the retry count the view again. A failure after the first increment
+		// can still count it twice there, which is preferred to losing it.
+		if err := releaseViewCount(ctx, log); err != nil {
+			slog.Warn("Failed to release counted review view", "user_id", log.UserID, "review_id", log.ReviewID, "error", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// claimViewCount records that a view is being counted. It returns false when an earlier
+// delivery of the same view already counted it.
+func claimViewCount(ctx context.Context, log models.ReviewViewLog) (bool, error) {
+	claim := qb.Insert(countedReviewViewsTable).Columns("user_id", "viewed_at", "business_id", "review_id").Unique()
+	if ttl := cassandra.RetentionFor(countedReviewViewsTable).TTL; ttl > 0 {
+		claim.TTL(ttl)
+	}
+	stmt, names := claim.ToCql()
+	return cassandra.Session.ContextQuery(ctx, stmt, names).BindStruct(&log).ExecCASRelease()
+}
+
+// releaseViewCount removes the claim of a view whose counters could not be updated
+func releaseViewCount(ctx context.Context, log models.ReviewViewLog) error {
+	stmt, names := qb.Delete(countedReviewViewsTable).
+		Where(qb.Eq("user_id"), qb.Eq("viewed_at"), qb.Eq("business_id"), qb.Eq("review_id")).
+		ToCql()
+	return cassandra.Session.ContextQuery(ctx, stmt, names).BindStruct(&log).ExecRelease()
+}
+
+// incrementViewCounts adds a view to the daily counters of its business
+func incrementViewCounts(ctx context.Context, log models.ReviewViewLog, day time.Time) error {
+	if log.IsBot {
+		stmt, names := qb.Update(businessDailyViewCountsTable).
+			Add("bot_views").
+			Where(qb.Eq("business_id"), qb.Eq("view_date")).
+			ToCql()
+		return cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+			"bot_views":   int64(1),
+			"business_id": log.BusinessID,
+			"view_date":   day,
+		}).ExecRelease()
+	}
+
+	views := qb.Update(businessDailyViewCountsTable).Add("views")
+	if log.UserID == guestUserID {
+		views.Add("guest_views")
+	}
+	stmt, names := views.Where(qb.Eq("business_id"), qb.Eq("view_date")).ToCql()
+	if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+		"views":       int64(1),
+		"guest_views": int64(1),
+		"business_id": log.BusinessID,
+		"view_date":   day,
+	}).ExecRelease(); err != nil {
+		return err
+	}
+
+	stmt, names = qb.Update(businessDailyReviewViewCountsTable).
+		Add("views").
+		Where(qb.Eq("business_id"), qb.Eq("view_date"), qb.Eq("review_id")).
+		ToCql()
+	return cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+		"views":       int64(1),
+		"business_id": log.BusinessID,
+		"view_date":   day,
+		"review_id":   log.ReviewID,
+	}).ExecRelease()
+}
+
+// parseStatsRange reads the from/to query parameters, defaulting to the last seven days
+func parseStatsRange(c *gin.Context) (time.Time, time.Time, bool) {
+	to := viewDate(time.Now())
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := time.Parse(dateLayout, toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -(defaultStatsDays - 1))
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := time.Parse(dateLayout, fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) >= maxStatsDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date range must not exceed " + strconv.Itoa(maxStatsDays) + " days"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	return from, to, true
+}
+
+func GetBusinessViewStats(c *gin.Context) {
+	businessID, err := strconv.Atoi(c.Param("business_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business_id format"})
+		return
+	}
+
+	from, to, ok := parseStatsRange(c)
+	if !ok {
+		return
+	}
+
+	top, err := strconv.Atoi(c.DefaultQuery("top", strconv.Itoa(defaultTopReviews)))
+	if err != nil || top < 1 || top > 100 {
+		top = defaultTopReviews
+	}
+
+	stats := models.BusinessViewStats{
+		BusinessID:  businessID,
+		From:        from.Format(dateLayout),
+		To:          to.Format(dateLayout),
+		ViewsPerDay: []models.DailyViewCount{},
+		TopReviews:  []models.ReviewViewCount{},
+	}
+
+	// Views per day: a single range scan over the business partition
+	stmt, names := qb.Select(businessDailyViewCountsTable).
+		Columns("view_date", "views", "bot_views", "guest_views").
+		Where(qb.Eq("business_id"), qb.GtOrEqNamed("view_date", "from"), qb.LtOrEqNamed("view_date", "to")).
+		OrderBy("view_date", qb.ASC).
+		ToCql()
+
+	var daily []struct {
+		ViewDate   time.Time `db:"view_date"`
+		Views      int64     `db:"views"`
+		BotViews   int64     `db:"bot_views"`
+		GuestViews int64     `db:"guest_views"`
+	}
+	if err := cassandra.Session.ContextQuery(c.Request.Context(), stmt, names).BindMap(map[string]interface{}{
+		"business_id": businessID,
+		"from":        from,
+		"to":          to,
+	}).SelectRelease(&daily); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch view stats"})
+		return
+	}
+
+	for _, d := range daily {
+		stats.BotViews += d.BotViews
+		if d.Views == 0 {
+			// Only crawlers viewed the business that day
+			continue
+		}
+		stats.TotalViews += d.Views
+		stats.GuestViews += d.GuestViews
+		stats.ViewsPerDay = append(stats.ViewsPerDay, models.DailyViewCount{
+			Date:  d.ViewDate.Format(dateLayout),
+			Views: d.Views,
+		})
+	}
+
+	// Unique viewers and top reviews: one partition per day in the range
+	viewers := map[int]struct{}{}
+	reviewViews := map[int]int64{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		key := map[string]interface{}{
+			"business_id": businessID,
+			"view_date":   day,
+		}
+
+		stmt, names := qb.Select(businessDailyViewersTable).
+			Columns("user_id").
+			Where(qb.Eq("business_id"), qb.Eq("view_date")).
+			ToCql()
+		var userIDs []int
+		if err := cassandra.Session.ContextQuery(c.Request.Context(), stmt, names).BindMap(key).SelectRelease(&userIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch view stats"})
+			return
+		}
+		for _, id := range userIDs {
+			// Guest views were recorded as viewers before they were excluded
+			if id != guestUserID {
+				viewers[id] = struct{}{}
+			}
+		}
+
+		stmt, names = qb.Select(businessDailyReviewViewCountsTable).
+			Columns("review_id", "views").
+			Where(qb.Eq("business_id"), qb.Eq("view_date")).
+			ToCql()
+		var counts []struct {
+			ReviewID int   `db:"review_id"`
+			Views    int64 `db:"views"`
+		}
+		if err := cassandra.Session.ContextQuery(c.Request.Context(), stmt, names).BindMap(key).SelectRelease(&counts); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch view stats"})
+			return
+		}
+		for _, count := range counts {
+			reviewViews[count.ReviewID] += count.Views
+		}
+	}
+
+	stats.UniqueViewers = len(viewers)
+
+	for reviewID, views := range reviewViews {
+		stats.TopReviews = append(stats.TopReviews, models.ReviewViewCount{ReviewID: reviewID, Views: views})
+	}
+	sort.Slice(stats.TopReviews, func(i, j int) bool {
+		if stats.TopReviews[i].Views != stats.TopReviews[j].Views {
+			return stats.TopReviews[i].Views > stats.TopReviews[j].Views
+		}
+		return stats.TopReviews[i].ReviewID < stats.TopReviews[j].ReviewID
+	})
+	if len(stats.TopReviews) > top {
+		stats.TopReviews = stats.TopReviews[:top]
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
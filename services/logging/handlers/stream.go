@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"logging/models"
+	"logging/stream"
+	"logging/useragent"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/events"
+	"github.com/yelp-sample-v2/shared/server"
+	"github.com/yelp-sample-v2/shared/tracing"
+)
+
+// streamedEventTypes are the events owners see live on their dashboards
+var streamedEventTypes = map[string]bool{
+	events.TypeBusinessView:  true,
+	events.TypeReviewCreated: true,
+	events.TypeCheckin:       true,
+}
+
+// publishEvent sends a stored event to the streams of its business.
+// Owners see what happened, never who did it.
+func publishEvent(record models.EventRecord) {
+	if record.BusinessID == 0 || !streamedEventTypes[record.EventType] {
+		return
+	}
+	if record.EventType == events.TypeBusinessView && useragent.Parse(record.UserAgent).IsBot {
+		return
+	}
+
+	event := models.StreamEvent{
+		EventID:    record.EventID,
+		Type:       record.EventType,
+		BusinessID: record.BusinessID,
+		OccurredAt: record.OccurredAt,
+	}
+	if record.Payload != "" {
+		event.Payload = json.RawMessage(record.Payload)
+	}
+	if err := stream.Default.Publish(record.EventType, record.BusinessID, event); err != nil {
+		slog.Warn("Failed to publish event to stream", "event_type", record.EventType, "error", err)
+	}
+}
+
+var businessServiceClient = &http.Client{Timeout: 10 * time.Second, Transport: tracing.NewTransport("business-service", nil)}
+
+// ownedBusinessIDs asks the business service which businesses the user owns
+func ownedBusinessIDs(ctx context.Context, userID int) ([]int, error) {
+	businessServiceURL := os.Getenv("BUSINESS_SERVICE_URL")
+	if businessServiceURL == "" {
+		businessServiceURL = "http://business-service:8081"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/internal/users/%d/businesses", businessServiceURL, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := businessServiceClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("business service returned status %d", resp.StatusCode)
+	}
+
+	var owned struct {
+		BusinessIDs []int `json:"business_ids"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&owned); err != nil {
+		return nil, err
+	}
+	return owned.BusinessIDs, nil
+}
+
+// StreamBusinessActivity streams new views, reviews and check-ins of the caller's businesses
+// as Server-Sent Events. Clients resume after a disconnect with Last-Event-ID; if the events
+// since then are no longer buffered, a "reset" event tells them to reload their totals.
+func StreamBusinessActivity(c *gin.Context) {
+	userID, err := strconv.Atoi(c.GetHeader("X-User-ID"))
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	owned, err := ownedBusinessIDs(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to look up owned businesses"})
+		return
+	}
+	if len(owned) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't own any businesses"})
+		return
+	}
+
+	// Optionally narrow the stream to some of the caller's businesses
+	businessIDs := owned
+	if param := c.Query("business_id"); param != "" {
+		isOwned := map[int]bool{}
+		for _, id := range owned {
+			isOwned[id] = true
+		}
+
+		businessIDs = nil
+		for _, s := range strings.Split(param, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business_id"})
+				return
+			}
+			if !isOwned[id] {
+				c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("You don't own business %d", id)})
+				return
+			}
+			businessIDs = append(businessIDs, id)
+		}
+	}
+
+	// Browsers send Last-Event-ID when EventSource reconnects; the query parameter
+	// lets a new page load pick up where the previous one stopped
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	// Streams stay open far longer than the server's write timeout
+	server.WriteDeadline(c, 0)
+
+	sub, backlog, resumed := stream.Default.Subscribe(businessIDs, lastEventID)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !resumed {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, msg := range backlog {
+		writeStreamMessage(w, msg)
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(stream.Default.Config().Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case msg, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind, or shutting down: the client reconnects and resumes
+				return
+			}
+			writeStreamMessage(w, msg)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		w.Flush()
+	}
+}
+
+func writeStreamMessage(w io.Writer, msg stream.Message) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, msg.Data)
+}
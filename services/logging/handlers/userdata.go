@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"logging/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"logging/cassandra"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+// Internal endpoints used by the auth service for data export and erasure.
+// They are not routed through the API gateway.
+
+func ExportUserData(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+	key := map[string]interface{}{"user_id": userID}
+
+	// Every table below is partitioned by user_id, so each export is a single partition read
+	views, err := selectUserViews(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export view history"})
+		return
+	}
+
+	checkins := []models.CheckinLog{}
+	stmt, names := qb.Select(checkinLogsTable).Where(qb.Eq("user_id")).ToCql()
+	if err := cassandra.Session.ContextQuery(c.Request.Context(), stmt, names).BindMap(key).SelectRelease(&checkins); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export check-in logs"})
+		return
+	}
+
+	records := []models.EventRecord{}
+	stmt, names = qb.Select(eventsByUserTable).Where(qb.Eq("user_id")).ToCql()
+	if err := cassandra.Session.ContextQuery(c.Request.Context(), stmt, names).BindMap(key).SelectRelease(&records); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"review_views": views,
+		"checkins":     checkins,
+		"events":       records,
+	})
+}
+
+// EraseUserData deletes the user's logs. Rows in the business- and type-partitioned tables
+// are located through the user's own partitions, which are deleted last so a failed
+// erasure can be retried. Counters hold no user identifiers and are kept.
+func EraseUserData(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	if err := eraseUserEvents(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase events"})
+		return
+	}
+	if err := eraseUserViewers(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase viewer statistics"})
+		return
+	}
+
+	for _, table := range []string{reviewViewsTable, legacyReviewViewLogsTable, countedReviewViewsTable, checkinLogsTable, eventsByUserTable} {
+		stmt, names := qb.Delete(table).Where(qb.Eq("user_id")).ToCql()
+		if err := cassandra.Session.ContextQuery(c.Request.Context(), stmt, names).BindMap(map[string]interface{}{
+			"user_id": userID,
+		}).ExecRelease(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase logs"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"erased": true})
+}
+
+// selectUserViews reads the user's review views from the current and the legacy table
+func selectUserViews(ctx context.Context, userID int, columns ...string) ([]models.ReviewViewLog, error) {
+	views := []models.ReviewViewLog{}
+	for _, table := range []string{reviewViewsTable, legacyReviewViewLogsTable} {
+		stmt, names := qb.Select(table).Columns(columns...).Where(qb.Eq("user_id")).ToCql()
+
+		var rows []models.ReviewViewLog
+		if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+			"user_id": userID,
+		}).SelectRelease(&rows); err != nil {
+			return nil, err
+		}
+		views = append(views, rows...)
+	}
+	return views, nil
+}
+
+// eraseUserEvents deletes the copies of the user's events in the events_by_type tables and events_by_business
+func eraseUserEvents(ctx context.Context, userID int) error {
+	stmt, names := qb.Select(eventsByUserTable).
+		Columns("event_id", "event_type", "occurred_at", "business_id").
+		Where(qb.Eq("user_id")).
+		ToCql()
+
+	var records []models.EventRecord
+	if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+		"user_id": userID,
+	}).SelectRelease(&records); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		record.EventDate = viewDate(record.OccurredAt)
+		record.Bucket = eventBucket(record.EventID)
+
+		stmt, names := qb.Delete(eventsByTypeTable).
+			Where(qb.Eq("event_type"), qb.Eq("event_date"), qb.Eq("bucket"), qb.Eq("occurred_at"), qb.Eq("event_id")).
+			ToCql()
+		if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindStruct(&record).ExecRelease(); err != nil {
+			return err
+		}
+
+		stmt, names = qb.Delete(legacyEventsByTypeTable).
+			Where(qb.Eq("event_type"), qb.Eq("event_date"), qb.Eq("occurred_at"), qb.Eq("event_id")).
+			ToCql()
+		if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindStruct(&record).ExecRelease(); err != nil {
+			return err
+		}
+
+		if record.BusinessID == 0 {
+			continue
+		}
+		stmt, names = qb.Delete(eventsByBusinessTable).
+			Where(qb.Eq("business_id"), qb.Eq("event_date"), qb.Eq("occurred_at"), qb.Eq("event_id")).
+			ToCql()
+		if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindStruct(&record).ExecRelease(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eraseUserViewers removes the user from the per-day unique viewer sets of the businesses they viewed
+func eraseUserViewers(ctx context.Context, userID int) error {
+	views, err := selectUserViews(ctx, userID, "business_id", "viewed_at")
+	if err != nil {
+		return err
+	}
+
+	type viewerKey struct {
+		businessID int
+		day        time.Time
+	}
+	seen := map[viewerKey]bool{}
+
+	for _, view := range views {
+		key := viewerKey{businessID: view.BusinessID, day: viewDate(view.ViewedAt)}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		stmt, names := qb.Delete(businessDailyViewersTable).
+			Where(qb.Eq("business_id"), qb.Eq("view_date"), qb.Eq("user_id")).
+			ToCql()
+		if err := cassandra.Session.ContextQuery(ctx, stmt, names).BindMap(map[string]interface{}{
+			"business_id": key.businessID,
+			"view_date":   key.day,
+			"user_id":     userID,
+		}).ExecRelease(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
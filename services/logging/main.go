@@ -1,33 +1,55 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
 
+	"logging/anonymize"
 	"logging/cassandra"
 	"logging/handlers"
+	"logging/stream"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/health"
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/metrics"
+	"github.com/yelp-sample-v2/shared/server"
+	"github.com/yelp-sample-v2/shared/tracing"
 )
 
 func main() {
+	// Log JSON to stdout, at LOG_LEVEL and above
+	logger.Start(logger.ConfigFromEnv("logging-service"))
+
+	// Trace requests, including their database queries and calls to other services
+	if err := tracing.Start(tracing.ConfigFromEnv("logging-service")); err != nil {
+		logger.Fatal("Failed to start tracing", "error", err)
+	}
+
 	// Connect to Cassandra
 	if err := cassandra.Connect(); err != nil {
-		log.Fatal("Failed to connect to Cassandra:", err)
+		logger.Fatal("Failed to connect to Cassandra", "error", err)
 	}
-	defer cassandra.Close()
 
 	// Run migrations
 	if err := cassandra.AutoMigrate(); err != nil {
-		log.Fatal("Failed to run migrations:", err)
+		logger.Fatal("Failed to run migrations", "error", err)
 	}
 
+	// Apply per-table TTLs to new rows
+	cassandra.LoadRetention()
+
+	// Anonymize client IPs before they are persisted
+	anonymize.Default = anonymize.New(anonymize.ConfigFromEnv())
+
+	// Buffer recent events for owners resuming their live streams
+	stream.Default = stream.New(stream.ConfigFromEnv())
+
 	// Setup Gin
-	r := gin.Default()
+	r := gin.New()
+	r.Use(tracing.Middleware(), logger.Middleware("X-User-ID"), metrics.Middleware(), logger.Recovery())
+	srv := server.New(server.ConfigFromEnv("8083"), r)
 
 	// Health check endpoint
 	r.GET("/", func(c *gin.Context) {
@@ -38,35 +60,51 @@ func main() {
 
 	r.GET("/health", handlers.HealthCheck)
 
-	r.GET("/ready", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ready",
-		})
-	})
+	// Ready while Cassandra answers
+	checks := health.New(health.ConfigFromEnv())
+	checks.Critical("cassandra", cassandra.Ping)
+	r.GET("/ready", srv.CheckReady, checks.Ready)
+
+	// Prometheus metrics
+	r.GET("/metrics", metrics.Handler())
 
 	// Logging endpoints
 	r.POST("/logs/review-view", handlers.LogReviewView)
+	r.POST("/logs/review-views:action", handlers.ReviewViewsAction)
+
+	// View history of a user and view statistics of a business
 	r.GET("/logs/user/:user_id/history", handlers.GetUserViewHistory)
 	r.GET("/logs/business/:business_id/stats", handlers.GetBusinessViewStats)
 
-	// Get port from environment
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8083"
-	}
+	// Generic event ingestion
+	r.POST("/events", handlers.IngestEvents)
+
+	// Live activity of the caller's businesses (Server-Sent Events)
+	r.GET("/stream/businesses", handlers.StreamBusinessActivity)
+
+	// Admin endpoints
+	r.GET("/admin/retention", handlers.GetRetention)
 
-	// Setup graceful shutdown
-	go func() {
-		fmt.Printf("Logging service starting on port %s\n", port)
-		if err := r.Run(":" + port); err != nil && err != http.ErrServerClosed {
-			log.Fatal("Failed to start server:", err)
-		}
-	}()
+	// Internal routes for user data export and erasure (not exposed by the gateway)
+	r.GET("/internal/users/:id/data", handlers.ExportUserData)
+	r.DELETE("/internal/users/:id/data", handlers.EraseUserData)
 
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Internal event counts read by the business service's analytics rollups
+	r.GET("/internal/events/counts", handlers.CountEvents)
 
-	log.Println("Logging service shutting down...")
+	// Live streams never finish on their own; end them so in-flight requests can drain.
+	// Clients reconnect and resume with Last-Event-ID.
+	srv.HTTP.RegisterOnShutdown(stream.Default.Close)
+
+	// Once in-flight requests finish, deliver buffered spans and close the Cassandra session
+	srv.OnShutdown("cassandra", func(context.Context) error {
+		cassandra.Close()
+		return nil
+	})
+	srv.OnShutdown("tracing", tracing.Close)
+
+	slog.Info("Logging service starting", "addr", srv.HTTP.Addr)
+	if err := srv.Run(); err != nil {
+		logger.Fatal("Failed to start server", "error", err)
+	}
 }
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ViewHistoryGroup summarizes the views on one page that share a business or a day
+type ViewHistoryGroup struct {
+	BusinessID    int       `json:"business_id,omitempty"`
+	Date          string    `json:"date,omitempty"`
+	ViewCount     int       `json:"view_count"`
+	ReviewIDs     []int     `json:"review_ids"`
+	FirstViewedAt time.Time `json:"first_viewed_at"`
+	LastViewedAt  time.Time `json:"last_viewed_at"`
+}
+
+type ViewHistoryResponse struct {
+	UserID  int             `json:"user_id"`
+	Views   []ReviewViewLog `json:"views"`
+	GroupBy string          `json:"group_by,omitempty"`
+	// Groups cover the views on this page only
+	Groups     []ViewHistoryGroup `json:"groups,omitempty"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
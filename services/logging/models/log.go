@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -9,19 +10,94 @@ type ReviewViewLog struct {
 	BusinessID int       `db:"business_id" json:"business_id"`
 	ReviewID   int       `db:"review_id" json:"review_id"`
 	ViewedAt   time.Time `db:"viewed_at" json:"viewed_at"`
-	IPAddress  string    `db:"ip_address" json:"ip_address"`
+	IPAddress  string    `db:"ip_address" json:"ip_address"` // 匿名化済み（切り詰めまたはハッシュ）
 	UserAgent  string    `db:"user_agent" json:"user_agent"`
+	Browser    string    `db:"browser" json:"browser"`
+	OS         string    `db:"os" json:"os"`
+	DeviceType string    `db:"device_type" json:"device_type"`
+	IsBot      bool      `db:"is_bot" json:"is_bot"`
 }
 
 type LogRequest struct {
-	UserID     int    `json:"user_id"` // PostgreSQLのusers.idと一致する整数型
-	BusinessID int    `json:"business_id"`
-	ReviewID   int    `json:"review_id"`
-	IPAddress  string `json:"ip_address"`
-	UserAgent  string `json:"user_agent"`
+	UserID     int        `json:"user_id"` // PostgreSQLのusers.idと一致する整数型
+	BusinessID int        `json:"business_id"`
+	ReviewID   int        `json:"review_id"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	ViewedAt   *time.Time `json:"viewed_at"` // 省略時は受信時刻（バッファリングするクライアントは閲覧時刻を送る）
+}
+
+type BatchLogRequest struct {
+	Events []LogRequest `json:"events" binding:"required,min=1,max=500,dive"`
+}
+
+type BatchLogResponse struct {
+	Success  bool  `json:"success"`
+	Accepted int   `json:"accepted"`
+	Failed   []int `json:"failed"` // Indexes of events that could not be stored
+}
+
+type CheckinLog struct {
+	UserID         int       `db:"user_id" json:"user_id"`
+	BusinessID     int       `db:"business_id" json:"business_id"`
+	CheckinID      int       `db:"checkin_id" json:"checkin_id"`
+	CheckedInAt    time.Time `db:"checked_in_at" json:"checked_in_at"`
+	DistanceMeters float64   `db:"distance_meters" json:"distance_meters"`
+	IPAddress      string    `db:"ip_address" json:"ip_address"`
+	UserAgent      string    `db:"user_agent" json:"user_agent"`
 }
 
 type LogResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 }
+
+// EventRecord is an event as stored in the events_by_* tables
+type EventRecord struct {
+	EventID   string    `db:"event_id" json:"event_id"`
+	EventType string    `db:"event_type" json:"event_type"`
+	EventDate time.Time `db:"event_date" json:"-"`
+	// Bucket spreads the events of a type and day over several partitions
+	Bucket     int       `db:"bucket" json:"-"`
+	Version    int       `db:"version" json:"version"`
+	OccurredAt time.Time `db:"occurred_at" json:"occurred_at"`
+	Source     string    `db:"source" json:"source"`
+	UserID     int       `db:"user_id" json:"user_id"`
+	BusinessID int       `db:"business_id" json:"business_id,omitempty"`
+	IPAddress  string    `db:"ip_address" json:"ip_address,omitempty"`
+	UserAgent  string    `db:"user_agent" json:"user_agent,omitempty"`
+	Payload    string    `db:"payload" json:"payload,omitempty"`
+}
+
+type EventRejection struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type IngestEventsResponse struct {
+	Success  bool             `json:"success"`
+	Accepted int              `json:"accepted"`
+	Rejected []EventRejection `json:"rejected"`
+	Failed   []int            `json:"failed"` // Valid events that could not be stored
+}
+
+type BusinessEventCount struct {
+	BusinessID int   `json:"business_id"`
+	Count      int64 `json:"count"`
+}
+
+type EventCountsResponse struct {
+	Type   string               `json:"type"`
+	From   time.Time            `json:"from"`
+	To     time.Time            `json:"to"`
+	Counts []BusinessEventCount `json:"counts"`
+}
+
+// StreamEvent is the data of an event on a business activity stream. It carries no user identifiers.
+type StreamEvent struct {
+	EventID    string          `json:"event_id"`
+	Type       string          `json:"type"`
+	BusinessID int             `json:"business_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
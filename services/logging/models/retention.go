@@ -0,0 +1,21 @@
+package models
+
+type TableRetention struct {
+	Table         string   `json:"table"`
+	Expires       bool     `json:"expires"`
+	TTLSeconds    int64    `json:"ttl_seconds"`
+	PIIColumns    []string `json:"pii_columns"`
+	PIITTLSeconds int64    `json:"pii_ttl_seconds,omitempty"`
+	// Counter tables can't be written with a TTL
+	Counter             bool  `json:"counter"`
+	EstimatedPartitions int64 `json:"estimated_partitions"`
+	EstimatedBytes      int64 `json:"estimated_bytes"`
+}
+
+type RetentionReport struct {
+	Keyspace string `json:"keyspace"`
+	// EstimatesAvailable is false when system.size_estimates could not be read
+	EstimatesAvailable bool             `json:"estimates_available"`
+	EstimatedBytes     int64            `json:"estimated_bytes"`
+	Tables             []TableRetention `json:"tables"`
+}
@@ -0,0 +1,25 @@
+package models
+
+type DailyViewCount struct {
+	Date  string `json:"date"`
+	Views int64  `json:"views"`
+}
+
+type ReviewViewCount struct {
+	ReviewID int   `json:"review_id"`
+	Views    int64 `json:"views"`
+}
+
+type BusinessViewStats struct {
+	BusinessID int    `json:"business_id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	TotalViews int64  `json:"total_views"`
+	BotViews   int64  `json:"bot_views"` // Views by known crawlers, excluded from every other figure
+	// GuestViews are the views by signed-out visitors. They are part of TotalViews but
+	// not of UniqueViewers, since guests share one user ID and can't be told apart.
+	GuestViews    int64             `json:"guest_views"`
+	UniqueViewers int               `json:"unique_viewers"` // Signed-in users only
+	ViewsPerDay   []DailyViewCount  `json:"views_per_day"`
+	TopReviews    []ReviewViewCount `json:"top_reviews"`
+}
@@ -0,0 +1,213 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// BufferSize is how many recent messages are kept for clients resuming with Last-Event-ID
+	BufferSize int
+	// SubscriberBuffer is how many messages may queue for one client before it is dropped
+	SubscriberBuffer int
+	// Heartbeat is how often an idle stream sends a comment to keep proxies from closing it
+	Heartbeat time.Duration
+}
+
+// ConfigFromEnv reads STREAM_BUFFER_SIZE, STREAM_SUBSCRIBER_BUFFER and STREAM_HEARTBEAT
+func ConfigFromEnv() Config {
+	cfg := Config{BufferSize: 1000, SubscriberBuffer: 64, Heartbeat: 15 * time.Second}
+	if n, err := strconv.Atoi(os.Getenv("STREAM_BUFFER_SIZE")); err == nil && n > 0 {
+		cfg.BufferSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("STREAM_SUBSCRIBER_BUFFER")); err == nil && n > 0 {
+		cfg.SubscriberBuffer = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("STREAM_HEARTBEAT")); err == nil && d > 0 {
+		cfg.Heartbeat = d
+	}
+	return cfg
+}
+
+// Message is one event published to the stream of a business
+type Message struct {
+	// ID is "<epoch>-<sequence>". The epoch changes when the process restarts,
+	// so an ID from a previous process is never mistaken for a current one.
+	ID         string
+	Type       string
+	BusinessID int
+	Data       []byte
+
+	seq uint64
+}
+
+// Hub fans messages out to the subscribers of each business and keeps a ring buffer
+// of recent messages so clients can resume after reconnecting.
+type Hub struct {
+	cfg   Config
+	epoch string
+
+	mu          sync.Mutex
+	seq         uint64
+	buffer      []Message
+	next        int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Default is the hub events are published to at ingestion
+var Default = New(Config{BufferSize: 1000, SubscriberBuffer: 64, Heartbeat: 15 * time.Second})
+
+func New(cfg Config) *Hub {
+	return &Hub{
+		cfg:         cfg,
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		buffer:      make([]Message, 0, cfg.BufferSize),
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+func (h *Hub) Config() Config {
+	return h.cfg
+}
+
+// Subscription receives the messages of a set of businesses on C. C is closed when the
+// subscriber falls too far behind or the hub shuts down; the client should reconnect.
+type Subscription struct {
+	C <-chan Message
+
+	c          chan Message
+	businesses map[int]bool
+	hub        *Hub
+}
+
+// Publish sends an event to the subscribers of its business
+func (h *Hub) Publish(eventType string, businessID int, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+
+	h.seq++
+	msg := Message{
+		ID:         fmt.Sprintf("%s-%d", h.epoch, h.seq),
+		Type:       eventType,
+		BusinessID: businessID,
+		Data:       encoded,
+		seq:        h.seq,
+	}
+
+	if len(h.buffer) < h.cfg.BufferSize {
+		h.buffer = append(h.buffer, msg)
+	} else {
+		h.buffer[h.next] = msg
+		h.next = (h.next + 1) % h.cfg.BufferSize
+	}
+
+	for sub := range h.subscribers {
+		if !sub.businesses[businessID] {
+			continue
+		}
+		select {
+		case sub.c <- msg:
+		default:
+			// A slow client must not hold up everyone else; it resumes from the buffer
+			h.drop(sub)
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a subscriber for the given businesses. When lastEventID is set, the
+// buffered messages after it are returned as a backlog; resumed is false if they are no
+// longer buffered (or the ID is from another process) and the client missed events.
+func (h *Hub) Subscribe(businessIDs []int, lastEventID string) (sub *Subscription, backlog []Message, resumed bool) {
+	c := make(chan Message, h.cfg.SubscriberBuffer)
+	sub = &Subscription{C: c, c: c, businesses: map[int]bool{}, hub: h}
+	for _, id := range businessIDs {
+		sub.businesses[id] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(c)
+		return sub, nil, true
+	}
+	h.subscribers[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+
+	last, ok := h.parseID(lastEventID)
+	if !ok || last > h.seq {
+		return sub, nil, false
+	}
+
+	ordered := h.ordered()
+	// The buffer is contiguous, so nothing was lost if it starts right after the last ID
+	resumed = len(ordered) == 0 || ordered[0].seq <= last+1
+	for _, msg := range ordered {
+		if msg.seq > last && sub.businesses[msg.BusinessID] {
+			backlog = append(backlog, msg)
+		}
+	}
+	return sub, backlog, resumed
+}
+
+// Close unregisters the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.drop(s)
+}
+
+// Close disconnects every subscriber; later publishes are ignored
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subscribers {
+		h.drop(sub)
+	}
+}
+
+// drop removes a subscriber and closes its channel. h.mu must be held.
+func (h *Hub) drop(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.c)
+	}
+}
+
+// ordered returns the buffered messages oldest first. h.mu must be held.
+func (h *Hub) ordered() []Message {
+	if len(h.buffer) < h.cfg.BufferSize {
+		return h.buffer
+	}
+	ordered := make([]Message, 0, len(h.buffer))
+	ordered = append(ordered, h.buffer[h.next:]...)
+	return append(ordered, h.buffer[:h.next]...)
+}
+
+func (h *Hub) parseID(id string) (uint64, bool) {
+	epoch, seq, found := strings.Cut(id, "-")
+	if !found || epoch != h.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
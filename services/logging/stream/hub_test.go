@@ -0,0 +1,164 @@
+package stream
+
+import (
+	"testing"
+	"time"
+)
+
+// publish publishes one message per business and returns them as a subscriber of
+// every business sees them
+func publish(t *testing.T, h *Hub, businessIDs ...int) []Message {
+	t.Helper()
+	all := map[int]bool{}
+	for _, id := range businessIDs {
+		all[id] = true
+	}
+	ids := make([]int, 0, len(all))
+	for id := range all {
+		ids = append(ids, id)
+	}
+	watcher, _, _ := h.Subscribe(ids, "")
+	defer watcher.Close()
+
+	var msgs []Message
+	for _, id := range businessIDs {
+		if err := h.Publish("review_view", id, map[string]int{"business_id": id}); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, <-watcher.C)
+	}
+	return msgs
+}
+
+func seqs(msgs []Message) []uint64 {
+	var s []uint64
+	for _, msg := range msgs {
+		s = append(s, msg.seq)
+	}
+	return s
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSubscribeReceivesOnlyItsBusinesses(t *testing.T) {
+	h := New(Config{BufferSize: 10, SubscriberBuffer: 10})
+	sub, backlog, resumed := h.Subscribe([]int{1, 3}, "")
+	defer sub.Close()
+	if backlog != nil || !resumed {
+		t.Fatalf("new subscription got backlog %v, resumed %v", backlog, resumed)
+	}
+
+	publish(t, h, 1, 2, 3)
+	for _, want := range []int{1, 3} {
+		select {
+		case msg := <-sub.C:
+			if msg.BusinessID != want {
+				t.Errorf("got a message of business %d, want %d", msg.BusinessID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no message for business %d", want)
+		}
+	}
+	select {
+	case msg := <-sub.C:
+		t.Errorf("got a message of business %d it didn't subscribe to", msg.BusinessID)
+	default:
+	}
+}
+
+func TestSubscribeResumesAfterLastEventID(t *testing.T) {
+	h := New(Config{BufferSize: 5, SubscriberBuffer: 10})
+	msgs := publish(t, h, 1, 2, 1, 1)
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []uint64
+	}{
+		{"from the first message", msgs[0].ID, []uint64{3, 4}},
+		{"from a message of another business", msgs[1].ID, []uint64{3, 4}},
+		{"from the latest message", msgs[3].ID, nil},
+	}
+	for _, tt := range tests {
+		sub, backlog, resumed := h.Subscribe([]int{1}, tt.lastEventID)
+		sub.Close()
+		if !resumed || !equalSeqs(seqs(backlog), tt.want) {
+			t.Errorf("%s: backlog %v, resumed %v; want %v, resumed", tt.name, seqs(backlog), resumed, tt.want)
+		}
+	}
+}
+
+func TestSubscribeResetsWhenEventsWereMissed(t *testing.T) {
+	h := New(Config{BufferSize: 5, SubscriberBuffer: 10})
+	// The buffer keeps messages 6 to 10
+	msgs := publish(t, h, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1)
+	other := New(Config{BufferSize: 5, SubscriberBuffer: 10})
+	otherMsgs := publish(t, other, 1)
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []uint64
+		wantResumed bool
+	}{
+		// Message 5 is gone but everything after it is buffered
+		{"just before the buffer", msgs[4].ID, []uint64{6, 7, 8, 9, 10}, true},
+		{"older than the buffer", msgs[1].ID, []uint64{6, 7, 8, 9, 10}, false},
+		{"from another process", otherMsgs[0].ID, nil, false},
+		{"from the future", h.epoch + "-11", nil, false},
+		{"malformed", "yesterday", nil, false},
+		{"malformed sequence", h.epoch + "-x", nil, false},
+	}
+	for _, tt := range tests {
+		sub, backlog, resumed := h.Subscribe([]int{1}, tt.lastEventID)
+		sub.Close()
+		if resumed != tt.wantResumed || !equalSeqs(seqs(backlog), tt.want) {
+			t.Errorf("%s: backlog %v, resumed %v; want %v, resumed %v", tt.name, seqs(backlog), resumed, tt.want, tt.wantResumed)
+		}
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	h := New(Config{BufferSize: 10, SubscriberBuffer: 1})
+	slow, _, _ := h.Subscribe([]int{1}, "")
+	for i := 0; i < 2; i++ {
+		if err := h.Publish("review_view", 1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := <-slow.C; !ok {
+		t.Fatal("the queued message was lost")
+	}
+	if _, ok := <-slow.C; ok {
+		t.Fatal("subscriber that fell behind got the message it had no room for")
+	}
+	// Closing it again is harmless
+	slow.Close()
+}
+
+func TestCloseDisconnectsSubscribers(t *testing.T) {
+	h := New(Config{BufferSize: 10, SubscriberBuffer: 10})
+	sub, _, _ := h.Subscribe([]int{1}, "")
+	h.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription still open after the hub closed")
+	}
+
+	if err := h.Publish("review_view", 1, nil); err != nil {
+		t.Errorf("Publish after Close: %v", err)
+	}
+	late, backlog, _ := h.Subscribe([]int{1}, "")
+	if _, ok := <-late.C; ok || backlog != nil {
+		t.Error("subscription made after Close is open")
+	}
+}
@@ -0,0 +1,152 @@
+package useragent
+
+import "strings"
+
+// Device types
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+const unknown = "Other"
+
+// Info is what is kept from a user-agent string
+type Info struct {
+	Browser    string `json:"browser"` // The crawler name for bots
+	OS         string `json:"os"`
+	DeviceType string `json:"device_type"`
+	IsBot      bool   `json:"is_bot"`
+}
+
+type pattern struct {
+	token string
+	name  string
+}
+
+// knownBots are matched first, case-insensitively
+var knownBots = []pattern{
+	{"googlebot", "Googlebot"},
+	{"adsbot-google", "Googlebot"},
+	{"bingbot", "Bingbot"},
+	{"yahoo! slurp", "Yahoo Slurp"},
+	{"duckduckbot", "DuckDuckBot"},
+	{"baiduspider", "Baiduspider"},
+	{"yandexbot", "YandexBot"},
+	{"applebot", "Applebot"},
+	{"facebookexternalhit", "Facebook"},
+	{"twitterbot", "Twitterbot"},
+	{"linkedinbot", "LinkedInBot"},
+	{"slackbot", "Slackbot"},
+	{"ahrefsbot", "AhrefsBot"},
+	{"semrushbot", "SemrushBot"},
+	{"petalbot", "PetalBot"},
+	{"gptbot", "GPTBot"},
+	{"ccbot", "CCBot"},
+	{"headlesschrome", "HeadlessChrome"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+	{"python-requests", "python-requests"},
+	{"go-http-client", "Go-http-client"},
+}
+
+// genericBotTokens catch crawlers that are not listed by name
+var genericBotTokens = []string{"bot", "crawler", "spider", "crawl", "scraper"}
+
+// browsers are checked in order; several browsers also claim to be Chrome or Safari
+var browsers = []pattern{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"MSIE ", "Internet Explorer"},
+	{"Trident/", "Internet Explorer"},
+}
+
+var operatingSystems = []pattern{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"iPod", "iOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// Parse extracts the browser, OS, device type and bot flag from a user-agent string
+func Parse(ua string) Info {
+	if strings.TrimSpace(ua) == "" {
+		return Info{Browser: unknown, OS: unknown, DeviceType: DeviceUnknown}
+	}
+
+	info := Info{Browser: unknown, OS: unknown}
+	for _, system := range operatingSystems {
+		if strings.Contains(ua, system.token) {
+			info.OS = system.name
+			break
+		}
+	}
+
+	lower := strings.ToLower(ua)
+	if name, ok := botName(lower); ok {
+		info.Browser = name
+		info.DeviceType = DeviceBot
+		info.IsBot = true
+		return info
+	}
+
+	info.Browser = browserName(ua)
+	info.DeviceType = deviceType(ua, info.OS)
+	return info
+}
+
+func botName(lower string) (string, bool) {
+	for _, bot := range knownBots {
+		if strings.Contains(lower, bot.token) {
+			return bot.name, true
+		}
+	}
+	for _, token := range genericBotTokens {
+		if strings.Contains(lower, token) {
+			return "Other bot", true
+		}
+	}
+	return "", false
+}
+
+func browserName(ua string) string {
+	for _, browser := range browsers {
+		if strings.Contains(ua, browser.token) {
+			return browser.name
+		}
+	}
+	if strings.Contains(ua, "Safari/") {
+		return "Safari"
+	}
+	return unknown
+}
+
+func deviceType(ua string, system string) string {
+	switch {
+	case system == "iPadOS" || strings.Contains(ua, "Tablet"):
+		return DeviceTablet
+	case system == "Android" && !strings.Contains(ua, "Mobile"):
+		// Android tablets omit "Mobile"
+		return DeviceTablet
+	case strings.Contains(ua, "Mobi") || system == "iOS" || system == "Android":
+		return DeviceMobile
+	case system == "Windows" || system == "macOS" || system == "Linux" || system == "ChromeOS":
+		return DeviceDesktop
+	default:
+		return DeviceUnknown
+	}
+}
@@ -0,0 +1,89 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			"Chrome on Windows",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			Info{Browser: "Chrome", OS: "Windows", DeviceType: DeviceDesktop},
+		},
+		{
+			"Edge claims Chrome",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			Info{Browser: "Edge", OS: "Windows", DeviceType: DeviceDesktop},
+		},
+		{
+			"Safari on macOS",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+			Info{Browser: "Safari", OS: "macOS", DeviceType: DeviceDesktop},
+		},
+		{
+			"Firefox on Linux",
+			"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			Info{Browser: "Firefox", OS: "Linux", DeviceType: DeviceDesktop},
+		},
+		{
+			"Safari on iPhone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			Info{Browser: "Safari", OS: "iOS", DeviceType: DeviceMobile},
+		},
+		{
+			"Chrome on iPad",
+			"Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1",
+			Info{Browser: "Chrome", OS: "iPadOS", DeviceType: DeviceTablet},
+		},
+		{
+			"Samsung Internet on an Android phone",
+			"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+			Info{Browser: "Samsung Internet", OS: "Android", DeviceType: DeviceMobile},
+		},
+		{
+			"Android tablet without Mobile",
+			"Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			Info{Browser: "Chrome", OS: "Android", DeviceType: DeviceTablet},
+		},
+		{
+			"Googlebot",
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			Info{Browser: "Googlebot", OS: unknown, DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			"mobile Googlebot keeps its OS",
+			"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			Info{Browser: "Googlebot", OS: "Android", DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			"curl",
+			"curl/8.5.0",
+			Info{Browser: "curl", OS: unknown, DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			"unnamed crawler",
+			"ExampleCrawler/1.0 (+https://example.com/crawler)",
+			Info{Browser: "Other bot", OS: unknown, DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			"unrecognized",
+			"SomeApp/3.2",
+			Info{Browser: unknown, OS: unknown, DeviceType: DeviceUnknown},
+		},
+		{
+			"empty",
+			"  ",
+			Info{Browser: unknown, OS: unknown, DeviceType: DeviceUnknown},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.ua); got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.ua, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package feed
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yelp-sample-v2/shared/models"
+	"gorm.io/gorm"
+)
+
+// backfillLimit is how many recent activities of a newly followed user are copied into the follower's feed
+const backfillLimit = 20
+
+// FanOut materializes an activity into the feed of every follower of the actor and of every
+// user who bookmarked the business. It runs as a single INSERT ... SELECT so the cost stays in
+// the database no matter how many followers the actor has, and reading a feed is a plain
+// index range scan on (user_id, created_at, id).
+func FanOut(db *gorm.DB, kind string, actorID, businessID, subjectID uint, at time.Time) error {
+	return db.Exec(`
+		INSERT INTO feed_items (user_id, actor_id, kind, business_id, subject_id, created_at)
+		SELECT recipients.user_id, ?, ?, ?, ?, ?
+		FROM (
+			SELECT follower_id AS user_id FROM follows WHERE followee_id = ?
+			UNION
+			SELECT collections.user_id FROM collection_items
+			JOIN collections ON collections.id = collection_items.collection_id
+			WHERE collection_items.business_id = ? AND collections.deleted_at IS NULL
+		) AS recipients
+		WHERE recipients.user_id <> ?`,
+		actorID, kind, businessID, subjectID, at,
+		actorID,
+		businessID,
+		actorID,
+	).Error
+}
+
+// Backfill copies the most recent reviews of followeeID into followerID's feed
+func Backfill(db *gorm.DB, followerID, followeeID uint) error {
+	return db.Exec(`
+		INSERT INTO feed_items (user_id, actor_id, kind, business_id, subject_id, created_at)
+		SELECT ?, user_id, ?, business_id, id, created_at
+		FROM reviews
+		WHERE user_id = ? AND deleted_at IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM feed_items
+			WHERE feed_items.user_id = ? AND feed_items.kind = ? AND feed_items.subject_id = reviews.id
+		)
+		ORDER BY created_at DESC
+		LIMIT ?`,
+		followerID, models.FeedKindReview, followeeID,
+		followerID, models.FeedKindReview,
+		backfillLimit,
+	).Error
+}
+
+// Remove deletes what actorID contributed to userID's feed when userID stops following them.
+// Items about businesses in userID's collections stay, as they would have been fanned out anyway.
+func Remove(db *gorm.DB, userID, actorID uint) error {
+	return db.Where("user_id = ? AND actor_id = ?", userID, actorID).
+		Where(`business_id NOT IN (
+			SELECT collection_items.business_id FROM collection_items
+			JOIN collections ON collections.id = collection_items.collection_id
+			WHERE collections.user_id = ? AND collections.deleted_at IS NULL)`, userID).
+		Delete(&models.FeedItem{}).Error
+}
+
+// Cursor is a position in a feed, ordered by (created_at, id) descending
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode returns the opaque string form of the cursor
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Encode
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{CreatedAt: time.Unix(0, nanos), ID: uint(id)}, nil
+}
+
+// Page reads up to limit feed items for userID that come after the cursor.
+// The returned cursor is nil when there are no more items.
+func Page(db *gorm.DB, userID uint, after *Cursor, limit int) ([]models.FeedItem, *Cursor, error) {
+	query := db.Where("user_id = ?", userID)
+	if after != nil {
+		query = query.Where("(created_at, id) < (?, ?)", after.CreatedAt, after.ID)
+	}
+
+	var items []models.FeedItem
+	if err := query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&items).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if len(items) <= limit {
+		return items, nil, nil
+	}
+
+	items = items[:limit]
+	last := items[len(items)-1]
+	return items, &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"review/database"
+	"strconv"
+	"time"
+
+	"github.com/yelp-sample-v2/shared/events"
+	"github.com/yelp-sample-v2/shared/geo"
+	"github.com/yelp-sample-v2/shared/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errCheckinCooldown = errors.New("checked in within the cooldown")
+
+type CheckinRequest struct {
+	Latitude  *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+}
+
+// CheckinStats is the aggregate check-in activity of a business
+type CheckinStats struct {
+	BusinessID     uint  `json:"business_id"`
+	TotalCheckins  int64 `json:"total_checkins"`
+	UniqueVisitors int64 `json:"unique_visitors"`
+}
+
+// getCheckinRadius returns how far from the business a check-in may be, in meters
+func getCheckinRadius() float64 {
+	if radius, err := strconv.ParseFloat(os.Getenv("CHECKIN_RADIUS_METERS"), 64); err == nil && radius > 0 {
+		return radius
+	}
+	return 200
+}
+
+// getCheckinCooldown returns the minimum time between two check-ins by the same user at the same business
+func getCheckinCooldown() time.Duration {
+	if cooldown, err := time.ParseDuration(os.Getenv("CHECKIN_COOLDOWN")); err == nil && cooldown >= 0 {
+		return cooldown
+	}
+	return time.Hour
+}
+
+func CreateCheckin(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var business models.Business
+	if err := database.DB.WithContext(c.Request.Context()).First(&business, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business not found"})
+		return
+	}
+
+	var req CheckinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Geofence: the client must be within the configured radius of the business
+	distance := geo.DistanceMeters(*req.Latitude, *req.Longitude, business.Latitude, business.Longitude)
+	radius := getCheckinRadius()
+	if distance > radius {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":           "You are too far from this business to check in",
+			"distance_meters": math.Round(distance),
+			"radius_meters":   radius,
+		})
+		return
+	}
+
+	// Rate limit: one check-in per user per business per cooldown period
+	cooldown := getCheckinCooldown()
+	var checkin models.Checkin
+	var retryAfter time.Duration
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Lock the user's row so concurrent check-ins by the same user run one at a time
+		// and each sees the ones before it. NO KEY UPDATE doesn't block inserts that
+		// reference the user, such as reviews.
+		if err := tx.Clauses(clause.Locking{Strength: "NO KEY UPDATE"}).Select("id").
+			First(&models.User{}, userID).Error; err != nil {
+			return err
+		}
+
+		var last models.Checkin
+		err := tx.Where("user_id = ? AND business_id = ? AND created_at > ?", userID, business.ID, time.Now().Add(-cooldown)).
+			Order("created_at DESC").
+			First(&last).Error
+		if err == nil {
+			retryAfter = time.Until(last.CreatedAt.Add(cooldown))
+			return errCheckinCooldown
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		checkin = models.Checkin{
+			UserID:         userID,
+			BusinessID:     business.ID,
+			Latitude:       *req.Latitude,
+			Longitude:      *req.Longitude,
+			DistanceMeters: distance,
+		}
+		return tx.Create(&checkin).Error
+	})
+	switch {
+	case errors.Is(err, errCheckinCooldown):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "You have already checked in here recently"})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+		return
+	}
+
+	// Check-ins reveal where the user is, so unlike reviews they are never fanned out to
+	// followers or bookmarkers; only the user sees them in their history
+	emitEvent(c, events.TypeCheckin, checkin.UserID, checkin.BusinessID, events.Checkin{
+		CheckinID:      int(checkin.ID),
+		DistanceMeters: checkin.DistanceMeters,
+	})
+
+	checkin.Business = business
+	c.JSON(http.StatusCreated, checkin.ToPublic())
+}
+
+func GetBusinessCheckinStats(c *gin.Context) {
+	var business models.Business
+	if err := database.DB.WithContext(c.Request.Context()).First(&business, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business not found"})
+		return
+	}
+
+	stats := CheckinStats{BusinessID: business.ID}
+	if err := database.DB.WithContext(c.Request.Context()).Model(&models.Checkin{}).
+		Where("business_id = ?", business.ID).
+		Select("COUNT(*), COUNT(DISTINCT user_id)").
+		Row().Scan(&stats.TotalCheckins, &stats.UniqueVisitors); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-in stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func GetUserCheckins(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	// Check-in history reveals where a user has been, so only the user can read it
+	if uint(userID) != getUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only view your own check-ins"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	var checkins []models.Checkin
+	if err := database.DB.WithContext(c.Request.Context()).Where("user_id = ?", userID).
+		Preload("Business").
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&checkins).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-ins"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ToPublicCheckins(checkins))
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"review/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// On SQLite every transaction takes the write lock up front, so the check-ins serialize
+// whether or not CreateCheckin locks the user's row and the sqlite case passes either
+// way. Only the postgres case proves the row lock; it runs when TEST_DATABASE_URL
+// points at a Postgres database that may be written to, and is skipped otherwise.
+func TestCreateCheckinCooldownIsAtomic(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		testCheckinCooldownIsAtomic(t, database.DB)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DATABASE_URL")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_URL is not set")
+		}
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqlDB.Close()
+		if err := db.AutoMigrate(&models.User{}, &models.Business{}, &models.Checkin{}); err != nil {
+			t.Fatal(err)
+		}
+		testCheckinCooldownIsAtomic(t, db)
+	})
+}
+
+// testCheckinCooldownIsAtomic sends concurrent check-ins by one user with the handlers
+// using db
+func testCheckinCooldownIsAtomic(t *testing.T, db *gorm.DB) {
+	previous := database.DB
+	database.DB = db
+	defer func() { database.DB = previous }()
+
+	user := models.User{Name: "Carol", Email: fmt.Sprintf("carol-%d@example.com", time.Now().UnixNano()), Password: "carol-password-hash"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	business := models.Business{Name: "Kiosk", Category: "cafe", Latitude: 35.66, Longitude: 139.70}
+	if err := db.Create(&business).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold each insert long enough for every request to have checked the cooldown
+	slowInsert := func(db *gorm.DB) {
+		if db.Statement.Table == "checkins" {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if err := db.Callback().Create().Before("gorm:create").Register("test:slow_checkin", slowInsert); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Callback().Create().Remove("test:slow_checkin")
+
+	r := gin.New()
+	r.POST("/businesses/:id/checkins", CreateCheckin)
+
+	path := fmt.Sprintf("/businesses/%d/checkins", business.ID)
+	body := fmt.Sprintf(`{"latitude":%f,"longitude":%f}`, business.Latitude, business.Longitude)
+
+	const attempts = 10
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-User-ID", strconv.Itoa(int(user.ID)))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusTooManyRequests] != attempts-1 {
+		t.Errorf("concurrent check-ins answered %v, want one 201 and %d 429", counts, attempts-1)
+	}
+
+	var stored int64
+	db.Model(&models.Checkin{}).Where("user_id = ? AND business_id = ?", user.ID, business.ID).Count(&stored)
+	if stored != 1 {
+		t.Errorf("stored %d check-ins, want 1", stored)
+	}
+}
+
+func TestCheckinIsNotFannedOut(t *testing.T) {
+	suffix := time.Now().UnixNano()
+	dave := models.User{Name: "Dave", Email: fmt.Sprintf("dave-%d@example.com", suffix), Password: "dave-password-hash"}
+	erin := models.User{Name: "Erin", Email: fmt.Sprintf("erin-%d@example.com", suffix), Password: "erin-password-hash"}
+	if err := database.DB.Create(&[]*models.User{&dave, &erin}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Erin follows Dave and keeps the business in a private collection; either used to put
+	// Dave's check-ins in her feed
+	saved := models.Collection{UserID: erin.ID, Name: "Saved"}
+	if err := database.DB.Create(&saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&models.CollectionItem{CollectionID: saved.ID, BusinessID: fixture.business.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&models.Follow{FollowerID: erin.ID, FolloweeID: dave.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRouter()
+	r.POST("/businesses/:id/checkins", CreateCheckin)
+
+	body := fmt.Sprintf(`{"latitude":%f,"longitude":%f}`, fixture.business.Latitude, fixture.business.Longitude)
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/businesses/%d/checkins", fixture.business.ID), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(dave.ID)))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("check-in answered %d: %s", w.Code, w.Body.String())
+	}
+
+	var items int64
+	database.DB.Model(&models.FeedItem{}).Where("actor_id = ?", dave.ID).Count(&items)
+	if items != 0 {
+		t.Errorf("check-in wrote %d feed items, want 0", items)
+	}
+
+	feed, _ := decode(t, get(r, "/feed", erin.ID)).(map[string]any)
+	if entries, _ := feed["items"].([]any); len(entries) != 0 {
+		t.Errorf("GET /feed as a follower and bookmarker returned %v, want no items", entries)
+	}
+}
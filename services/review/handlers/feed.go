@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"review/database"
+	"review/feed"
+	"strconv"
+	"time"
+
+	"github.com/yelp-sample-v2/shared/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FeedEntry is a hydrated feed item
+type FeedEntry struct {
+	ID        uint                   `json:"id"`
+	Kind      string                 `json:"kind"`
+	CreatedAt time.Time              `json:"created_at"`
+	Actor     *models.PublicUser     `json:"actor,omitempty"`
+	Business  *models.PublicBusiness `json:"business,omitempty"`
+	Review    *models.PublicReview   `json:"review,omitempty"`
+}
+
+type FeedResponse struct {
+	Items      []FeedEntry `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+func GetFeed(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var after *feed.Cursor
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := feed.DecodeCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		after = &cursor
+	}
+
+	items, next, err := feed.Page(database.DB.WithContext(c.Request.Context()), userID, after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return
+	}
+
+	entries, err := hydrateFeed(c.Request.Context(), items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return
+	}
+
+	response := FeedResponse{Items: entries}
+	if next != nil {
+		response.NextCursor = next.Encode()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+var errFeedHydration = errors.New("failed to hydrate feed")
+
+// hydrateFeed loads the actors, businesses and subjects of a page of feed items in one query each
+func hydrateFeed(ctx context.Context, items []models.FeedItem) ([]FeedEntry, error) {
+	actorIDs := make([]uint, 0, len(items))
+	businessIDs := make([]uint, 0, len(items))
+	reviewIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		actorIDs = append(actorIDs, item.ActorID)
+		businessIDs = append(businessIDs, item.BusinessID)
+		if item.Kind == models.FeedKindReview {
+			reviewIDs = append(reviewIDs, item.SubjectID)
+		}
+	}
+
+	actors := map[uint]models.PublicUser{}
+	if len(actorIDs) > 0 {
+		var users []models.User
+		if err := selectPublicUserColumns(database.DB.WithContext(ctx)).Find(&users, actorIDs).Error; err != nil {
+			return nil, errFeedHydration
+		}
+		for _, user := range users {
+			actors[user.ID] = user.ToPublic()
+		}
+	}
+
+	businesses := map[uint]models.PublicBusiness{}
+	if len(businessIDs) > 0 {
+		var rows []models.Business
+		if err := database.DB.WithContext(ctx).Find(&rows, businessIDs).Error; err != nil {
+			return nil, errFeedHydration
+		}
+		for _, business := range rows {
+			businesses[business.ID] = business.ToPublic()
+		}
+	}
+
+	reviews := map[uint]models.PublicReview{}
+	if len(reviewIDs) > 0 {
+		var rows []models.Review
+		if err := database.DB.WithContext(ctx).Find(&rows, reviewIDs).Error; err != nil {
+			return nil, errFeedHydration
+		}
+		for _, review := range rows {
+			reviews[review.ID] = review.ToPublic()
+		}
+	}
+
+	entries := make([]FeedEntry, 0, len(items))
+	for _, item := range items {
+		entry := FeedEntry{
+			ID:        item.ID,
+			Kind:      item.Kind,
+			CreatedAt: item.CreatedAt,
+		}
+		if actor, ok := actors[item.ActorID]; ok {
+			entry.Actor = &actor
+		}
+		if business, ok := businesses[item.BusinessID]; ok {
+			entry.Business = &business
+		}
+
+		switch item.Kind {
+		case models.FeedKindReview:
+			review, ok := reviews[item.SubjectID]
+			if !ok {
+				// The review was deleted after fan-out
+				continue
+			}
+			entry.Review = &review
+		default:
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
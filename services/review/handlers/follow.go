@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"review/database"
+	"review/feed"
+	"strconv"
+
+	"github.com/yelp-sample-v2/shared/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func FollowUser(c *gin.Context) {
+	followerID := getUserID(c)
+	if followerID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var followee models.User
+	if err := selectPublicUserColumns(database.DB.WithContext(c.Request.Context())).First(&followee, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if followee.ID == followerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot follow yourself"})
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		follow := models.Follow{FollowerID: followerID, FolloweeID: followee.ID}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow)
+		if result.Error != nil {
+			return result.Error
+		}
+		// Already following: nothing to backfill
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		return feed.Backfill(tx, followerID, followee.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"following": true, "user": followee.ToPublic()})
+}
+
+func UnfollowUser(c *gin.Context) {
+	followerID := getUserID(c)
+	if followerID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	followeeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).
+			Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+		return feed.Remove(tx, followerID, uint(followeeID))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func GetFollowers(c *gin.Context) {
+	listFollowUsers(c, "follows.followee_id = ?", "follows.follower_id")
+}
+
+func GetFollowing(c *gin.Context) {
+	listFollowUsers(c, "follows.follower_id = ?", "follows.followee_id")
+}
+
+// listFollowUsers lists the users on the other side of the current user's follow edges
+func listFollowUsers(c *gin.Context, where string, joinColumn string) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	// follows has a created_at too, so every column is qualified
+	var users []models.User
+	if err := database.DB.WithContext(c.Request.Context()).Model(&models.User{}).
+		Select("users.id, users.name, users.created_at").
+		Joins("JOIN follows ON users.id = "+joinColumn).
+		Where(where, c.Param("id")).
+		Order("follows.created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	response := make([]models.PublicUser, 0, len(users))
+	for _, user := range users {
+		response = append(response, user.ToPublic())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
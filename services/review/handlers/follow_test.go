@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"review/database"
+	"review/feed"
+
+	"github.com/yelp-sample-v2/shared/models"
+)
+
+func TestFollowLists(t *testing.T) {
+	r := newTestRouter()
+
+	tests := []struct {
+		path string
+		want models.User
+	}{
+		{fmt.Sprintf("/users/%d/followers", fixture.alice.ID), fixture.bob},
+		{fmt.Sprintf("/users/%d/following", fixture.bob.ID), fixture.alice},
+	}
+	for _, tt := range tests {
+		w := get(r, tt.path, 0)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s answered %d: %s", tt.path, w.Code, w.Body.String())
+		}
+		users, _ := decode(t, w).([]any)
+		if len(users) != 1 {
+			t.Fatalf("GET %s returned %d users, want 1", tt.path, len(users))
+		}
+		user, _ := users[0].(map[string]any)
+		if user["id"] != float64(tt.want.ID) || user["name"] != tt.want.Name {
+			t.Errorf("GET %s returned %v, want %s", tt.path, user, tt.want.Name)
+		}
+		if user["created_at"] == "0001-01-01T00:00:00Z" {
+			t.Errorf("GET %s returned no created_at", tt.path)
+		}
+	}
+}
+
+func TestUnfollowKeepsBookmarkedBusinessItems(t *testing.T) {
+	suffix := time.Now().UnixNano()
+	frank := models.User{Name: "Frank", Email: fmt.Sprintf("frank-%d@example.com", suffix), Password: "frank-password-hash"}
+	grace := models.User{Name: "Grace", Email: fmt.Sprintf("grace-%d@example.com", suffix), Password: "grace-password-hash"}
+	if err := database.DB.Create(&[]*models.User{&frank, &grace}).Error; err != nil {
+		t.Fatal(err)
+	}
+	bakery := models.Business{Name: "Bakery", Category: "bakery", Latitude: 35.67, Longitude: 139.75}
+	bar := models.Business{Name: "Bar", Category: "bar", Latitude: 35.69, Longitude: 139.70}
+	if err := database.DB.Create(&[]*models.Business{&bakery, &bar}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Grace follows Frank and also keeps the bakery in a collection
+	saved := models.Collection{UserID: grace.ID, Name: "Saved"}
+	if err := database.DB.Create(&saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&models.CollectionItem{CollectionID: saved.ID, BusinessID: bakery.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&models.Follow{FollowerID: grace.ID, FolloweeID: frank.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, business := range []models.Business{bakery, bar} {
+		review := models.Review{BusinessID: business.ID, UserID: frank.ID, Rating: 4, Text: "Nice"}
+		if err := database.DB.Create(&review).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := feed.FanOut(database.DB, models.FeedKindReview, frank.ID, business.ID, review.ID, review.CreatedAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := newTestRouter()
+	r.DELETE("/users/:id/follow", UnfollowUser)
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/users/%d/follow", frank.ID), nil)
+	req.Header.Set("X-User-ID", strconv.Itoa(int(grace.ID)))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unfollow answered %d: %s", w.Code, w.Body.String())
+	}
+
+	// The review of the bar came only from the follow; the bakery is still bookmarked
+	var items []models.FeedItem
+	if err := database.DB.Where("user_id = ?", grace.ID).Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].BusinessID != bakery.ID {
+		t.Errorf("feed after unfollowing has %+v, want only the review of the bookmarked bakery", items)
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"review/database"
+	"review/feed"
+	"review/viewlog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fixture is the data every test starts from
+var fixture struct {
+	alice, bob models.User
+	business   models.Business
+	review     models.Review
+	checkin    models.Checkin
+}
+
+// delivered collects the review views the handlers sent to the logging service
+var delivered viewRecorder
+
+type viewRecorder struct {
+	mu     sync.Mutex
+	events []viewlog.Event
+}
+
+func (r *viewRecorder) add(events []viewlog.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, events...)
+}
+
+// of returns the delivered views of the given user
+func (r *viewRecorder) of(userID int) []viewlog.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []viewlog.Event
+	for _, e := range r.events {
+		if e.UserID == userID {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	dir, err := os.MkdirTemp("", "review-handlers")
+	if err != nil {
+		panic(err)
+	}
+
+	code := func() int {
+		defer os.RemoveAll(dir)
+
+		if err := openTestDB(filepath.Join(dir, "test.db")); err != nil {
+			panic(err)
+		}
+		defer database.Close()
+
+		// The logging service accepts every view
+		sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var batch struct {
+				Events []viewlog.Event `json:"events"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			delivered.add(batch.Events)
+			json.NewEncoder(w).Encode(gin.H{"accepted": len(batch.Events), "failed": []int{}})
+		}))
+		defer sink.Close()
+		viewlog.Start(viewlog.Config{
+			URL:           sink.URL,
+			QueueSize:     10000,
+			BatchSize:     100,
+			FlushInterval: 10 * time.Millisecond,
+			Workers:       2,
+		})
+		defer viewlog.Default.Close(context.Background())
+
+		return m.Run()
+	}()
+	os.Exit(code)
+}
+
+// openTestDB points the handlers at a fresh SQLite database with the fixture loaded.
+// SQLite ignores row locks; transactions take the write lock up front instead, so they
+// serialize as the locking ones do on Postgres.
+func openTestDB(path string) error {
+	db, err := gorm.Open(sqlite.Open(path+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return err
+	}
+	database.DB = db
+
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Business{},
+		&models.Review{},
+		&models.Collection{},
+		&models.CollectionItem{},
+		&models.Follow{},
+		&models.FeedItem{},
+		&models.Checkin{},
+	); err != nil {
+		return err
+	}
+
+	fixture.alice = models.User{Name: "Alice", Email: "alice@example.com", Password: "alice-password-hash"}
+	fixture.bob = models.User{Name: "Bob", Email: "bob@example.com", Password: "bob-password-hash"}
+	if err := db.Create(&[]*models.User{&fixture.alice, &fixture.bob}).Error; err != nil {
+		return err
+	}
+
+	fixture.business = models.Business{Name: "Cafe", Category: "cafe", Latitude: 35.68, Longitude: 139.76, OwnerID: &fixture.alice.ID}
+	if err := db.Create(&fixture.business).Error; err != nil {
+		return err
+	}
+
+	fixture.review = models.Review{BusinessID: fixture.business.ID, UserID: fixture.alice.ID, Rating: 5, Text: "Great coffee"}
+	more := models.Review{BusinessID: fixture.business.ID, UserID: fixture.bob.ID, Rating: 3, Text: "Crowded"}
+	if err := db.Create(&[]*models.Review{&fixture.review, &more}).Error; err != nil {
+		return err
+	}
+
+	fixture.checkin = models.Checkin{UserID: fixture.alice.ID, BusinessID: fixture.business.ID, Latitude: 35.68, Longitude: 139.76}
+	if err := db.Create(&fixture.checkin).Error; err != nil {
+		return err
+	}
+
+	// Bob follows Alice and sees her reviews in his feed
+	if err := db.Create(&models.Follow{FollowerID: fixture.bob.ID, FolloweeID: fixture.alice.ID}).Error; err != nil {
+		return err
+	}
+	return feed.FanOut(db, models.FeedKindReview, fixture.alice.ID, fixture.business.ID, fixture.review.ID, fixture.review.CreatedAt)
+}
+
+// newTestRouter registers the public read routes as main does
+func newTestRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/businesses/:id/reviews", GetBusinessReviews)
+	r.GET("/businesses/:id/checkins", GetBusinessCheckinStats)
+	r.GET("/reviews", GetReviews)
+	r.GET("/reviews/:id", GetReview)
+	r.GET("/users/:id", GetUserProfile)
+	r.GET("/users/:id/reviews", GetUserReviews)
+	r.GET("/users/:id/checkins", GetUserCheckins)
+	r.GET("/users/:id/followers", GetFollowers)
+	r.GET("/users/:id/following", GetFollowing)
+	r.GET("/feed", GetFeed)
+	return r
+}
+
+// get serves a GET request, as the user when userID isn't 0
+func get(r http.Handler, path string, userID uint) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if userID != 0 {
+		req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// decode unmarshals a JSON response body into a generic value
+func decode(t *testing.T, w *httptest.ResponseRecorder) any {
+	t.Helper()
+	var body any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, w.Body.String())
+	}
+	return body
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yelp-sample-v2/shared/models/modelstest"
+)
+
+func TestPublicRoutesOmitPII(t *testing.T) {
+	r := newTestRouter()
+
+	tests := []struct {
+		name   string
+		path   string
+		userID uint
+	}{
+		{"reviews", "/reviews", 0},
+		{"review", fmt.Sprintf("/reviews/%d", fixture.review.ID), 0},
+		{"business reviews", fmt.Sprintf("/businesses/%d/reviews", fixture.business.ID), 0},
+		{"user reviews", fmt.Sprintf("/users/%d/reviews", fixture.alice.ID), 0},
+		{"user profile", fmt.Sprintf("/users/%d", fixture.alice.ID), 0},
+		{"followers", fmt.Sprintf("/users/%d/followers", fixture.alice.ID), 0},
+		{"following", fmt.Sprintf("/users/%d/following", fixture.bob.ID), 0},
+		{"user checkins", fmt.Sprintf("/users/%d/checkins", fixture.alice.ID), fixture.alice.ID},
+		{"feed", "/feed", fixture.bob.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(r, tt.path, tt.userID)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s answered %d: %s", tt.path, w.Code, w.Body.String())
+			}
+
+			if keys := modelstest.FindPII(decode(t, w)); len(keys) > 0 {
+				t.Errorf("GET %s serialized personal data at %v", tt.path, keys)
+			}
+			for _, value := range []string{
+				fixture.alice.Email, fixture.alice.Password,
+				fixture.bob.Email, fixture.bob.Password,
+			} {
+				if strings.Contains(w.Body.String(), value) {
+					t.Errorf("GET %s contains %q", tt.path, value)
+				}
+			}
+		})
+	}
+}
+
+// The routes above must not pass vacuously on empty lists
+func TestPublicRoutesReturnFixture(t *testing.T) {
+	r := newTestRouter()
+
+	for _, path := range []string{
+		fmt.Sprintf("/businesses/%d/reviews", fixture.business.ID),
+		fmt.Sprintf("/users/%d/followers", fixture.alice.ID),
+		fmt.Sprintf("/users/%d/following", fixture.bob.ID),
+	} {
+		if items, ok := decode(t, get(r, path, 0)).([]any); !ok || len(items) == 0 {
+			t.Errorf("GET %s returned no items", path)
+		}
+	}
+
+	body, _ := decode(t, get(r, "/feed", fixture.bob.ID)).(map[string]any)
+	if items, _ := body["items"].([]any); len(items) != 1 {
+		t.Errorf("GET /feed returned %d items, want 1", len(items))
+	}
+}
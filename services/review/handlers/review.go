@@ -1,17 +1,21 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
-	"os"
 	"review/database"
+	"review/feed"
+	"review/viewlog"
 	"strconv"
+	"time"
 
+	"github.com/yelp-sample-v2/shared/events"
+	"github.com/yelp-sample-v2/shared/logger"
 	"github.com/yelp-sample-v2/shared/models"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func getUserID(c *gin.Context) uint {
@@ -19,13 +23,11 @@ func getUserID(c *gin.Context) uint {
 	userIDStr := c.GetHeader("X-User-ID")
 	if userIDStr != "" {
 		if id, err := strconv.Atoi(userIDStr); err == nil {
-			fmt.Printf("Got user ID from header: %d\n", id)
 			return uint(id)
 		}
 	}
 
 	// Anonymous user
-	fmt.Printf("Using anonymous user ID: 0\n")
 	return 0
 }
 
@@ -33,7 +35,7 @@ func GetBusinessReviews(c *gin.Context) {
 	id := c.Param("id")
 
 	var business models.Business
-	if err := database.DB.First(&business, id).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&business, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Business not found"})
 		return
 	}
@@ -52,7 +54,7 @@ func GetBusinessReviews(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	if err := database.DB.Where("business_id = ?", id).
+	if err := database.DB.WithContext(c.Request.Context()).Where("business_id = ?", id).
 		Preload("User").
 		Offset(offset).
 		Limit(limit).
@@ -61,18 +63,19 @@ func GetBusinessReviews(c *gin.Context) {
 		return
 	}
 
-	// Log review views asynchronously (try header first, then JWT)
-	userID := getUserID(c)
-	go logReviewViews(userID, c, id, reviews)
+	// Queue review view logs for batched delivery
+	logReviewViews(captureViewer(c), business.ID, reviews)
+
+	c.Header("X-Cache-Tags", "reviews:business:"+strconv.Itoa(int(business.ID)))
 
-	c.JSON(http.StatusOK, reviews)
+	c.JSON(http.StatusOK, models.ToPublicReviews(reviews))
 }
 
 func CreateReview(c *gin.Context) {
 	businessID := c.Param("id")
 
 	var business models.Business
-	if err := database.DB.First(&business, businessID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&business, businessID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Business not found"})
 		return
 	}
@@ -87,23 +90,43 @@ func CreateReview(c *gin.Context) {
 		return
 	}
 
+	userID := getUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
 	businessIDInt, _ := strconv.Atoi(businessID)
 
 	review := models.Review{
 		BusinessID: uint(businessIDInt),
-		UserID:     1,
+		UserID:     userID,
 		Rating:     request.Rating,
 		Text:       request.Text,
 	}
 
-	if err := database.DB.Create(&review).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Create(&review).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create review"})
 		return
 	}
 
-	updateBusinessRating(uint(businessIDInt))
+	updateBusinessRating(c.Request.Context(), uint(businessIDInt))
 
-	c.JSON(http.StatusCreated, review)
+	// Push the review into followers' and bookmarkers' feeds
+	if err := feed.FanOut(database.DB.WithContext(c.Request.Context()), models.FeedKindReview, review.UserID, review.BusinessID, review.ID, review.CreatedAt); err != nil {
+		logger.From(c.Request.Context()).Error("Failed to fan out review", "review_id", review.ID, "error", err)
+	}
+
+	emitEvent(c, events.TypeReviewCreated, review.UserID, review.BusinessID, events.ReviewCreated{
+		ReviewID: int(review.ID),
+		Rating:   review.Rating,
+	})
+
+	// The business's reviews, rating and review count changed; have the gateway drop
+	// cached copies
+	c.Header("X-Cache-Purge", fmt.Sprintf("reviews:business:%d business:%d", review.BusinessID, review.BusinessID))
+
+	c.JSON(http.StatusCreated, review.ToPublic())
 }
 
 func GetReviews(c *gin.Context) {
@@ -121,7 +144,7 @@ func GetReviews(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	if err := database.DB.Preload("User").
+	if err := database.DB.WithContext(c.Request.Context()).Preload("User").
 		Preload("Business").
 		Offset(offset).
 		Limit(limit).
@@ -130,37 +153,36 @@ func GetReviews(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, reviews)
+	c.JSON(http.StatusOK, models.ToPublicReviews(reviews))
 }
 
 func GetReview(c *gin.Context) {
 	id := c.Param("id")
 
 	var review models.Review
-	if err := database.DB.Preload("User").
+	if err := database.DB.WithContext(c.Request.Context()).Preload("User").
 		Preload("Business").
 		First(&review, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
 		return
 	}
 
-	// Log single review view asynchronously (try header first, then JWT)
-	userID := getUserID(c)
-	go logSingleReviewView(userID, c, strconv.Itoa(int(review.BusinessID)), review.ID)
+	// Queue the review view log for batched delivery
+	viewlog.Default.Enqueue(captureViewer(c).Event(int(review.BusinessID), int(review.ID)))
 
-	c.JSON(http.StatusOK, review)
+	c.JSON(http.StatusOK, review.ToPublic())
 }
 
-func updateBusinessRating(businessID uint) {
+func updateBusinessRating(ctx context.Context, businessID uint) {
 	var avgRating float32
 	var count int64
 
-	database.DB.Model(&models.Review{}).
+	database.DB.WithContext(ctx).Model(&models.Review{}).
 		Where("business_id = ?", businessID).
-		Select("AVG(rating) as avg_rating, COUNT(*) as count").
+		Select("COALESCE(AVG(rating), 0) as avg_rating, COUNT(*) as count").
 		Row().Scan(&avgRating, &count)
 
-	database.DB.Model(&models.Business{}).
+	database.DB.WithContext(ctx).Model(&models.Business{}).
 		Where("id = ?", businessID).
 		Updates(map[string]interface{}{
 			"rating":       avgRating,
@@ -168,51 +190,39 @@ func updateBusinessRating(businessID uint) {
 		})
 }
 
-// logReviewViews sends review view logs to the logging service
-func logReviewViews(userID uint, c *gin.Context, businessID string, reviews []models.Review) {
-	for _, review := range reviews {
-		logSingleReviewView(userID, c, businessID, review.ID)
-	}
-}
-
-// logSingleReviewView sends a single review view log to the logging service
-func logSingleReviewView(userID uint, c *gin.Context, businessID string, reviewID uint) {
-	loggingServiceURL := os.Getenv("LOGGING_SERVICE_URL")
-	if loggingServiceURL == "" {
-		loggingServiceURL = "http://logging-service:8083"
+// captureViewer copies everything view logging needs out of the request.
+// gin reuses *gin.Context once the handler returns, so background work must never read it.
+func captureViewer(c *gin.Context) viewlog.Viewer {
+	// Use the authenticated user, fallback to anonymous if not authenticated
+	userID := 1 // anonymous/guest user ID
+	if id := getUserID(c); id != 0 {
+		userID = int(id)
 	}
 
-	// Use provided userID (from JWT token), fallback to anonymous if not authenticated
-	actualUserID := 1 // anonymous/guest user ID
-	if userID != 0 {
-		actualUserID = int(userID)
+	return viewlog.Viewer{
+		UserID:    userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		ViewedAt:  time.Now(),
+		Request:   trace.SpanContextFromContext(c.Request.Context()),
 	}
+}
 
-	businessIDInt, _ := strconv.Atoi(businessID)
-
-	logData := map[string]interface{}{
-		"user_id":     actualUserID,
-		"business_id": businessIDInt,
-		"review_id":   int(reviewID),
-		"ip_address":  c.ClientIP(),
-		"user_agent":  c.GetHeader("User-Agent"),
+// logReviewViews queues review view logs for batched delivery to the logging service.
+// Enqueueing never blocks, so it runs inline in the handler.
+func logReviewViews(viewer viewlog.Viewer, businessID uint, reviews []models.Review) {
+	for _, review := range reviews {
+		viewlog.Default.Enqueue(viewer.Event(int(businessID), int(review.ID)))
 	}
+}
 
-	jsonData, err := json.Marshal(logData)
+// emitEvent queues an analytics event; request data is copied before the handler returns
+func emitEvent(c *gin.Context, eventType string, userID uint, businessID uint, payload interface{}) {
+	event, err := events.New(eventType, int(userID), int(businessID), payload)
 	if err != nil {
-		return // Fail silently for logging
-	}
-
-	// Send to logging service (fire and forget)
-	// User ID is already included in the JSON payload, no need for headers
-	go func() {
-		resp, err := http.Post(
-			loggingServiceURL+"/logs/review-view",
-			"application/json",
-			bytes.NewBuffer(jsonData),
-		)
-		if err == nil {
-			resp.Body.Close()
-		}
-	}()
+		return
+	}
+	event.IPAddress = c.ClientIP()
+	event.UserAgent = c.GetHeader("User-Agent")
+	events.Emit(event)
 }
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"review/viewlog"
+)
+
+// Views are captured from the request before the handler returns; gin reuses its
+// contexts, so run with -race to catch a view logged from a recycled one
+func TestConcurrentReviewReadsLogEachViewer(t *testing.T) {
+	r := newTestRouter()
+
+	const viewers = 20
+	first := newViewers(viewers)
+	paths := []string{
+		fmt.Sprintf("/businesses/%d/reviews", fixture.business.ID),
+		fmt.Sprintf("/reviews/%d", fixture.review.ID),
+	}
+	// Both reviews of the business, then the single review
+	const viewsPerViewer = 3
+
+	var wg sync.WaitGroup
+	for i := 0; i < viewers; i++ {
+		for _, path := range paths {
+			wg.Add(1)
+			go func(userID int, path string) {
+				defer wg.Done()
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header.Set("X-User-ID", strconv.Itoa(userID))
+				req.Header.Set("User-Agent", fmt.Sprintf("agent-%d", userID))
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Errorf("GET %s answered %d: %s", path, w.Code, w.Body.String())
+				}
+			}(first+i, path)
+		}
+	}
+	wg.Wait()
+
+	for i := 0; i < viewers; i++ {
+		userID := first + i
+		views := waitForViews(t, userID, viewsPerViewer)
+		for _, v := range views {
+			if want := fmt.Sprintf("agent-%d", userID); v.UserAgent != want {
+				t.Errorf("view of user %d has user agent %q, want %q", userID, v.UserAgent, want)
+			}
+			if v.BusinessID != int(fixture.business.ID) {
+				t.Errorf("view of user %d is of business %d, want %d", userID, v.BusinessID, fixture.business.ID)
+			}
+		}
+	}
+}
+
+// lastViewer counts the user IDs handed out by newViewers
+var lastViewer atomic.Int64
+
+// newViewers returns the first of n user IDs no other test or run logs views for
+func newViewers(n int) int {
+	// Far above the fixture's users
+	return 100000 + int(lastViewer.Add(int64(n))) - n
+}
+
+// waitForViews waits until n views of the user have been delivered and returns them
+func waitForViews(t *testing.T, userID, n int) []viewlog.Event {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		views := delivered.of(userID)
+		if len(views) >= n {
+			if len(views) > n {
+				t.Errorf("user %d has %d views delivered, want %d", userID, len(views), n)
+			}
+			return views
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("user %d has %d views delivered, want %d", userID, len(views), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
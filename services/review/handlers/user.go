@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"review/database"
+	"strconv"
+
+	"github.com/yelp-sample-v2/shared/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserProfile is the public profile of a reviewer
+type UserProfile struct {
+	models.PublicUser
+	ReviewCount        int64         `json:"review_count"`
+	FollowerCount      int64         `json:"follower_count"`
+	FollowingCount     int64         `json:"following_count"`
+	AverageRatingGiven float64       `json:"average_rating_given"`
+	RatingDistribution map[int]int64 `json:"rating_distribution"`
+}
+
+// selectPublicUserColumns limits a users query to columns safe for public output
+func selectPublicUserColumns(db *gorm.DB) *gorm.DB {
+	return db.Select("users.id", "users.name", "users.created_at")
+}
+
+func GetUserProfile(c *gin.Context) {
+	id := c.Param("id")
+
+	var user models.User
+	if err := selectPublicUserColumns(database.DB.WithContext(c.Request.Context())).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var rows []struct {
+		Rating int
+		Count  int64
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Model(&models.Review{}).
+		Select("rating, COUNT(*) as count").
+		Where("user_id = ?", user.ID).
+		Group("rating").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user statistics"})
+		return
+	}
+
+	profile := UserProfile{
+		PublicUser:         user.ToPublic(),
+		RatingDistribution: map[int]int64{1: 0, 2: 0, 3: 0, 4: 0, 5: 0},
+	}
+
+	var ratingSum int64
+	for _, row := range rows {
+		profile.RatingDistribution[row.Rating] = row.Count
+		profile.ReviewCount += row.Count
+		ratingSum += int64(row.Rating) * row.Count
+	}
+	database.DB.WithContext(c.Request.Context()).Model(&models.Follow{}).Where("followee_id = ?", user.ID).Count(&profile.FollowerCount)
+	database.DB.WithContext(c.Request.Context()).Model(&models.Follow{}).Where("follower_id = ?", user.ID).Count(&profile.FollowingCount)
+
+	if profile.ReviewCount > 0 {
+		profile.AverageRatingGiven = float64(ratingSum) / float64(profile.ReviewCount)
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+func GetUserReviews(c *gin.Context) {
+	id := c.Param("id")
+
+	var user models.User
+	if err := selectPublicUserColumns(database.DB.WithContext(c.Request.Context())).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var reviews []models.Review
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	offset := (page - 1) * limit
+
+	if err := database.DB.WithContext(c.Request.Context()).Where("user_id = ?", user.ID).
+		Preload("Business").
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ToPublicReviews(reviews))
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"review/database"
+	"strconv"
+
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/models"
+	"gorm.io/gorm"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Internal endpoints used by the auth service for data export and erasure.
+// They are not routed through the API gateway.
+
+// ExportedCheckin includes the coordinates, which are only ever returned to the user themselves
+type ExportedCheckin struct {
+	models.PublicCheckin
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	DistanceMeters float64 `json:"distance_meters"`
+}
+
+func ExportUserData(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	var reviews []models.Review
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Business").
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export reviews"})
+		return
+	}
+
+	var checkins []models.Checkin
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Business").
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&checkins).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export check-ins"})
+		return
+	}
+
+	exportedCheckins := make([]ExportedCheckin, len(checkins))
+	for i, checkin := range checkins {
+		exportedCheckins[i] = ExportedCheckin{
+			PublicCheckin:  checkin.ToPublic(),
+			Latitude:       checkin.Latitude,
+			Longitude:      checkin.Longitude,
+			DistanceMeters: checkin.DistanceMeters,
+		}
+	}
+
+	var following, followers []models.Follow
+	if err := database.DB.WithContext(c.Request.Context()).Where("follower_id = ?", userID).Order("created_at ASC").Find(&following).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export follows"})
+		return
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Where("followee_id = ?", userID).Order("created_at ASC").Find(&followers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export follows"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews":   models.ToPublicReviews(reviews),
+		"checkins":  exportedCheckins,
+		"following": following,
+		"followers": followers,
+	})
+}
+
+// EraseUserData permanently deletes the user's reviews, check-ins, follows and feed entries,
+// then recalculates the ratings of the businesses they reviewed.
+// It is idempotent so the auth service can retry it.
+func EraseUserData(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	var businessIDs []uint
+	var erasedReviews int64
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Review{}).
+			Where("user_id = ?", userID).
+			Distinct().Pluck("business_id", &businessIDs).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ? OR actor_id = ?", userID, userID).Delete(&models.FeedItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("follower_id = ? OR followee_id = ?", userID, userID).Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Checkin{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.Review{})
+		erasedReviews = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase user data"})
+		return
+	}
+
+	for _, businessID := range businessIDs {
+		updateBusinessRating(c.Request.Context(), businessID)
+	}
+	logger.From(c.Request.Context()).Info("Erased user data", "user_id", userID, "reviews", erasedReviews, "businesses", len(businessIDs))
+
+	c.JSON(http.StatusOK, gin.H{
+		"erased":  true,
+		"reviews": erasedReviews,
+	})
+}
@@ -1,21 +1,47 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
-	"os"
 	"review/handlers"
 
 	"review/database"
+	"review/viewlog"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yelp-sample-v2/shared/events"
+	"github.com/yelp-sample-v2/shared/health"
+	"github.com/yelp-sample-v2/shared/logger"
+	"github.com/yelp-sample-v2/shared/metrics"
+	"github.com/yelp-sample-v2/shared/server"
+	"github.com/yelp-sample-v2/shared/tracing"
 )
 
 func main() {
+	// Log JSON to stdout, at LOG_LEVEL and above
+	logger.Start(logger.ConfigFromEnv("review-service"))
+
+	// Trace requests, including their database queries and calls to other services
+	if err := tracing.Start(tracing.ConfigFromEnv("review-service")); err != nil {
+		logger.Fatal("Failed to start tracing", "error", err)
+	}
+
 	database.Connect()
 
-	r := gin.Default()
+	// Start batched delivery of review view logs
+	viewlog.Start(viewlog.ConfigFromEnv())
+
+	// Start delivering analytics events to the logging service
+	events.Start(events.ConfigFromEnv("review-service"))
+
+	// Report the depth and drops of every queue logs are delivered through
+	metrics.RegisterQueue("review_views", viewlog.Default)
+	metrics.RegisterQueue("events", events.Default)
+
+	r := gin.New()
+	r.Use(tracing.Middleware(), logger.Middleware("X-User-ID"), metrics.Middleware(), logger.Recovery())
+	srv := server.New(server.ConfigFromEnv("8082"), r)
 
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -29,11 +55,13 @@ func main() {
 		})
 	})
 
-	r.GET("/ready", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ready",
-		})
-	})
+	// Ready while the database answers
+	checks := health.New(health.ConfigFromEnv())
+	checks.Critical("postgres", database.Ping)
+	r.GET("/ready", srv.CheckReady, checks.Ready)
+
+	// Prometheus metrics
+	r.GET("/metrics", metrics.Handler())
 
 	// Review routes
 	r.GET("/businesses/:id/reviews", handlers.GetBusinessReviews)
@@ -41,11 +69,35 @@ func main() {
 	r.GET("/reviews", handlers.GetReviews)
 	r.GET("/reviews/:id", handlers.GetReview)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8082"
-	}
+	// Check-in routes
+	r.POST("/businesses/:id/checkins", handlers.CreateCheckin)
+	r.GET("/businesses/:id/checkins", handlers.GetBusinessCheckinStats)
+	r.GET("/users/:id/checkins", handlers.GetUserCheckins)
+
+	// User profile routes
+	r.GET("/users/:id", handlers.GetUserProfile)
+	r.GET("/users/:id/reviews", handlers.GetUserReviews)
 
-	fmt.Printf("Review service starting on port %s\n", port)
-	log.Fatal(r.Run(":" + port))
+	// Social graph and activity feed routes
+	r.POST("/users/:id/follow", handlers.FollowUser)
+	r.DELETE("/users/:id/follow", handlers.UnfollowUser)
+	r.GET("/users/:id/followers", handlers.GetFollowers)
+	r.GET("/users/:id/following", handlers.GetFollowing)
+	r.GET("/feed", handlers.GetFeed)
+
+	// Internal routes for user data export and erasure (not exposed by the gateway)
+	r.GET("/internal/users/:id/data", handlers.ExportUserData)
+	r.DELETE("/internal/users/:id/data", handlers.EraseUserData)
+
+	// Once in-flight requests finish, deliver buffered view logs, events and spans
+	// and close the database pool
+	srv.OnShutdown("view logs", viewlog.Default.Close)
+	srv.OnShutdown("events", events.Close)
+	srv.OnShutdown("database", func(context.Context) error { return database.Close() })
+	srv.OnShutdown("tracing", tracing.Close)
+
+	slog.Info("Review service starting", "addr", srv.HTTP.Addr)
+	if err := srv.Run(); err != nil {
+		logger.Fatal("Failed to start server", "error", err)
+	}
 }
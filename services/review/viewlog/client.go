@@ -0,0 +1,134 @@
+package viewlog
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/yelp-sample-v2/shared/batch"
+	"github.com/yelp-sample-v2/shared/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Event is a single review view, captured when the review was served
+type Event struct {
+	UserID     int       `json:"user_id"`
+	BusinessID int       `json:"business_id"`
+	ReviewID   int       `json:"review_id"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	ViewedAt   time.Time `json:"viewed_at"`
+
+	// request is the span of the request the review was served in; it is not spooled
+	request trace.SpanContext
+}
+
+// SpanContext returns the span of the request the review was served in, which the
+// delivery of the view links to
+func (e Event) SpanContext() trace.SpanContext {
+	return e.request
+}
+
+// Viewer identifies who viewed reviews. It is captured from the request before the
+// handler returns and is safe to use from other goroutines.
+type Viewer struct {
+	UserID    int
+	IPAddress string
+	UserAgent string
+	ViewedAt  time.Time
+	// Request is the span of the request, which the delivery of the views links to
+	Request trace.SpanContext
+}
+
+// Event returns the view event for one review seen by this viewer
+func (v Viewer) Event(businessID, reviewID int) Event {
+	return Event{
+		UserID:     v.UserID,
+		BusinessID: businessID,
+		ReviewID:   reviewID,
+		IPAddress:  v.IPAddress,
+		UserAgent:  v.UserAgent,
+		ViewedAt:   v.ViewedAt,
+		request:    v.Request,
+	}
+}
+
+type Config struct {
+	// URL is the base URL of the logging service
+	URL string
+	// QueueSize bounds the number of events buffered in memory
+	QueueSize int
+	// BatchSize is the number of events that triggers a flush
+	BatchSize int
+	// FlushInterval is the longest an event waits in the buffer
+	FlushInterval time.Duration
+	// Workers is the number of batches delivered concurrently
+	Workers int
+	// MaxRetries is how many times a failed batch is retried before it is spooled or dropped
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// SpoolDir, when set, is where batches are written while the logging service is down
+	SpoolDir string
+}
+
+// ConfigFromEnv reads the client configuration from VIEW_LOG_* environment variables
+func ConfigFromEnv() Config {
+	cfg := Config{
+		URL:            os.Getenv("LOGGING_SERVICE_URL"),
+		QueueSize:      10000,
+		BatchSize:      100,
+		FlushInterval:  2 * time.Second,
+		Workers:        4,
+		MaxRetries:     5,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		SpoolDir:       os.Getenv("VIEW_LOG_SPOOL_DIR"),
+	}
+	if cfg.URL == "" {
+		cfg.URL = "http://logging-service:8083"
+	}
+	if n, err := strconv.Atoi(os.Getenv("VIEW_LOG_QUEUE_SIZE")); err == nil && n > 0 {
+		cfg.QueueSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("VIEW_LOG_BATCH_SIZE")); err == nil && n > 0 {
+		cfg.BatchSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("VIEW_LOG_FLUSH_INTERVAL")); err == nil && d > 0 {
+		cfg.FlushInterval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("VIEW_LOG_WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("VIEW_LOG_MAX_RETRIES")); err == nil && n >= 0 {
+		cfg.MaxRetries = n
+	}
+	return cfg
+}
+
+// Client buffers review view events and delivers them to the logging service in batches
+type Client = batch.Client[Event]
+
+// Default is the client used by the HTTP handlers
+var Default *Client
+
+// Start creates the default client and starts delivering events
+func Start(cfg Config) {
+	Default = New(cfg)
+}
+
+func New(cfg Config) *Client {
+	return batch.New(batch.Config{
+		URL:            cfg.URL + "/logs/review-views:batch",
+		Name:           "review_views",
+		QueueSize:      cfg.QueueSize,
+		BatchSize:      cfg.BatchSize,
+		FlushInterval:  cfg.FlushInterval,
+		Workers:        cfg.Workers,
+		MaxRetries:     cfg.MaxRetries,
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		Transport:      tracing.NewTransport("logging-service", nil),
+		SpoolDir:       cfg.SpoolDir,
+	}, batch.EncodeEvents[Event])
+}
@@ -0,0 +1,90 @@
+package viewlog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Batching, retries and spooling are tested in shared/batch; this checks what the
+// logging service receives
+func TestClientPostsReviewViews(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	stored := map[int]Event{}
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/logs/review-views:batch" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Events []Event `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The first view fails on the first attempt
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		failed := []int{}
+		for i, e := range req.Events {
+			if attempts == 1 && i == 0 {
+				failed = append(failed, i)
+				continue
+			}
+			stored[e.ReviewID] = e
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"accepted": len(req.Events) - len(failed),
+			"failed":   failed,
+		})
+	}))
+	defer svc.Close()
+
+	c := New(Config{
+		URL:            svc.URL,
+		QueueSize:      100,
+		BatchSize:      10,
+		FlushInterval:  10 * time.Millisecond,
+		Workers:        1,
+		MaxRetries:     3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	})
+
+	viewer := Viewer{UserID: 7, IPAddress: "192.0.2.1", UserAgent: "test-agent", ViewedAt: time.Now().UTC().Truncate(time.Millisecond)}
+	for reviewID := 1; reviewID <= 3; reviewID++ {
+		c.Enqueue(viewer.Event(42, reviewID))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for reviewID := 1; reviewID <= 3; reviewID++ {
+		want := viewer.Event(42, reviewID)
+		got, ok := stored[reviewID]
+		if !ok {
+			t.Errorf("view of review %d was not stored", reviewID)
+			continue
+		}
+		if got.UserID != want.UserID || got.BusinessID != want.BusinessID || got.IPAddress != want.IPAddress ||
+			got.UserAgent != want.UserAgent || !got.ViewedAt.Equal(want.ViewedAt) {
+			t.Errorf("view of review %d = %+v, want %+v", reviewID, got, want)
+		}
+	}
+	if got := c.Dropped(); got != 0 {
+		t.Errorf("Dropped() = %d, want 0", got)
+	}
+}
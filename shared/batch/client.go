@@ -0,0 +1,394 @@
+// Package batch delivers items such as log events to an HTTP endpoint in batches.
+// Items wait in a bounded queue, batches are posted by a fixed number of senders and
+// retried with backoff, and only the items the endpoint reports as failed are sent again.
+// When delivery keeps failing, items are spooled to disk if enabled and dropped otherwise;
+// batches the endpoint rejects as invalid are dropped. Callers are never blocked.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yelp-sample-v2/shared/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaxBatchSize is the largest batch the logging service accepts
+const MaxBatchSize = 500
+
+type Config struct {
+	// URL is the endpoint batches are posted to
+	URL string
+	// Name identifies the client in logs and span names, e.g. "review_views"
+	Name string
+	// QueueSize bounds the number of items buffered in memory
+	QueueSize int
+	// BatchSize is the number of items that triggers a flush
+	BatchSize int
+	// FlushInterval is the longest an item waits in the buffer
+	FlushInterval time.Duration
+	// Workers is the number of batches delivered concurrently
+	Workers int
+	// MaxRetries is how many times a failed batch is retried before it is spooled or dropped
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout bounds a single request
+	Timeout time.Duration
+	// Transport sends the requests; http.DefaultTransport when nil
+	Transport http.RoundTripper
+	// SpoolDir, when set, is where items are written while the endpoint is down or the
+	// queue is full, to be replayed later
+	SpoolDir string
+}
+
+// Encoder turns a batch into a request body
+type Encoder[T any] func(items []T) ([]byte, error)
+
+// EncodeEvents encodes a batch as {"events": [...]}, the body of the logging service's
+// batch endpoints
+func EncodeEvents[T any](items []T) ([]byte, error) {
+	return json.Marshal(struct {
+		Events []T `json:"events"`
+	}{items})
+}
+
+// Traced is implemented by items captured during a request; the span delivering a
+// batch links to the requests of its items
+type Traced interface {
+	SpanContext() trace.SpanContext
+}
+
+// Client buffers items and delivers them in batches
+type Client[T any] struct {
+	cfg        Config
+	encode     Encoder[T]
+	httpClient *http.Client
+	queue      chan T
+	senders    *Pool
+	spoolSeq   atomic.Int64
+	// closing is closed by Close; stopped is cancelled when Close gives up waiting,
+	// which also aborts the requests in flight
+	closing   chan struct{}
+	stopped   context.Context
+	stop      context.CancelFunc
+	done      chan struct{}
+	spoolDone chan struct{}
+	closeOnce sync.Once
+
+	// mu guards closed so Enqueue never sends on a closed queue
+	mu     sync.RWMutex
+	closed bool
+
+	// overflow holds items that arrived while the queue was full, until they are spooled
+	overflowMu sync.Mutex
+	overflow   []T
+
+	dropped atomic.Int64
+}
+
+// New starts a client posting batches encoded by encode to cfg.URL. Zero durations
+// take defaults.
+func New[T any](cfg Config, encode Encoder[T]) *Client[T] {
+	if cfg.BatchSize < 1 || cfg.BatchSize > MaxBatchSize {
+		cfg.BatchSize = MaxBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 2 * time.Second
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 200 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 10 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	c := &Client[T]{
+		cfg:        cfg,
+		encode:     encode,
+		httpClient: &http.Client{Timeout: cfg.Timeout, Transport: cfg.Transport},
+		queue:      make(chan T, cfg.QueueSize),
+		senders:    NewPool(cfg.Workers, cfg.Workers),
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
+		spoolDone:  make(chan struct{}),
+	}
+	c.stopped, c.stop = context.WithCancel(context.Background())
+
+	if cfg.SpoolDir != "" {
+		if err := os.MkdirAll(cfg.SpoolDir, 0o755); err != nil {
+			slog.Warn("Spool disabled", "client", cfg.Name, "error", err)
+			c.cfg.SpoolDir = ""
+		}
+	}
+
+	go c.run()
+	if c.cfg.SpoolDir != "" {
+		go c.runSpool()
+	} else {
+		close(c.spoolDone)
+	}
+	return c
+}
+
+// Enqueue adds an item to the buffer without blocking. When the buffer is full the
+// item is spooled instead, if spooling is enabled.
+// It returns false when the item was dropped because the buffer is full or the client is closed.
+func (c *Client[T]) Enqueue(item T) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		c.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case c.queue <- item:
+		return true
+	default:
+		if c.addOverflow(item) {
+			return true
+		}
+		c.dropped.Add(1)
+		return false
+	}
+}
+
+// Dropped returns the number of items that were never delivered
+func (c *Client[T]) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+// QueueDepth returns the number of items waiting in the buffer
+func (c *Client[T]) QueueDepth() int {
+	return len(c.queue)
+}
+
+// Close stops accepting items and flushes everything that is buffered.
+// If ctx expires first, requests in flight are aborted and the remaining items are
+// spooled (when enabled) or dropped.
+func (c *Client[T]) Close(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		close(c.queue)
+		close(c.closing)
+		c.mu.Unlock()
+	})
+
+	for _, done := range []chan struct{}{c.done, c.spoolDone} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			c.stop()
+			<-c.done
+			<-c.spoolDone
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *Client[T]) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]T, 0, c.cfg.BatchSize)
+	for {
+		select {
+		case item, ok := <-c.queue:
+			if !ok {
+				// Queue closed: deliver what is left and wait for the senders
+				c.dispatch(batch)
+				c.senders.Close(context.Background())
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) >= c.cfg.BatchSize {
+				c.dispatch(batch)
+				batch = make([]T, 0, c.cfg.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				c.dispatch(batch)
+				batch = make([]T, 0, c.cfg.BatchSize)
+			}
+		case <-c.stopped.Done():
+			// Close gave up waiting: put aside what is left without sending it.
+			// The queue is already closed, so this drains it.
+			for item := range c.queue {
+				batch = append(batch, item)
+			}
+			c.spoolOrDrop(batch)
+			c.senders.Close(context.Background())
+			return
+		}
+	}
+}
+
+// dispatch hands a batch to the sender pool, waiting while all senders are busy.
+// The wait applies backpressure to the bounded queue instead of spawning more goroutines.
+func (c *Client[T]) dispatch(batch []T) {
+	if len(batch) == 0 {
+		return
+	}
+	c.senders.Submit(func() { c.flush(batch) })
+}
+
+// flush delivers a batch, retrying with backoff, and spools or drops it when delivery
+// keeps failing or Close gives up waiting
+func (c *Client[T]) flush(batch []T) {
+	if len(batch) == 0 {
+		return
+	}
+
+	remaining := batch
+	for attempt := 0; !c.stopping(); attempt++ {
+		failed, err := c.send(remaining)
+		if errors.Is(err, errRejected) {
+			c.dropped.Add(int64(len(remaining)))
+			return
+		}
+		if err == nil && len(failed) == 0 {
+			return
+		}
+		if err == nil {
+			// Only retry the items the endpoint failed to store
+			remaining = failed
+		}
+
+		if attempt >= c.cfg.MaxRetries {
+			break
+		}
+
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-c.stopped.Done():
+		}
+	}
+
+	c.spoolOrDrop(remaining)
+}
+
+// spoolOrDrop puts aside items that could not be delivered
+func (c *Client[T]) spoolOrDrop(items []T) {
+	if len(items) == 0 || c.spool(items) {
+		return
+	}
+	c.dropped.Add(int64(len(items)))
+	slog.Error("Dropped batched items", "client", c.cfg.Name, "count", len(items), "retries", c.cfg.MaxRetries)
+}
+
+func (c *Client[T]) stopping() bool {
+	return c.stopped.Err() != nil
+}
+
+func (c *Client[T]) closingNow() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff returns an exponential delay with full jitter
+func (c *Client[T]) backoff(attempt int) time.Duration {
+	d := c.cfg.InitialBackoff << attempt
+	if d <= 0 || d > c.cfg.MaxBackoff {
+		d = c.cfg.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// response is the part of a batch endpoint's answer the client reads
+type response struct {
+	// Failed are the indexes of items the endpoint could not store
+	Failed []int `json:"failed"`
+}
+
+var (
+	errRetryable = errors.New("endpoint unavailable")
+	// errRejected means the batch is invalid and retrying or spooling it will not help
+	errRejected = errors.New("batch rejected")
+)
+
+// send posts one batch. It returns the items the endpoint reported as failed,
+// errRejected when the whole batch can't be delivered, or another error when the whole
+// batch should be retried.
+func (c *Client[T]) send(items []T) (failed []T, err error) {
+	body, err := c.encode(items)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errRejected, err)
+	}
+
+	var requests []trace.SpanContext
+	for _, item := range items {
+		if traced, ok := any(item).(Traced); ok {
+			requests = append(requests, traced.SpanContext())
+		}
+	}
+	ctx, span := tracing.StartBatch(c.cfg.Name+".send", requests, attribute.Int(c.cfg.Name+".count", len(items)))
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// Abort the request when Close gives up waiting instead of running out the timeout
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(c.stopped, cancel)()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("%w: status %d", errRetryable, resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 {
+		slog.Error("Endpoint rejected batched items", "client", c.cfg.Name, "count", len(items), "status", resp.StatusCode)
+		return nil, fmt.Errorf("%w: status %d", errRejected, resp.StatusCode)
+	}
+
+	var result response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		// Which items were stored is unknown, so the whole batch is sent again
+		return nil, fmt.Errorf("%w: invalid response: %v", errRetryable, err)
+	}
+
+	failed = make([]T, 0, len(result.Failed))
+	for _, i := range result.Failed {
+		if i >= 0 && i < len(items) {
+			failed = append(failed, items[i])
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,441 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// item is what the tests deliver
+type item struct {
+	UserID int `json:"user_id"`
+}
+
+type batchRequest struct {
+	Events []item `json:"events"`
+}
+
+type batchResponse struct {
+	Accepted int   `json:"accepted"`
+	Failed   []int `json:"failed"`
+}
+
+// loggingService records the items posted to it.
+// hold, when set, decides which batches wait for release before they are answered.
+type loggingService struct {
+	*httptest.Server
+
+	release     chan struct{}
+	releaseOnce sync.Once
+	hold        func(events []item) bool
+
+	mu       sync.Mutex
+	received map[int]int
+}
+
+func newLoggingService(t *testing.T, hold func(events []item) bool) *loggingService {
+	t.Helper()
+	s := &loggingService{release: make(chan struct{}), hold: hold, received: map[int]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.hold != nil && s.hold(req.Events) {
+			<-s.release
+		}
+
+		s.mu.Lock()
+		for _, e := range req.Events {
+			s.received[e.UserID]++
+		}
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(batchResponse{Accepted: len(req.Events), Failed: []int{}})
+	}))
+	t.Cleanup(s.Close)
+	// Never leave a held request behind, or Close waits for it forever
+	t.Cleanup(s.Release)
+	return s
+}
+
+// Release answers the held batches and stops holding new ones
+func (s *loggingService) Release() {
+	s.releaseOnce.Do(func() { close(s.release) })
+}
+
+// count returns how many distinct users had an item delivered
+func (s *loggingService) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.received)
+}
+
+// waitFor fails the test unless n distinct users had an item delivered within timeout
+func (s *loggingService) waitFor(t *testing.T, n int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for s.count() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("logging service received %d of %d items", s.count(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func testConfig(url string) Config {
+	return Config{
+		URL:            url,
+		Name:           "test",
+		QueueSize:      10,
+		BatchSize:      1,
+		FlushInterval:  10 * time.Millisecond,
+		Workers:        1,
+		MaxRetries:     0,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	}
+}
+
+func closeClient(t *testing.T, c *Client[item]) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestEnqueueSpoolsWhenQueueIsFull(t *testing.T) {
+	// Every delivery hangs, so the senders and then the queue fill up
+	svc := newLoggingService(t, func([]item) bool { return true })
+	cfg := testConfig(svc.URL)
+	cfg.SpoolDir = t.TempDir()
+	c := New(cfg, EncodeEvents[item])
+
+	// The queue and the overflow hold QueueSize items each
+	const items = 20
+	for i := 1; i <= items; i++ {
+		if !c.Enqueue(item{UserID: i}) {
+			t.Fatalf("item %d was dropped", i)
+		}
+	}
+	if got := c.Dropped(); got != 0 {
+		t.Fatalf("Dropped() = %d, want 0", got)
+	}
+
+	svc.Release()
+	svc.waitFor(t, items, 5*time.Second)
+	closeClient(t, c)
+}
+
+func TestEnqueueDropsWhenQueueIsFullWithoutSpool(t *testing.T) {
+	svc := newLoggingService(t, func([]item) bool { return true })
+	c := New(testConfig(svc.URL), EncodeEvents[item])
+
+	dropped := 0
+	for i := 1; i <= 20; i++ {
+		if !c.Enqueue(item{UserID: i}) {
+			dropped++
+		}
+	}
+	if dropped == 0 || c.Dropped() != int64(dropped) {
+		t.Fatalf("dropped %d items, Dropped() = %d", dropped, c.Dropped())
+	}
+
+	svc.Release()
+	closeClient(t, c)
+}
+
+func TestReplayDoesNotHoldUpDelivery(t *testing.T) {
+	const spooledUser = 1000
+
+	// Replaying the spool hangs; new items must still get through
+	svc := newLoggingService(t, func(events []item) bool { return events[0].UserID == spooledUser })
+	cfg := testConfig(svc.URL)
+	cfg.SpoolDir = t.TempDir()
+	if !writeSpoolFile(filepath.Join(cfg.SpoolDir, "batch-00000000000000000001-000001.jsonl"), []item{{UserID: spooledUser}}) {
+		t.Fatal("failed to write spool file")
+	}
+	c := New(cfg, EncodeEvents[item])
+	t.Cleanup(func() {
+		svc.Release()
+		closeClient(t, c)
+	})
+
+	// Let the replay start and hang
+	time.Sleep(5 * cfg.FlushInterval)
+	for i := 1; i <= 5; i++ {
+		c.Enqueue(item{UserID: i})
+	}
+	svc.waitFor(t, 5, 2*time.Second)
+}
+
+// Enqueueing from many requests while the client closes must not panic on the closed
+// queue, and every accepted item must be delivered
+func TestConcurrentEnqueueAndClose(t *testing.T) {
+	svc := newLoggingService(t, nil)
+	cfg := testConfig(svc.URL)
+	cfg.QueueSize, cfg.BatchSize, cfg.Workers = 1000, 50, 4
+	c := New(cfg, EncodeEvents[item])
+
+	var accepted sync.Map
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				userID := g*100 + i + 1
+				if c.Enqueue(item{UserID: userID}) {
+					accepted.Store(userID, true)
+				}
+			}
+		}(g)
+	}
+
+	time.Sleep(time.Millisecond)
+	closeClient(t, c)
+	wg.Wait()
+
+	accepted.Range(func(key, _ any) bool {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		if svc.received[key.(int)] != 1 {
+			t.Errorf("item of user %d was delivered %d times, want 1", key, svc.received[key.(int)])
+		}
+		return true
+	})
+}
+
+func TestFlushRetriesFailedItems(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[int]int{}
+	received := map[int]int{}
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Even users fail on their first attempt
+		mu.Lock()
+		defer mu.Unlock()
+		resp := batchResponse{Failed: []int{}}
+		for i, e := range req.Events {
+			attempts[e.UserID]++
+			if e.UserID%2 == 0 && attempts[e.UserID] == 1 {
+				resp.Failed = append(resp.Failed, i)
+				continue
+			}
+			received[e.UserID]++
+			resp.Accepted++
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer svc.Close()
+
+	cfg := testConfig(svc.URL)
+	cfg.BatchSize, cfg.MaxRetries = 10, 3
+	c := New(cfg, EncodeEvents[item])
+	for i := 1; i <= 10; i++ {
+		c.Enqueue(item{UserID: i})
+	}
+	closeClient(t, c)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i <= 10; i++ {
+		if received[i] != 1 {
+			t.Errorf("item of user %d was stored %d times, want 1", i, received[i])
+		}
+	}
+	if got := c.Dropped(); got != 0 {
+		t.Errorf("Dropped() = %d, want 0", got)
+	}
+}
+
+func TestCloseMeetsDeadlineWhenEndpointHangs(t *testing.T) {
+	// Every delivery hangs for longer than the deadline
+	svc := newLoggingService(t, func([]item) bool { return true })
+	cfg := testConfig(svc.URL)
+	cfg.MaxRetries = 3
+	cfg.SpoolDir = t.TempDir()
+	c := New(cfg, EncodeEvents[item])
+
+	const items = 5
+	for i := 1; i <= items; i++ {
+		c.Enqueue(item{UserID: i})
+	}
+	// Let the first batch reach the endpoint
+	time.Sleep(5 * cfg.FlushInterval)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := c.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Close = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %v with a 100ms deadline", elapsed)
+	}
+
+	// Nothing was delivered, so everything is spooled for the next start
+	files, err := filepath.Glob(filepath.Join(cfg.SpoolDir, spoolPattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spooled := 0
+	for _, name := range files {
+		batch, err := readSpoolFile[item](name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spooled += len(batch)
+	}
+	if spooled != items || c.Dropped() != 0 {
+		t.Errorf("spooled %d items and dropped %d, want %d spooled", spooled, c.Dropped(), items)
+	}
+}
+
+func TestRejectedBatchIsDropped(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		http.Error(w, "invalid event", http.StatusBadRequest)
+	}))
+	defer svc.Close()
+
+	cfg := testConfig(svc.URL)
+	cfg.BatchSize, cfg.MaxRetries = 3, 3
+	cfg.SpoolDir = t.TempDir()
+	c := New(cfg, EncodeEvents[item])
+	for i := 1; i <= 3; i++ {
+		c.Enqueue(item{UserID: i})
+	}
+	closeClient(t, c)
+
+	// Retrying or spooling a batch the endpoint rejects will not help
+	files, _ := filepath.Glob(filepath.Join(cfg.SpoolDir, spoolPattern))
+	mu.Lock()
+	defer mu.Unlock()
+	if got := c.Dropped(); got != 3 || requests != 1 || len(files) != 0 {
+		t.Errorf("Dropped() = %d after %d requests with %d spool files, want 3 after 1 request with none", got, requests, len(files))
+	}
+}
+
+func TestInvalidResponseIsRetried(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	received := map[int]int{}
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The first answer is cut off, as when a proxy closes the connection
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts++; attempts == 1 {
+			w.Write([]byte(`{"accepted":`))
+			return
+		}
+		for _, e := range req.Events {
+			received[e.UserID]++
+		}
+		json.NewEncoder(w).Encode(batchResponse{Accepted: len(req.Events), Failed: []int{}})
+	}))
+	defer svc.Close()
+
+	cfg := testConfig(svc.URL)
+	cfg.BatchSize, cfg.MaxRetries = 3, 3
+	c := New(cfg, EncodeEvents[item])
+	for i := 1; i <= 3; i++ {
+		c.Enqueue(item{UserID: i})
+	}
+	closeClient(t, c)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i <= 3; i++ {
+		if received[i] != 1 {
+			t.Errorf("item of user %d was stored %d times, want 1", i, received[i])
+		}
+	}
+	if got := c.Dropped(); got != 0 {
+		t.Errorf("Dropped() = %d, want 0", got)
+	}
+}
+
+func TestReplaySpoolsFailedItemsAgain(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[int]int{}
+	received := map[int]int{}
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// User 1 fails on the first replay
+		mu.Lock()
+		defer mu.Unlock()
+		resp := batchResponse{Failed: []int{}}
+		for i, e := range req.Events {
+			if attempts[e.UserID]++; e.UserID == 1 && attempts[e.UserID] == 1 {
+				resp.Failed = append(resp.Failed, i)
+				continue
+			}
+			received[e.UserID]++
+			resp.Accepted++
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer svc.Close()
+
+	cfg := testConfig(svc.URL)
+	cfg.BatchSize = 3
+	cfg.SpoolDir = t.TempDir()
+	if !writeSpoolFile(filepath.Join(cfg.SpoolDir, "batch-00000000000000000001-000001.jsonl"), []item{{UserID: 1}, {UserID: 2}, {UserID: 3}}) {
+		t.Fatal("failed to write spool file")
+	}
+	c := New(cfg, EncodeEvents[item])
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		stored := len(received)
+		mu.Unlock()
+		if stored == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("logging service received %d of 3 spooled items", stored)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	closeClient(t, c)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i <= 3; i++ {
+		if received[i] != 1 {
+			t.Errorf("item of user %d was stored %d times, want 1", i, received[i])
+		}
+	}
+	if got := c.Dropped(); got != 0 {
+		t.Errorf("Dropped() = %d, want 0", got)
+	}
+}
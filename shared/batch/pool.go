@@ -0,0 +1,105 @@
+package batch
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool runs tasks on a fixed number of goroutines fed by a bounded queue,
+// so bursts of background work can't spawn an unbounded number of goroutines.
+type Pool struct {
+	tasks chan func()
+	wg    sync.WaitGroup
+
+	// mu guards closed so tasks are never sent on a closed queue
+	mu     sync.RWMutex
+	closed bool
+
+	dropped atomic.Int64
+}
+
+func NewPool(workers, queueSize int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &Pool{tasks: make(chan func(), queueSize)}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// TrySubmit queues a task without blocking. It returns false and drops the task
+// when the queue is full or the pool is closed.
+func (p *Pool) TrySubmit(task func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Submit queues a task, waiting for room in the queue. It returns false if the pool is closed.
+func (p *Pool) Submit(task func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+
+	p.tasks <- task
+	return true
+}
+
+// Dropped returns the number of tasks that were rejected
+func (p *Pool) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// QueueDepth returns the number of tasks waiting for a worker
+func (p *Pool) QueueDepth() int {
+	return len(p.tasks)
+}
+
+// Close stops accepting tasks and waits for the queued ones to finish or for ctx to expire
+func (p *Pool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,124 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmitRunsEveryTask(t *testing.T) {
+	p := NewPool(4, 8)
+
+	const submitters, tasks = 10, 100
+	var ran atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < submitters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < tasks; j++ {
+				if !p.Submit(func() { ran.Add(1) }) {
+					t.Error("Submit refused a task before Close")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := ran.Load(); got != submitters*tasks {
+		t.Errorf("ran %d tasks, want %d", got, submitters*tasks)
+	}
+	if got := p.Dropped(); got != 0 {
+		t.Errorf("Dropped() = %d, want 0", got)
+	}
+}
+
+func TestTrySubmitDropsWhenQueueIsFull(t *testing.T) {
+	p := NewPool(1, 2)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	// Occupy the only worker, then fill the queue
+	p.Submit(func() { close(started); <-release })
+	<-started
+	for i := 0; i < 2; i++ {
+		if !p.TrySubmit(func() {}) {
+			t.Fatalf("TrySubmit %d refused a task with room in the queue", i)
+		}
+	}
+	if got := p.QueueDepth(); got != 2 {
+		t.Errorf("QueueDepth() = %d, want 2", got)
+	}
+
+	if p.TrySubmit(func() {}) {
+		t.Error("TrySubmit accepted a task with the queue full")
+	}
+	if got := p.Dropped(); got != 1 {
+		t.Errorf("Dropped() = %d, want 1", got)
+	}
+
+	close(release)
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// Submitting while the pool closes must neither panic on the closed queue nor lose an
+// accepted task
+func TestSubmitRacingClose(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		p := NewPool(2, 4)
+
+		var accepted, ran atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(try bool) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					submit := p.Submit
+					if try {
+						submit = p.TrySubmit
+					}
+					if submit(func() { ran.Add(1) }) {
+						accepted.Add(1)
+					}
+				}
+			}(i%2 == 0)
+		}
+
+		if err := p.Close(context.Background()); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		wg.Wait()
+
+		if accepted.Load() != ran.Load() {
+			t.Fatalf("accepted %d tasks but ran %d", accepted.Load(), ran.Load())
+		}
+		if got := accepted.Load() + p.Dropped(); got != 8*50 {
+			t.Fatalf("accepted and dropped %d tasks, want %d", got, 8*50)
+		}
+	}
+}
+
+func TestCloseGivesUpWhenContextExpires(t *testing.T) {
+	p := NewPool(1, 1)
+	release := make(chan struct{})
+	defer close(release)
+	p.Submit(func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if p.Submit(func() {}) {
+		t.Error("Submit accepted a task after Close")
+	}
+}
@@ -0,0 +1,198 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// spoolPattern matches the files written by spool, which sort in write order
+const spoolPattern = "batch-*.jsonl"
+
+// spool writes undeliverable items to the spool directory as JSON lines.
+// It returns false when spooling is disabled or the write failed.
+func (c *Client[T]) spool(items []T) bool {
+	if c.cfg.SpoolDir == "" || len(items) == 0 {
+		return false
+	}
+
+	// Batches can be spooled by several senders at once, so add a sequence number to the timestamp
+	name := filepath.Join(c.cfg.SpoolDir, fmt.Sprintf("batch-%020d-%06d.jsonl", time.Now().UnixNano(), c.spoolSeq.Add(1)%1000000))
+	return writeSpoolFile(name, items)
+}
+
+// writeSpoolFile atomically replaces name with the given items
+func writeSpoolFile[T any](name string, items []T) bool {
+	tmp := name + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		slog.Error("Failed to spool batched items", "file", name, "error", err)
+		return false
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			slog.Error("Failed to spool batched items", "file", name, "error", err)
+			return false
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		slog.Error("Failed to spool batched items", "file", name, "error", err)
+		return false
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		slog.Error("Failed to spool batched items", "file", name, "error", err)
+		return false
+	}
+
+	// Rename last so a crash never leaves a half-written batch behind
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		slog.Error("Failed to spool batched items", "file", name, "error", err)
+		return false
+	}
+
+	return true
+}
+
+// runSpool spools the overflow and replays the spool directory every FlushInterval.
+// It runs apart from the delivery loop, so a slow replay while the endpoint is
+// down never holds up the queue.
+func (c *Client[T]) runSpool() {
+	defer close(c.spoolDone)
+
+	ticker := time.NewTicker(c.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.spoolOverflow()
+			c.replaySpool()
+		case <-c.closing:
+			// Whatever is left in the spool is replayed after the next start
+			c.spoolOverflow()
+			return
+		}
+	}
+}
+
+// addOverflow keeps an item that didn't fit in the queue until it is spooled.
+// The overflow is bounded by QueueSize; it returns false when spooling is disabled or
+// the overflow is full too.
+func (c *Client[T]) addOverflow(item T) bool {
+	if c.cfg.SpoolDir == "" {
+		return false
+	}
+
+	c.overflowMu.Lock()
+	defer c.overflowMu.Unlock()
+	if len(c.overflow) >= c.cfg.QueueSize {
+		return false
+	}
+	c.overflow = append(c.overflow, item)
+	return true
+}
+
+// spoolOverflow writes the items kept by addOverflow to the spool directory
+func (c *Client[T]) spoolOverflow() {
+	c.overflowMu.Lock()
+	items := c.overflow
+	c.overflow = nil
+	c.overflowMu.Unlock()
+
+	if len(items) > 0 && !c.spool(items) {
+		c.dropped.Add(int64(len(items)))
+		slog.Error("Dropped batched items", "client", c.cfg.Name, "count", len(items), "reason", "queue full")
+	}
+}
+
+// replaySpool delivers spooled batches, oldest first, until one fails or the client closes
+func (c *Client[T]) replaySpool() {
+	if c.cfg.SpoolDir == "" || c.closingNow() {
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(c.cfg.SpoolDir, spoolPattern))
+	if err != nil || len(files) == 0 {
+		return
+	}
+	sort.Strings(files)
+
+	for _, name := range files {
+		items, err := readSpoolFile[T](name)
+		if err != nil {
+			slog.Warn("Discarding unreadable spool file", "file", name, "error", err)
+			os.Remove(name)
+			continue
+		}
+
+		for start := 0; start < len(items); start += c.cfg.BatchSize {
+			if c.closingNow() {
+				c.keepSpooled(name, items, start)
+				return
+			}
+
+			end := start + c.cfg.BatchSize
+			if end > len(items) {
+				end = len(items)
+			}
+
+			failed, err := c.send(items[start:end])
+			switch {
+			case errors.Is(err, errRejected):
+				c.dropped.Add(int64(end - start))
+			case err != nil:
+				// Still down: keep what was not delivered for the next tick
+				c.keepSpooled(name, items, start)
+				return
+			case len(failed) > 0 && !c.spool(failed):
+				// The endpoint failed to store some items; they are replayed again later
+				c.dropped.Add(int64(len(failed)))
+			}
+		}
+
+		os.Remove(name)
+	}
+}
+
+// keepSpooled leaves items[start:] in the spool file name for a later replay
+func (c *Client[T]) keepSpooled(name string, items []T, start int) {
+	if start > 0 && !writeSpoolFile(name, items[start:]) {
+		c.dropped.Add(int64(len(items) - start))
+		os.Remove(name)
+	}
+}
+
+func readSpoolFile[T any](name string) ([]T, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []T
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
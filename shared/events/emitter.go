@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/yelp-sample-v2/shared/batch"
+)
+
+type Config struct {
+	// URL is the base URL of the logging service
+	URL string
+	// Source names the emitting service and is stamped on every event
+	Source        string
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+}
+
+// ConfigFromEnv reads the emitter configuration from LOGGING_SERVICE_URL and EVENTS_* environment variables
+func ConfigFromEnv(source string) Config {
+	cfg := Config{
+		URL:           os.Getenv("LOGGING_SERVICE_URL"),
+		Source:        source,
+		QueueSize:     10000,
+		BatchSize:     100,
+		FlushInterval: 2 * time.Second,
+		MaxRetries:    3,
+	}
+	if cfg.URL == "" {
+		cfg.URL = "http://logging-service:8083"
+	}
+	if n, err := strconv.Atoi(os.Getenv("EVENTS_QUEUE_SIZE")); err == nil && n > 0 {
+		cfg.QueueSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("EVENTS_BATCH_SIZE")); err == nil && n > 0 {
+		cfg.BatchSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("EVENTS_FLUSH_INTERVAL")); err == nil && d > 0 {
+		cfg.FlushInterval = d
+	}
+	return cfg
+}
+
+// Emitter buffers events and delivers them to the logging service's /events endpoint in batches
+type Emitter struct {
+	cfg    Config
+	client *batch.Client[Event]
+
+	// invalid counts the events dropped before they were queued
+	invalid atomic.Int64
+}
+
+// Default is the emitter used by Emit
+var Default *Emitter
+
+// Start creates the default emitter
+func Start(cfg Config) {
+	Default = NewEmitter(cfg)
+}
+
+// Emit queues an event on the default emitter. It is a no-op when Start was not called.
+func Emit(e Event) bool {
+	if Default == nil {
+		return false
+	}
+	return Default.Emit(e)
+}
+
+// Close drains the default emitter
+func Close(ctx context.Context) error {
+	if Default == nil {
+		return nil
+	}
+	return Default.Close(ctx)
+}
+
+func NewEmitter(cfg Config) *Emitter {
+	return &Emitter{
+		cfg: cfg,
+		client: batch.New(batch.Config{
+			URL:           cfg.URL + "/events",
+			Name:          "events",
+			QueueSize:     cfg.QueueSize,
+			BatchSize:     cfg.BatchSize,
+			FlushInterval: cfg.FlushInterval,
+			Workers:       1,
+			MaxRetries:    cfg.MaxRetries,
+		}, batch.EncodeEvents[Event]),
+	}
+}
+
+// Emit queues an event without blocking. Events are validated before they are queued,
+// so schema mistakes surface in the emitting service's logs.
+func (e *Emitter) Emit(event Event) bool {
+	if event.Source == "" {
+		event.Source = e.cfg.Source
+	}
+	if err := event.Validate(); err != nil {
+		slog.Warn("Dropping invalid event", "event_type", event.Type, "error", err)
+		e.invalid.Add(1)
+		return false
+	}
+	return e.client.Enqueue(event)
+}
+
+// Dropped returns the number of events that were never delivered
+func (e *Emitter) Dropped() int64 {
+	return e.invalid.Load() + e.client.Dropped()
+}
+
+// QueueDepth returns the number of events waiting in the buffer
+func (e *Emitter) QueueDepth() int {
+	return e.client.QueueDepth()
+}
+
+// Close stops accepting events and flushes everything that is buffered
+func (e *Emitter) Close(ctx context.Context) error {
+	return e.client.Close(ctx)
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEmitterRetriesFailedEvents(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[int]int{}
+	stored := map[int]int{}
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Events []Event `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Events of even users fail on their first attempt, as when a Cassandra write times out
+		mu.Lock()
+		defer mu.Unlock()
+		failed := []int{}
+		for i, e := range req.Events {
+			attempts[e.UserID]++
+			if e.UserID%2 == 0 && attempts[e.UserID] == 1 {
+				failed = append(failed, i)
+				continue
+			}
+			stored[e.UserID]++
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"accepted": len(req.Events) - len(failed),
+			"failed":   failed,
+		})
+	}))
+	defer svc.Close()
+
+	emitter := NewEmitter(Config{
+		URL:           svc.URL,
+		Source:        "test",
+		QueueSize:     100,
+		BatchSize:     10,
+		FlushInterval: 10 * time.Millisecond,
+		MaxRetries:    3,
+	})
+	for userID := 1; userID <= 10; userID++ {
+		event, err := New(TypeCheckin, userID, 1, Checkin{CheckinID: userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !emitter.Emit(event) {
+			t.Fatalf("event of user %d was dropped", userID)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := emitter.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for userID := 1; userID <= 10; userID++ {
+		if stored[userID] != 1 {
+			t.Errorf("event of user %d was stored %d times, want 1", userID, stored[userID])
+		}
+	}
+	if got := emitter.Dropped(); got != 0 {
+		t.Errorf("Dropped() = %d, want 0", got)
+	}
+}
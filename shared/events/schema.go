@@ -0,0 +1,209 @@
+package events
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the version of the event envelope and payloads emitted by this package
+const SchemaVersion = 1
+
+// Event types
+const (
+	TypeBusinessView    = "business_view"
+	TypeSearchPerformed = "search_performed"
+	TypeReviewCreated   = "review_created"
+	TypeBookmarkAdded   = "bookmark_added"
+	TypeCheckin         = "checkin"
+)
+
+// maxClockSkew is how far in the future an event may claim to have happened
+const maxClockSkew = 5 * time.Minute
+
+// Event is the versioned envelope shared by every event type.
+// Type-specific fields live in Payload and are validated per type.
+type Event struct {
+	ID         string          `json:"id"`
+	Version    int             `json:"version"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Source     string          `json:"source"`
+	UserID     int             `json:"user_id"` // 0 for anonymous users
+	BusinessID int             `json:"business_id,omitempty"`
+	IPAddress  string          `json:"ip_address,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+// BusinessView is the payload of a business_view event
+type BusinessView struct {
+	Referrer string `json:"referrer,omitempty"`
+}
+
+// SearchPerformed is the payload of a search_performed event
+type SearchPerformed struct {
+	Query   string            `json:"query,omitempty"`
+	Filters map[string]string `json:"filters,omitempty"`
+	Page    int               `json:"page"`
+	Limit   int               `json:"limit"`
+}
+
+// ReviewCreated is the payload of a review_created event
+type ReviewCreated struct {
+	ReviewID int `json:"review_id"`
+	Rating   int `json:"rating"`
+}
+
+// BookmarkAdded is the payload of a bookmark_added event
+type BookmarkAdded struct {
+	CollectionID int `json:"collection_id"`
+}
+
+// Checkin is the payload of a checkin event
+type Checkin struct {
+	CheckinID      int     `json:"checkin_id"`
+	DistanceMeters float64 `json:"distance_meters"`
+}
+
+// New builds an event of the given type with a fresh ID and the current time
+func New(eventType string, userID, businessID int, payload interface{}) (Event, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode %s payload: %w", eventType, err)
+	}
+
+	return Event{
+		ID:         newID(),
+		Version:    SchemaVersion,
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		UserID:     userID,
+		BusinessID: businessID,
+		Payload:    raw,
+	}, nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+	ErrUnknownType        = errors.New("unknown event type")
+)
+
+// Validate checks the envelope and the payload for the event type
+func (e Event) Validate() error {
+	if e.Version != SchemaVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, e.Version)
+	}
+	if e.OccurredAt.IsZero() {
+		return errors.New("occurred_at is required")
+	}
+	if e.OccurredAt.After(time.Now().Add(maxClockSkew)) {
+		return errors.New("occurred_at is in the future")
+	}
+	if e.UserID < 0 {
+		return errors.New("user_id must not be negative")
+	}
+
+	switch e.Type {
+	case TypeBusinessView:
+		var p BusinessView
+		if err := e.decodePayload(&p); err != nil {
+			return err
+		}
+		return e.requireBusiness()
+
+	case TypeSearchPerformed:
+		var p SearchPerformed
+		if err := e.decodePayload(&p); err != nil {
+			return err
+		}
+		if p.Query == "" && len(p.Filters) == 0 {
+			return errors.New("search_performed requires a query or filters")
+		}
+		if p.Page < 1 || p.Limit < 1 {
+			return errors.New("search_performed requires a positive page and limit")
+		}
+		return nil
+
+	case TypeReviewCreated:
+		var p ReviewCreated
+		if err := e.decodePayload(&p); err != nil {
+			return err
+		}
+		if p.ReviewID <= 0 {
+			return errors.New("review_created requires review_id")
+		}
+		if p.Rating < 1 || p.Rating > 5 {
+			return errors.New("review_created rating must be between 1 and 5")
+		}
+		if e.UserID == 0 {
+			return errors.New("review_created requires user_id")
+		}
+		return e.requireBusiness()
+
+	case TypeBookmarkAdded:
+		var p BookmarkAdded
+		if err := e.decodePayload(&p); err != nil {
+			return err
+		}
+		if p.CollectionID <= 0 {
+			return errors.New("bookmark_added requires collection_id")
+		}
+		if e.UserID == 0 {
+			return errors.New("bookmark_added requires user_id")
+		}
+		return e.requireBusiness()
+
+	case TypeCheckin:
+		var p Checkin
+		if err := e.decodePayload(&p); err != nil {
+			return err
+		}
+		if p.CheckinID <= 0 {
+			return errors.New("checkin requires checkin_id")
+		}
+		if p.DistanceMeters < 0 {
+			return errors.New("checkin distance_meters must not be negative")
+		}
+		if e.UserID == 0 {
+			return errors.New("checkin requires user_id")
+		}
+		return e.requireBusiness()
+
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownType, e.Type)
+	}
+}
+
+func (e Event) requireBusiness() error {
+	if e.BusinessID <= 0 {
+		return fmt.Errorf("%s requires business_id", e.Type)
+	}
+	return nil
+}
+
+// decodePayload strictly decodes the payload, rejecting unknown fields
+func (e Event) decodePayload(v interface{}) error {
+	if len(e.Payload) == 0 {
+		e.Payload = json.RawMessage("{}")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(e.Payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid %s payload: %w", e.Type, err)
+	}
+	return nil
+}
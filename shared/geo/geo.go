@@ -0,0 +1,18 @@
+// Package geo has the geographic calculations shared by the services
+package geo
+
+import "math"
+
+// EarthRadiusMeters is the mean radius of the Earth
+const EarthRadiusMeters = 6371000.0
+
+// DistanceMeters returns the great-circle distance between two coordinates (haversine formula)
+func DistanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusMeters * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,27 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceMeters(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want, tolerance        float64
+	}{
+		{"same point", 35.6812, 139.7671, 35.6812, 139.7671, 0, 0.001},
+		{"one degree of latitude", 0, 0, 1, 0, 111195, 1},
+		{"Tokyo to Osaka stations", 35.6812, 139.7671, 34.7025, 135.4959, 403000, 1000},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111195, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DistanceMeters(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
+			if math.Abs(got-tt.want) > tt.tolerance {
+				t.Errorf("DistanceMeters = %.0f, want %.0f ± %.0f", got, tt.want, tt.tolerance)
+			}
+		})
+	}
+}
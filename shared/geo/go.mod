@@ -0,0 +1,3 @@
+module github.com/yelp-sample-v2/shared/geo
+
+go 1.22.0
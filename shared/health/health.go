@@ -0,0 +1,266 @@
+// Package health answers the readiness probe of every service with the state of its
+// dependencies. Each service registers checks, such as a database ping, and /ready fails
+// while a critical one is down so Kubernetes and the gateway stop sending it traffic.
+// The liveness probe, /health, deliberately checks nothing: restarting pods doesn't fix
+// an unreachable database.
+package health
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Statuses of a check and of the service as a whole
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+
+	// StatusReady means every check passed
+	StatusReady = "ready"
+	// StatusDegraded means an optional check failed; the service still takes traffic
+	StatusDegraded = "degraded"
+	// StatusNotReady means a critical check failed
+	StatusNotReady = "not ready"
+)
+
+var (
+	errTimedOut     = errors.New("timed out")
+	errStillRunning = errors.New("previous check is still running")
+)
+
+type Config struct {
+	// Timeout bounds a run of the checks; it stays below the probes' own timeout
+	Timeout time.Duration
+	// CacheFor is how long results are reused, so frequent probes from Kubernetes and
+	// the gateway don't each reach the dependencies
+	CacheFor time.Duration
+}
+
+// ConfigFromEnv reads the configuration from HEALTH_CHECK_TIMEOUT (default 2s) and
+// HEALTH_CHECK_CACHE (default 5s)
+func ConfigFromEnv() Config {
+	cfg := Config{Timeout: 2 * time.Second, CacheFor: 5 * time.Second}
+	if d, err := time.ParseDuration(os.Getenv("HEALTH_CHECK_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("HEALTH_CHECK_CACHE")); err == nil && d >= 0 {
+		cfg.CacheFor = d
+	}
+	return cfg
+}
+
+// Check reports whether a dependency is usable; it should give up once ctx is done
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check
+type Result struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the body of the readiness response
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type check struct {
+	name     string
+	critical bool
+	// each, when set, checks several dependencies found at run time, such as the
+	// gateway's upstreams, reported as name.key
+	each    func(ctx context.Context) map[string]error
+	fn      Check
+	running atomic.Bool
+}
+
+// Checker runs a service's checks
+type Checker struct {
+	cfg Config
+
+	mu     sync.Mutex
+	checks []*check
+	report *Report
+	expiry time.Time
+	// pending is closed when the run in progress finishes
+	pending chan struct{}
+	// failing remembers what failed last time, to log only changes
+	failing map[string]bool
+}
+
+func New(cfg Config) *Checker {
+	return &Checker{cfg: cfg, failing: map[string]bool{}}
+}
+
+// Critical registers a check the service can't work without; while it fails the
+// service isn't ready
+func (h *Checker) Critical(name string, fn Check) {
+	h.add(&check{name: name, critical: true, fn: fn})
+}
+
+// Optional registers a check that is reported but leaves the service ready, only
+// degraded
+func (h *Checker) Optional(name string, fn Check) {
+	h.add(&check{name: name, fn: fn})
+}
+
+// OptionalEach registers an optional check of dependencies that change at run time;
+// fn returns the outcome per dependency
+func (h *Checker) OptionalEach(name string, fn func(ctx context.Context) map[string]error) {
+	h.add(&check{name: name, each: fn})
+}
+
+func (h *Checker) add(c *check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, c)
+	h.report = nil
+}
+
+// Ready answers the readiness probe with the status of every dependency: 200 when
+// ready or degraded, 503 when a critical check failed
+func (h *Checker) Ready(c *gin.Context) {
+	report := h.Report()
+	status := http.StatusOK
+	if report.Status == StatusNotReady {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Report returns the latest results, running the checks when they are older than
+// CacheFor. Callers arriving during a run wait for it rather than starting another.
+func (h *Checker) Report() *Report {
+	h.mu.Lock()
+	if h.report != nil && time.Now().Before(h.expiry) {
+		report := h.report
+		h.mu.Unlock()
+		return report
+	}
+	if h.pending != nil {
+		pending := h.pending
+		h.mu.Unlock()
+		<-pending
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.report
+	}
+	pending := make(chan struct{})
+	h.pending = pending
+	checks := h.checks
+	h.mu.Unlock()
+
+	report := h.run(checks)
+
+	h.mu.Lock()
+	h.logChanges(report)
+	h.report, h.expiry, h.pending = report, time.Now().Add(h.cfg.CacheFor), nil
+	h.mu.Unlock()
+	close(pending)
+	return report
+}
+
+// run runs the checks in parallel. A check still going when the timeout passes is
+// reported down and left to finish in the background; it isn't started again until
+// it has.
+func (h *Checker) run(checks []*check) *Report {
+	// Not the request's context: the results are shared with other callers
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Timeout)
+	defer cancel()
+
+	report := &Report{Status: StatusReady, Checks: map[string]Result{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, chk := range checks {
+		wg.Add(1)
+		go func(chk *check) {
+			defer wg.Done()
+			start := time.Now()
+			errs := chk.do(ctx)
+			latency := float64(time.Since(start).Microseconds()) / 1000
+
+			mu.Lock()
+			defer mu.Unlock()
+			for name, err := range errs {
+				result := Result{Status: StatusUp, Critical: chk.critical, LatencyMs: latency, CheckedAt: start}
+				if err != nil {
+					result.Status, result.Error = StatusDown, err.Error()
+					if chk.critical {
+						report.Status = StatusNotReady
+					} else if report.Status == StatusReady {
+						report.Status = StatusDegraded
+					}
+				}
+				report.Checks[name] = result
+			}
+		}(chk)
+	}
+	wg.Wait()
+	return report
+}
+
+// do runs the check until it finishes or ctx is done, returning the outcome per name
+func (c *check) do(ctx context.Context) map[string]error {
+	if !c.running.CompareAndSwap(false, true) {
+		return map[string]error{c.name: errStillRunning}
+	}
+	done := make(chan map[string]error, 1)
+	go func() {
+		defer c.running.Store(false)
+		if c.each == nil {
+			done <- map[string]error{c.name: c.fn(ctx)}
+			return
+		}
+		errs := map[string]error{}
+		for key, err := range c.each(ctx) {
+			errs[c.name+"."+key] = err
+		}
+		done <- errs
+	}()
+
+	select {
+	case errs := <-done:
+		return errs
+	case <-ctx.Done():
+		return map[string]error{c.name: errTimedOut}
+	}
+}
+
+// logChanges logs checks that started failing or recovered since the last run
+func (h *Checker) logChanges(report *Report) {
+	names := make([]string, 0, len(report.Checks))
+	for name := range report.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result := report.Checks[name]
+		failing := result.Status == StatusDown
+		if failing == h.failing[name] {
+			continue
+		}
+		if failing {
+			slog.Warn("Health check failed", "check", name, "critical", result.Critical, "error", result.Error)
+		} else {
+			slog.Info("Health check recovered", "check", name)
+		}
+		h.failing[name] = failing
+	}
+	for name := range h.failing {
+		if _, ok := report.Checks[name]; !ok {
+			delete(h.failing, name)
+		}
+	}
+}
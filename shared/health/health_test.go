@@ -0,0 +1,206 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func up(context.Context) error   { return nil }
+func down(context.Context) error { return errors.New("connection refused") }
+
+func TestReadyStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		register   func(h *Checker)
+		wantStatus string
+		wantCode   int
+		wantChecks map[string]string
+	}{
+		{
+			name: "all up",
+			register: func(h *Checker) {
+				h.Critical("database", up)
+				h.Optional("logging", up)
+			},
+			wantStatus: StatusReady,
+			wantCode:   http.StatusOK,
+			wantChecks: map[string]string{"database": StatusUp, "logging": StatusUp},
+		},
+		{
+			name: "optional down",
+			register: func(h *Checker) {
+				h.Critical("database", up)
+				h.Optional("logging", down)
+			},
+			wantStatus: StatusDegraded,
+			wantCode:   http.StatusOK,
+			wantChecks: map[string]string{"database": StatusUp, "logging": StatusDown},
+		},
+		{
+			name: "critical down",
+			register: func(h *Checker) {
+				h.Critical("database", down)
+				h.Optional("logging", down)
+			},
+			wantStatus: StatusNotReady,
+			wantCode:   http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"database": StatusDown, "logging": StatusDown},
+		},
+		{
+			name: "each dependency",
+			register: func(h *Checker) {
+				h.OptionalEach("upstream", func(context.Context) map[string]error {
+					return map[string]error{"review": nil, "business": errors.New("circuit breaker is open")}
+				})
+			},
+			wantStatus: StatusDegraded,
+			wantCode:   http.StatusOK,
+			wantChecks: map[string]string{"upstream.review": StatusUp, "upstream.business": StatusDown},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(Config{Timeout: time.Second})
+			tt.register(h)
+
+			r := gin.New()
+			r.GET("/ready", h.Ready)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			var report Report
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.wantCode || report.Status != tt.wantStatus {
+				t.Errorf("/ready answered %d %q, want %d %q", w.Code, report.Status, tt.wantCode, tt.wantStatus)
+			}
+			if len(report.Checks) != len(tt.wantChecks) {
+				t.Errorf("checks = %+v, want %v", report.Checks, tt.wantChecks)
+			}
+			for name, want := range tt.wantChecks {
+				result := report.Checks[name]
+				if result.Status != want || (want == StatusDown) != (result.Error != "") {
+					t.Errorf("check %s = %+v, want %s", name, result, want)
+				}
+			}
+		})
+	}
+}
+
+// countingCheck counts its runs
+func countingCheck(runs *atomic.Int32) Check {
+	return func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}
+}
+
+func TestReportIsCached(t *testing.T) {
+	var runs atomic.Int32
+	h := New(Config{Timeout: time.Second, CacheFor: time.Hour})
+	h.Critical("database", countingCheck(&runs))
+
+	first := h.Report()
+	if second := h.Report(); second != first || runs.Load() != 1 {
+		t.Errorf("%d runs for two reports within CacheFor, want 1", runs.Load())
+	}
+
+	// A new check invalidates the cached results
+	h.Optional("cache", up)
+	if report := h.Report(); len(report.Checks) != 2 || runs.Load() != 2 {
+		t.Errorf("after adding a check: %d checks reported, %d runs; want 2 and 2", len(report.Checks), runs.Load())
+	}
+
+	uncached := New(Config{Timeout: time.Second})
+	var uncachedRuns atomic.Int32
+	uncached.Critical("database", countingCheck(&uncachedRuns))
+	uncached.Report()
+	uncached.Report()
+	if uncachedRuns.Load() != 2 {
+		t.Errorf("%d runs for two reports without caching, want 2", uncachedRuns.Load())
+	}
+}
+
+func TestConcurrentReportsShareRun(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	h := New(Config{Timeout: time.Second})
+	h.Critical("database", func(context.Context) error {
+		runs.Add(1)
+		<-release
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	reports := make([]*Report, 10)
+	for i := range reports {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reports[i] = h.Report()
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Errorf("%d runs for concurrent reports, want 1", runs.Load())
+	}
+	for i, report := range reports {
+		if report != reports[0] {
+			t.Errorf("caller %d got a different report", i)
+		}
+	}
+}
+
+func TestSlowCheckTimesOut(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	h := New(Config{Timeout: 20 * time.Millisecond})
+	// The check ignores its context, like a driver stuck on a dead connection
+	h.Critical("database", func(context.Context) error {
+		runs.Add(1)
+		<-release
+		return nil
+	})
+	h.Optional("cache", up)
+
+	start := time.Now()
+	report := h.Report()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Report took %v with a 20ms timeout", elapsed)
+	}
+	if got := report.Checks["database"]; got.Status != StatusDown || got.Error != errTimedOut.Error() {
+		t.Errorf("slow check = %+v, want down: %v", got, errTimedOut)
+	}
+	if report.Status != StatusNotReady || report.Checks["cache"].Status != StatusUp {
+		t.Errorf("report = %+v, want not ready with the other check up", report)
+	}
+
+	// The stuck check isn't started again until it returns
+	report = h.Report()
+	if got := report.Checks["database"]; got.Error != errStillRunning.Error() || runs.Load() != 1 {
+		t.Errorf("check still running = %+v after %d runs, want %v after 1", got, runs.Load(), errStillRunning)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for h.Report().Checks["database"].Status != StatusUp {
+		if time.Now().After(deadline) {
+			t.Fatal("check never ran again after the stuck run returned")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type loggerKey struct{}
+
+// ginKey is where the request's logger is kept in the gin context
+const ginKey = "logger"
+
+// quietPaths are probed and scraped all the time; they are logged at debug level
+// whatever their status
+var quietPaths = map[string]bool{"/health": true, "/ready": true, "/metrics": true}
+
+// From returns the logger of the request ctx belongs to, or the default logger outside
+// of one
+func From(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// With adds attributes to every later record of the request, e.g. the user once the
+// caller is authenticated
+func With(c *gin.Context, args ...any) {
+	set(c, From(c.Request.Context()).With(args...))
+}
+
+func set(c *gin.Context, l *slog.Logger) {
+	c.Set(ginKey, l)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), loggerKey{}, l))
+}
+
+// Middleware gives each request a logger carrying its request ID, method and route, and
+// logs the request once it is handled. userHeader names the header the gateway puts
+// the authenticated user in; it is "" where callers could forge it. It must run after
+// tracing.Middleware, which sets the request ID.
+func Middleware(userHeader string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		args := []any{"request_id", c.GetHeader("X-Request-ID"), "method", c.Request.Method}
+		if route := c.FullPath(); route != "" {
+			args = append(args, "route", route)
+		}
+		if userHeader != "" {
+			if user := c.GetHeader(userHeader); user != "" {
+				args = append(args, "user_id", user)
+			}
+		}
+		set(c, slog.Default().With(args...))
+
+		c.Next()
+
+		l := From(c.Request.Context())
+		if value, ok := c.Get(ginKey); ok {
+			l = value.(*slog.Logger)
+		}
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case quietPaths[c.Request.URL.Path]:
+			// Including a failing /ready while shutting down, which is expected
+			level = slog.LevelDebug
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.Int("status", status),
+			slog.String("path", c.Request.URL.Path),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		l.LogAttrs(c.Request.Context(), level, "Request handled", attrs...)
+	}
+}
+
+// Recovery answers 500 to requests whose handler panicked and logs the panic with its
+// stack
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		From(c.Request.Context()).Error("Handler panicked", "panic", fmt.Sprint(err), "stack", string(debug.Stack()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
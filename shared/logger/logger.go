@@ -0,0 +1,65 @@
+// Package logger sets up structured JSON logging with log/slog for every service.
+// Records carry the service name, and within a request the request ID, route and user.
+// Credentials, tokens and email addresses are redacted before anything is written.
+package logger
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Config struct {
+	// Service is recorded as service on every record
+	Service string
+	// Level is the least severe level written
+	Level slog.Level
+
+	// unknownLevel is a LOG_LEVEL that could not be read, reported once logging starts
+	unknownLevel string
+}
+
+// ConfigFromEnv reads the logging configuration from LOG_LEVEL: debug, info (default),
+// warn or error
+func ConfigFromEnv(service string) Config {
+	cfg := Config{Service: service, Level: slog.LevelInfo}
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		if err := cfg.Level.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+			cfg.Level = slog.LevelInfo
+			cfg.unknownLevel = level
+		}
+	}
+	return cfg
+}
+
+// Start makes a JSON logger writing to stdout the default, so slog's functions and the
+// standard log package both go through it. Gin's debug output is turned off unless
+// GIN_MODE asks for it, as it isn't JSON.
+func Start(cfg Config) {
+	slog.SetDefault(New(os.Stdout, cfg))
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	if cfg.unknownLevel != "" {
+		slog.Warn("Unknown LOG_LEVEL, logging at info", "log_level", cfg.unknownLevel)
+	}
+}
+
+// New returns a JSON logger writing to w
+func New(w io.Writer, cfg Config) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       cfg.Level,
+		ReplaceAttr: redact,
+	})
+	return slog.New(handler).With("service", cfg.Service)
+}
+
+// Fatal logs at error level and exits. It is for failures that keep a service from
+// starting.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys are parts of attribute names whose values are never logged
+var secretKeys = []string{"password", "token", "secret", "authorization", "cookie", "api_key", "apikey"}
+
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	bearerPattern = regexp.MustCompile(`(?i)bearer\s+\S+`)
+	// jwtPattern matches JSON Web Tokens, whose header always starts with {" in base64
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// redact is the handler's ReplaceAttr. Attributes named like credentials or emails are
+// replaced outright; every other string, including messages and errors, has email
+// addresses and tokens masked.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	if key == "email" || strings.HasSuffix(key, "_email") {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch v := a.Value.Resolve(); v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, scrub(v.String()))
+	case slog.KindAny:
+		switch value := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, scrub(value.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, scrub(value.String()))
+		}
+	}
+	return a
+}
+
+// scrub masks email addresses and tokens in free text
+func scrub(s string) string {
+	if !strings.ContainsAny(s, "@.") && !strings.Contains(strings.ToLower(s), "bearer") {
+		return s
+	}
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	return emailPattern.ReplaceAllString(s, redacted)
+}
@@ -0,0 +1,45 @@
+// Package cqlmetrics reports the latency of every Cassandra query.
+package cqlmetrics
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "cassandra_query_duration_seconds",
+	Help:    "Time Cassandra took to answer each query attempt, by operation and outcome.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}, []string{"keyspace", "operation", "status"})
+
+// Observer is set as the cluster's QueryObserver. Each attempt of a query, including
+// retries and the pages of an iterator, is observed. A cluster has one observer, so
+// Next is called afterwards for other observers such as tracing.
+type Observer struct {
+	Next gocql.QueryObserver
+}
+
+func (o Observer) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	status := "ok"
+	if q.Err != nil {
+		status = "error"
+	}
+	queryDuration.WithLabelValues(q.Keyspace, operation(q.Statement), status).Observe(q.End.Sub(q.Start).Seconds())
+
+	if o.Next != nil {
+		o.Next.ObserveQuery(ctx, q)
+	}
+}
+
+// operation is the statement's first keyword, e.g. SELECT
+func operation(statement string) string {
+	fields := strings.Fields(statement)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,87 @@
+// Package metrics exposes Prometheus metrics for every service: request counts and
+// latencies per route, database connection pools and the queues logs are delivered
+// through. Metrics are kept in the default registry and served by Handler.
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels requests no route matched, so unknown paths can't create series
+const unmatchedRoute = "unmatched"
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route template and status.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time to handle HTTP requests, by route template and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Middleware counts and times every request. Routes are labeled by their template,
+// such as /businesses/:id, never by the requested path.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		requests.WithLabelValues(c.Request.Method, route, status).Inc()
+		requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format, for GET /metrics
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// RegisterDB reports the connection pool of db, e.g. open, idle and in-use connections
+// and how long callers waited for one. name tells the pools of a service apart.
+func RegisterDB(name string, db *sql.DB) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Queue is an in-memory buffer that delivers logs in the background and drops them
+// when it is full or delivery keeps failing
+type Queue interface {
+	// QueueDepth returns the number of items waiting to be delivered
+	QueueDepth() int
+	// Dropped returns the number of items that were never delivered
+	Dropped() int64
+}
+
+// RegisterQueue reports the depth and drops of a log delivery queue. name, the queue
+// label, must be unique.
+func RegisterQueue(name string, q Queue) {
+	labels := prometheus.Labels{"queue": name}
+	depth := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "log_queue_depth",
+		Help:        "Items waiting in an asynchronous log delivery queue.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(q.QueueDepth()) })
+	dropped := prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "log_queue_dropped_total",
+		Help:        "Items an asynchronous log delivery queue dropped without delivering them.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(q.Dropped()) })
+
+	prometheus.MustRegister(depth, dropped)
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// Rollup granularities
+const (
+	RollupHour = "hour"
+	RollupDay  = "day"
+)
+
+// BusinessActivityRollup counts a business's activity in one hourly or daily bucket.
+// Buckets are recomputed from the event log, so rewriting one is idempotent.
+type BusinessActivityRollup struct {
+	BusinessID  uint      `json:"business_id" gorm:"primaryKey"`
+	Granularity string    `json:"granularity" gorm:"primaryKey;size:8"`
+	BucketStart time.Time `json:"bucket_start" gorm:"primaryKey;index"`
+	Views       int64     `json:"views" gorm:"not null;default:0"`
+	Reviews     int64     `json:"reviews" gorm:"not null;default:0"`
+	Bookmarks   int64     `json:"bookmarks" gorm:"not null;default:0"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CategoryActivityRollup is the sum of the business rollups in a category
+type CategoryActivityRollup struct {
+	Category    string    `json:"category" gorm:"primaryKey"`
+	Granularity string    `json:"granularity" gorm:"primaryKey;size:8"`
+	BucketStart time.Time `json:"bucket_start" gorm:"primaryKey;index"`
+	Views       int64     `json:"views" gorm:"not null;default:0"`
+	Reviews     int64     `json:"reviews" gorm:"not null;default:0"`
+	Bookmarks   int64     `json:"bookmarks" gorm:"not null;default:0"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
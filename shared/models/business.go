@@ -18,9 +18,69 @@ type Business struct {
 	Description string         `json:"description"`
 	Rating      float32        `json:"rating" gorm:"default:0"`
 	ReviewCount int            `json:"review_count" gorm:"default:0"`
+	OwnerID     *uint          `json:"owner_id,omitempty" gorm:"index"` // User who manages the business, if claimed
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 
 	Reviews []Review `json:"reviews,omitempty" gorm:"foreignKey:BusinessID"`
 }
+
+// PublicBusiness is the representation of a business that is safe to show on public endpoints
+type PublicBusiness struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Category    string    `json:"category"`
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	Address     string    `json:"address"`
+	Phone       string    `json:"phone"`
+	Website     string    `json:"website"`
+	Description string    `json:"description"`
+	Rating      float32   `json:"rating"`
+	ReviewCount int       `json:"review_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PrivateBusiness is the representation of a business for internal and administrative use
+type PrivateBusiness struct {
+	PublicBusiness
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (b Business) ToPublic() PublicBusiness {
+	return PublicBusiness{
+		ID:          b.ID,
+		Name:        b.Name,
+		Category:    b.Category,
+		Latitude:    b.Latitude,
+		Longitude:   b.Longitude,
+		Address:     b.Address,
+		Phone:       b.Phone,
+		Website:     b.Website,
+		Description: b.Description,
+		Rating:      b.Rating,
+		ReviewCount: b.ReviewCount,
+		CreatedAt:   b.CreatedAt,
+		UpdatedAt:   b.UpdatedAt,
+	}
+}
+
+func (b Business) ToPrivate() PrivateBusiness {
+	private := PrivateBusiness{PublicBusiness: b.ToPublic()}
+	if b.DeletedAt.Valid {
+		deletedAt := b.DeletedAt.Time
+		private.DeletedAt = &deletedAt
+	}
+	return private
+}
+
+// ToPublicBusinesses maps a list of businesses to their public representation
+func ToPublicBusinesses(businesses []Business) []PublicBusiness {
+	public := make([]PublicBusiness, 0, len(businesses))
+	for _, b := range businesses {
+		public = append(public, b.ToPublic())
+	}
+	return public
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// Checkin is a visit to a business, validated against the business location
+type Checkin struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         uint      `json:"user_id" gorm:"not null;index:idx_checkins_user_business,priority:1"`
+	BusinessID     uint      `json:"business_id" gorm:"not null;index:idx_checkins_user_business,priority:2;index"`
+	Latitude       float64   `json:"latitude" gorm:"not null"`
+	Longitude      float64   `json:"longitude" gorm:"not null"`
+	DistanceMeters float64   `json:"distance_meters" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+
+	Business Business `json:"business,omitempty" gorm:"foreignKey:BusinessID"`
+}
+
+// PublicCheckin is the representation of a check-in without the client coordinates
+type PublicCheckin struct {
+	ID         uint            `json:"id"`
+	UserID     uint            `json:"user_id"`
+	BusinessID uint            `json:"business_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Business   *PublicBusiness `json:"business,omitempty"`
+}
+
+func (c Checkin) ToPublic() PublicCheckin {
+	public := PublicCheckin{
+		ID:         c.ID,
+		UserID:     c.UserID,
+		BusinessID: c.BusinessID,
+		CreatedAt:  c.CreatedAt,
+	}
+	if c.Business.ID != 0 {
+		business := c.Business.ToPublic()
+		public.Business = &business
+	}
+	return public
+}
+
+// ToPublicCheckins maps a list of check-ins to their public representation
+func ToPublicCheckins(checkins []Checkin) []PublicCheckin {
+	public := make([]PublicCheckin, 0, len(checkins))
+	for _, c := range checkins {
+		public = append(public, c.ToPublic())
+	}
+	return public
+}
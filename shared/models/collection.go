@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Collection is a user-curated, named list of bookmarked businesses
+type Collection struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	UserID      uint           `json:"user_id" gorm:"not null;index"`
+	Name        string         `json:"name" gorm:"not null"`
+	Description string         `json:"description"`
+	IsPublic    bool           `json:"is_public" gorm:"not null;default:false"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Items []CollectionItem `json:"items,omitempty" gorm:"foreignKey:CollectionID"`
+}
+
+// CollectionItem is a business saved in a collection, ordered by Position
+type CollectionItem struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CollectionID uint      `json:"collection_id" gorm:"not null;uniqueIndex:idx_collection_items_collection_business"`
+	BusinessID   uint      `json:"business_id" gorm:"not null;uniqueIndex:idx_collection_items_collection_business;index"`
+	Position     int       `json:"position" gorm:"not null;default:0"`
+	Note         string    `json:"note"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	Business Business `json:"business,omitempty" gorm:"foreignKey:BusinessID"`
+}
+
+// PublicCollection is the representation of a collection returned by the API
+type PublicCollection struct {
+	ID          uint                   `json:"id"`
+	UserID      uint                   `json:"user_id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	IsPublic    bool                   `json:"is_public"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+	Items       []PublicCollectionItem `json:"items,omitempty"`
+}
+
+// PublicCollectionItem is the representation of a collection item returned by the API
+type PublicCollectionItem struct {
+	BusinessID uint            `json:"business_id"`
+	Position   int             `json:"position"`
+	Note       string          `json:"note"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Business   *PublicBusiness `json:"business,omitempty"`
+}
+
+func (c Collection) ToPublic() PublicCollection {
+	public := PublicCollection{
+		ID:          c.ID,
+		UserID:      c.UserID,
+		Name:        c.Name,
+		Description: c.Description,
+		IsPublic:    c.IsPublic,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+	}
+	for _, item := range c.Items {
+		public.Items = append(public.Items, item.ToPublic())
+	}
+	return public
+}
+
+func (i CollectionItem) ToPublic() PublicCollectionItem {
+	public := PublicCollectionItem{
+		BusinessID: i.BusinessID,
+		Position:   i.Position,
+		Note:       i.Note,
+		CreatedAt:  i.CreatedAt,
+	}
+	if i.Business.ID != 0 {
+		business := i.Business.ToPublic()
+		public.Business = &business
+	}
+	return public
+}
+
+// ToPublicCollections maps a list of collections to their public representation
+func ToPublicCollections(collections []Collection) []PublicCollection {
+	public := make([]PublicCollection, 0, len(collections))
+	for _, c := range collections {
+		public = append(public, c.ToPublic())
+	}
+	return public
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// Erasure statuses
+const (
+	ErasurePending    = "pending"
+	ErasureInProgress = "in_progress"
+	ErasureCompleted  = "completed"
+	ErasureFailed     = "failed"
+)
+
+// ErasureRequest tracks the deletion of a user's data across every service.
+// A failed request is resumed by asking for erasure again; completed steps are skipped.
+type ErasureRequest struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	Status      string     `json:"status" gorm:"not null;default:pending"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	Steps []ErasureStep `json:"steps" gorm:"foreignKey:RequestID"`
+}
+
+// ErasureStep is the erasure of a user's data in one service
+type ErasureStep struct {
+	ID          uint       `json:"-" gorm:"primaryKey"`
+	RequestID   uint       `json:"-" gorm:"not null;uniqueIndex:idx_erasure_steps_request_service,priority:1"`
+	Service     string     `json:"service" gorm:"not null;uniqueIndex:idx_erasure_steps_request_service,priority:2"`
+	Position    int        `json:"-" gorm:"not null"`
+	Status      string     `json:"status" gorm:"not null;default:pending"`
+	Attempts    int        `json:"attempts" gorm:"not null;default:0"`
+	LastError   string     `json:"last_error,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// Follow is an edge in the social graph: FollowerID follows FolloweeID
+type Follow struct {
+	FollowerID uint      `json:"follower_id" gorm:"primaryKey"`
+	FolloweeID uint      `json:"followee_id" gorm:"primaryKey;index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Feed item kinds
+const (
+	FeedKindReview = "review"
+	// FeedKindCheckin items were written by earlier versions; check-ins are no longer
+	// fanned out and existing items are purged on migration
+	FeedKindCheckin = "checkin"
+)
+
+// FeedItem is one entry in a user's materialized activity feed.
+// Items are written once per recipient when the activity happens (fan-out on write).
+type FeedItem struct {
+	ID         uint      `json:"id" gorm:"primaryKey;index:idx_feed_items_user_created,priority:3,sort:desc"`
+	UserID     uint      `json:"user_id" gorm:"not null;index:idx_feed_items_user_created,priority:1"`
+	ActorID    uint      `json:"actor_id" gorm:"not null;index"`
+	Kind       string    `json:"kind" gorm:"not null"`
+	BusinessID uint      `json:"business_id" gorm:"not null"`
+	SubjectID  uint      `json:"subject_id" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null;index:idx_feed_items_user_created,priority:2,sort:desc"`
+}
@@ -0,0 +1,37 @@
+// Package modelstest helps service tests check what their responses expose of the
+// shared models.
+package modelstest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// piiKeys are parts of JSON keys that must never appear in a public response
+var piiKeys = []string{"email", "password"}
+
+// FindPII returns the paths, such as $.user.email, of keys in a decoded JSON body that
+// look like personal data
+func FindPII(body any) []string {
+	return findPII(body, "$")
+}
+
+func findPII(body any, at string) []string {
+	var found []string
+	switch v := body.(type) {
+	case map[string]any:
+		for key, value := range v {
+			for _, pii := range piiKeys {
+				if strings.Contains(strings.ToLower(key), pii) {
+					found = append(found, at+"."+key)
+				}
+			}
+			found = append(found, findPII(value, at+"."+key)...)
+		}
+	case []any:
+		for i, value := range v {
+			found = append(found, findPII(value, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	}
+	return found
+}
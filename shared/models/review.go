@@ -19,3 +19,81 @@ type Review struct {
 	Business Business `json:"business,omitempty" gorm:"foreignKey:BusinessID"`
 	User     User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
+
+// PublicReview is the representation of a review that is safe to show on public endpoints.
+// Associations are only included when they were preloaded.
+type PublicReview struct {
+	ID         uint            `json:"id"`
+	BusinessID uint            `json:"business_id"`
+	UserID     uint            `json:"user_id"`
+	Rating     int             `json:"rating"`
+	Text       string          `json:"text"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	Business   *PublicBusiness `json:"business,omitempty"`
+	User       *PublicUser     `json:"user,omitempty"`
+}
+
+// PrivateReview is the representation of a review returned to its author
+type PrivateReview struct {
+	ID         uint            `json:"id"`
+	BusinessID uint            `json:"business_id"`
+	UserID     uint            `json:"user_id"`
+	Rating     int             `json:"rating"`
+	Text       string          `json:"text"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	Business   *PublicBusiness `json:"business,omitempty"`
+	User       *PrivateUser    `json:"user,omitempty"`
+}
+
+func (r Review) ToPublic() PublicReview {
+	public := PublicReview{
+		ID:         r.ID,
+		BusinessID: r.BusinessID,
+		UserID:     r.UserID,
+		Rating:     r.Rating,
+		Text:       r.Text,
+		CreatedAt:  r.CreatedAt,
+		UpdatedAt:  r.UpdatedAt,
+	}
+	if r.Business.ID != 0 {
+		business := r.Business.ToPublic()
+		public.Business = &business
+	}
+	if r.User.ID != 0 {
+		user := r.User.ToPublic()
+		public.User = &user
+	}
+	return public
+}
+
+func (r Review) ToPrivate() PrivateReview {
+	private := PrivateReview{
+		ID:         r.ID,
+		BusinessID: r.BusinessID,
+		UserID:     r.UserID,
+		Rating:     r.Rating,
+		Text:       r.Text,
+		CreatedAt:  r.CreatedAt,
+		UpdatedAt:  r.UpdatedAt,
+	}
+	if r.Business.ID != 0 {
+		business := r.Business.ToPublic()
+		private.Business = &business
+	}
+	if r.User.ID != 0 {
+		user := r.User.ToPrivate()
+		private.User = &user
+	}
+	return private
+}
+
+// ToPublicReviews maps a list of reviews to their public representation
+func ToPublicReviews(reviews []Review) []PublicReview {
+	public := make([]PublicReview, 0, len(reviews))
+	for _, r := range reviews {
+		public = append(public, r.ToPublic())
+	}
+	return public
+}
@@ -17,3 +17,37 @@ type User struct {
 
 	Reviews []Review `json:"reviews,omitempty" gorm:"foreignKey:UserID"`
 }
+
+// PublicUser is the representation of a user that is safe to show on public endpoints
+type PublicUser struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PrivateUser is the representation of a user returned only to that user
+type PrivateUser struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (u User) ToPublic() PublicUser {
+	return PublicUser{
+		ID:        u.ID,
+		Name:      u.Name,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+func (u User) ToPrivate() PrivateUser {
+	return PrivateUser{
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
@@ -0,0 +1,178 @@
+// Package server runs a service's HTTP server and shuts it down gracefully. On SIGTERM
+// or SIGINT the service reports itself not ready, so load balancers stop sending it
+// traffic, then finishes in-flight requests and finally flushes and closes what the
+// service registered with OnShutdown.
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Config struct {
+	// Addr is where the server listens, e.g. ":8080"
+	Addr string
+	// ReadHeaderTimeout bounds reading a request's headers
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading a whole request, body included
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing a response. Handlers that legitimately take longer,
+	// such as streams, set their own with WriteDeadline.
+	WriteTimeout time.Duration
+	// IdleTimeout is how long keep-alive connections wait for the next request
+	IdleTimeout time.Duration
+	// DrainDelay is how long /ready fails before the server stops accepting
+	// connections, so load balancers and Kubernetes notice first
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds finishing in-flight requests and running the shutdown
+	// hooks after the drain delay
+	ShutdownTimeout time.Duration
+}
+
+// ConfigFromEnv reads the server configuration from PORT (defaultPort when unset) and
+// SERVER_* and SHUTDOWN_* environment variables
+func ConfigFromEnv(defaultPort string) Config {
+	cfg := Config{
+		Addr:              ":" + defaultPort,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		DrainDelay:        5 * time.Second,
+		ShutdownTimeout:   20 * time.Second,
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		cfg.Addr = ":" + port
+	}
+	for env, d := range map[string]*time.Duration{
+		"SERVER_READ_HEADER_TIMEOUT": &cfg.ReadHeaderTimeout,
+		"SERVER_READ_TIMEOUT":        &cfg.ReadTimeout,
+		"SERVER_WRITE_TIMEOUT":       &cfg.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":        &cfg.IdleTimeout,
+		"SHUTDOWN_DRAIN_DELAY":       &cfg.DrainDelay,
+		"SHUTDOWN_TIMEOUT":           &cfg.ShutdownTimeout,
+	} {
+		if v, err := time.ParseDuration(os.Getenv(env)); err == nil && v >= 0 {
+			*d = v
+		}
+	}
+	return cfg
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Server is a service's HTTP server
+type Server struct {
+	// HTTP is the underlying server, e.g. for RegisterOnShutdown
+	HTTP *http.Server
+
+	cfg      Config
+	draining atomic.Bool
+	hooks    []hook
+}
+
+func New(cfg Config, handler http.Handler) *Server {
+	return &Server{
+		cfg: cfg,
+		HTTP: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           handler,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+	}
+}
+
+// OnShutdown registers fn to run once in-flight requests are finished, e.g. flushing a
+// log queue or closing a connection pool. Hooks run in the order they were registered;
+// a failing hook is logged and the rest still run.
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, hook{name, fn})
+}
+
+// Draining reports whether the server is shutting down
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// CheckReady answers 503 once the server is shutting down; it goes in front of the
+// /ready handler
+func (s *Server) CheckReady(c *gin.Context) {
+	if s.Draining() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+	}
+}
+
+// Run serves until SIGTERM or SIGINT and then shuts down. It returns an error if the
+// server could not listen.
+func (s *Server) Run() error {
+	failed := make(chan error, 1)
+	go func() {
+		if err := s.HTTP.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case err := <-failed:
+		return err
+	case sig := <-quit:
+		slog.Info("Shutting down", "signal", sig.String(), "drain_delay", s.cfg.DrainDelay.String())
+	}
+
+	s.draining.Store(true)
+	select {
+	case <-time.After(s.cfg.DrainDelay):
+	case <-quit:
+		// A second signal skips the wait
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	s.Shutdown(ctx)
+	return nil
+}
+
+// Shutdown stops accepting connections, waits for in-flight requests and runs the
+// shutdown hooks, all within ctx
+func (s *Server) Shutdown(ctx context.Context) {
+	s.draining.Store(true)
+	if err := s.HTTP.Shutdown(ctx); err != nil {
+		slog.Warn("Server did not shut down cleanly", "error", err)
+	}
+	for _, h := range s.hooks {
+		if err := h.fn(ctx); err != nil {
+			slog.Warn("Shutdown step failed", "step", h.name, "error", err)
+		}
+	}
+	slog.Info("Shut down")
+}
+
+// WriteDeadline replaces the server's write timeout for one response: d from now, or
+// none when d is 0. Streams and other handlers that outlive WriteTimeout call it first.
+func WriteDeadline(c *gin.Context, d time.Duration) {
+	var deadline time.Time
+	if d > 0 {
+		deadline = time.Now().Add(d)
+	}
+	// Writers that can't set deadlines, such as response recorders, have no timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(deadline)
+}
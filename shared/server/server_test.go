@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// steps records what happened during a shutdown, in order
+type steps struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (s *steps) add(step string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, step)
+}
+
+func (s *steps) get() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.list...)
+}
+
+// newTestServer serves /ready behind CheckReady and /slow, which answers once release
+// is closed
+func newTestServer(cfg Config, started chan<- struct{}, release <-chan struct{}, log *steps) *Server {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var s *Server
+	r.GET("/ready", func(c *gin.Context) { s.CheckReady(c) }, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ready"})
+	})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		log.add("request finished")
+		c.Status(http.StatusOK)
+	})
+	s = New(cfg, r)
+	s.OnShutdown("first", func(ctx context.Context) error {
+		log.add("first hook")
+		return errors.New("queue not empty")
+	})
+	s.OnShutdown("second", func(ctx context.Context) error {
+		log.add("second hook")
+		return nil
+	})
+	return s
+}
+
+func equalSteps(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestShutdownFinishesRequestsBeforeHooks(t *testing.T) {
+	var log steps
+	started, release := make(chan struct{}), make(chan struct{})
+	s := newTestServer(Config{}, started, release, &log)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.HTTP.Serve(ln)
+	base := "http://" + ln.Addr().String()
+
+	slow := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = errors.New(resp.Status)
+			}
+		}
+		slow <- err
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		s.Shutdown(context.Background())
+		close(done)
+	}()
+
+	// Hooks wait for the request in flight
+	time.Sleep(50 * time.Millisecond)
+	if !s.Draining() {
+		t.Error("server isn't draining during shutdown")
+	}
+	if got := log.get(); len(got) != 0 {
+		t.Fatalf("%v happened while a request was in flight", got)
+	}
+	close(release)
+	<-done
+
+	if err := <-slow; err != nil {
+		t.Errorf("request in flight during shutdown failed: %v", err)
+	}
+	// A failing hook doesn't stop the ones after it
+	want := []string{"request finished", "first hook", "second hook"}
+	if got := log.get(); !equalSteps(got, want) {
+		t.Errorf("shutdown steps = %v, want %v", got, want)
+	}
+	if _, err := http.Get(base + "/ready"); err == nil {
+		t.Error("server still accepts connections after shutdown")
+	}
+}
+
+func TestShutdownTimeoutStillRunsHooks(t *testing.T) {
+	var log steps
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	s := newTestServer(Config{}, started, release, &log)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.HTTP.Serve(ln)
+	go http.Get("http://" + ln.Addr().String() + "/slow")
+	<-started
+
+	// The request never finishes; the hooks get whatever time is left
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s.Shutdown(ctx)
+
+	want := []string{"first hook", "second hook"}
+	if got := log.get(); !equalSteps(got, want) {
+		t.Errorf("shutdown steps = %v, want %v", got, want)
+	}
+}
+
+func TestRunReportsNotReadyBeforeClosing(t *testing.T) {
+	// Keep SIGTERM from ending the test binary before Run listens for it
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGTERM)
+	defer signal.Stop(guard)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var log steps
+	started, release := make(chan struct{}), make(chan struct{})
+	close(release)
+	s := newTestServer(Config{Addr: addr, DrainDelay: 300 * time.Millisecond, ShutdownTimeout: time.Second}, started, release, &log)
+
+	ran := make(chan error, 1)
+	go func() { ran <- s.Run() }()
+
+	ready := func() int {
+		resp, err := http.Get("http://" + addr + "/ready")
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for ready() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("server never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	// During the drain delay the server still answers, but not ready
+	deadline = time.Now().Add(time.Second)
+	for ready() != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("/ready never answered 503 after SIGTERM")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := log.get(); len(got) != 0 {
+		t.Errorf("%v happened before the drain delay passed", got)
+	}
+
+	select {
+	case err := <-ran:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run didn't return after SIGTERM")
+	}
+	if want := []string{"first hook", "second hook"}; !equalSteps(log.get(), want) {
+		t.Errorf("shutdown steps = %v, want %v", log.get(), want)
+	}
+	if ready() != 0 {
+		t.Error("server still accepts connections after Run returned")
+	}
+}
+
+func TestRunReturnsListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s := New(Config{Addr: ln.Addr().String()}, http.NotFoundHandler())
+	if err := s.Run(); err == nil {
+		t.Error("Run on an address in use returned nil")
+	}
+}
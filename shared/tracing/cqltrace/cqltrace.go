@@ -0,0 +1,61 @@
+// Package cqltrace records a span for every Cassandra query run within a traced request.
+// Queries only join a trace when they are given the request's context, e.g. with
+// gocqlx's Session.ContextQuery; queries without a traced context are not recorded.
+package cqltrace
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Observer is set as the cluster's QueryObserver. Each attempt of a query, including
+// retries and the pages of an iterator, is a span.
+type Observer struct{}
+
+func (Observer) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+
+	operation := operation(q.Statement)
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "cassandra"),
+		attribute.String("db.operation.name", operation),
+		// Statements have placeholders, never the bound values
+		attribute.String("db.query.text", q.Statement),
+		attribute.Int("db.response.returned_rows", q.Rows),
+		attribute.Int("db.cassandra.attempt", q.Attempt),
+	}
+	if q.Keyspace != "" {
+		attrs = append(attrs, attribute.String("db.namespace", q.Keyspace))
+	}
+	if q.Host != nil {
+		attrs = append(attrs, attribute.String("server.address", q.Host.ConnectAddress().String()))
+	}
+
+	_, span := otel.Tracer("github.com/yelp-sample-v2/shared/tracing/cqltrace").Start(ctx, "cassandra "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(q.Start),
+		trace.WithAttributes(attrs...),
+	)
+	if q.Err != nil {
+		span.RecordError(q.Err)
+		span.SetStatus(codes.Error, q.Err.Error())
+	}
+	span.End(trace.WithTimestamp(q.End))
+}
+
+// operation is the statement's first keyword, e.g. SELECT
+func operation(statement string) string {
+	fields := strings.Fields(statement)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,84 @@
+// Package gormtrace records a span for every GORM statement run within a traced request.
+// Statements only join a trace when the request's context is passed with
+// db.WithContext; work without a traced context is not recorded.
+package gormtrace
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "gormtrace:span"
+
+// Plugin is registered with db.Use
+type Plugin struct{}
+
+func (Plugin) Name() string {
+	return "gormtrace"
+}
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	tracer := otel.Tracer("github.com/yelp-sample-v2/shared/tracing/gormtrace")
+	cb := db.Callback()
+
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("gormtrace:before_create", before(tracer, "create")),
+		cb.Create().After("gorm:create").Register("gormtrace:after_create", after),
+		cb.Query().Before("gorm:query").Register("gormtrace:before_query", before(tracer, "query")),
+		cb.Query().After("gorm:query").Register("gormtrace:after_query", after),
+		cb.Update().Before("gorm:update").Register("gormtrace:before_update", before(tracer, "update")),
+		cb.Update().After("gorm:update").Register("gormtrace:after_update", after),
+		cb.Delete().Before("gorm:delete").Register("gormtrace:before_delete", before(tracer, "delete")),
+		cb.Delete().After("gorm:delete").Register("gormtrace:after_delete", after),
+		cb.Row().Before("gorm:row").Register("gormtrace:before_row", before(tracer, "row")),
+		cb.Row().After("gorm:row").Register("gormtrace:after_row", after),
+		cb.Raw().Before("gorm:raw").Register("gormtrace:before_raw", before(tracer, "raw")),
+		cb.Raw().After("gorm:raw").Register("gormtrace:after_raw", after),
+	)
+}
+
+func before(tracer trace.Tracer, operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		ctx, span := tracer.Start(ctx, "gorm "+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", db.Dialector.Name()),
+				attribute.String("db.operation.name", operation),
+			),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func after(db *gorm.DB) {
+	value, _ := db.InstanceGet(spanKey)
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	db.InstanceSet(spanKey, nil)
+	defer span.End()
+
+	if db.Statement.Table != "" {
+		span.SetAttributes(attribute.String("db.collection.name", db.Statement.Table))
+	}
+	// The SQL has placeholders, never the bound values
+	span.SetAttributes(
+		attribute.String("db.query.text", db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
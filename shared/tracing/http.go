@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID between services and back to the client
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside of one
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestID returns a context whose outgoing requests carry id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// validRequestID accepts the IDs callers may choose: short and safe to put in logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware starts a server span for each request, continuing the caller's trace, and
+// gives the request an ID. A valid X-Request-ID from the caller is kept; otherwise the
+// trace ID is used. The ID is echoed in the response and forwarded on proxied and
+// outgoing requests.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := c.Request
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+		name := req.Method
+		if route := c.FullPath(); route != "" {
+			name += " " + route
+		}
+		ctx, span := tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("http.route", c.FullPath()),
+				attribute.String("url.path", req.URL.Path),
+				attribute.String("client.address", c.ClientIP()),
+				attribute.String("user_agent.original", req.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = span.SpanContext().TraceID().String()
+		}
+		span.SetAttributes(attribute.String("request.id", id))
+
+		req.Header.Set(RequestIDHeader, id)
+		c.Request = req.WithContext(WithRequestID(ctx, id))
+		c.Header(RequestIDHeader, id)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if err := c.Errors.Last(); err != nil {
+			span.RecordError(err.Err)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// NewTransport wraps base (http.DefaultTransport when nil) so every request gets a
+// client span and carries the trace context and request ID of its context. peer names
+// the service called in span names; when empty, the request's host is used.
+func NewTransport(peer string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(requestIDTransport{base},
+		otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			if peer == "" {
+				return req.Method + " " + req.URL.Host
+			}
+			return req.Method + " " + peer
+		}),
+	)
+}
+
+// requestIDTransport forwards the request ID of the request's context
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := RequestID(req.Context()); id != "" && req.Header.Get(RequestIDHeader) != id {
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, id)
+	}
+	return t.base.RoundTrip(req)
+}
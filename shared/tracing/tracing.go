@@ -0,0 +1,140 @@
+// Package tracing gives every service request IDs and OpenTelemetry traces. Incoming
+// W3C traceparent headers are continued, outgoing requests carry them on, and spans
+// are written to stdout or to a file in the OTLP JSON format for local use.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer of the spans this package starts
+const instrumentation = "github.com/yelp-sample-v2/shared/tracing"
+
+// Where finished spans go
+const (
+	// ExporterNone drops spans; request IDs and traceparent propagation still work
+	ExporterNone = "none"
+	// ExporterStdout writes every span to stdout as JSON
+	ExporterStdout = "stdout"
+	// ExporterFile appends spans to a file in the OTLP JSON format, which the
+	// OpenTelemetry Collector's otlpjsonfile receiver and most trace viewers can read
+	ExporterFile = "file"
+)
+
+type Config struct {
+	// Service is recorded as service.name on every span
+	Service  string
+	Exporter string
+	// File is where ExporterFile writes
+	File string
+	// SampleRatio is the share of new traces that are recorded. Traces started
+	// upstream keep the caller's decision.
+	SampleRatio float64
+}
+
+// ConfigFromEnv reads the tracing configuration from TRACING_* environment variables
+func ConfigFromEnv(service string) Config {
+	cfg := Config{
+		Service:     service,
+		Exporter:    os.Getenv("TRACING_EXPORTER"),
+		File:        os.Getenv("TRACING_FILE"),
+		SampleRatio: 1,
+	}
+	if cfg.Exporter == "" {
+		cfg.Exporter = ExporterNone
+	}
+	if cfg.File == "" {
+		cfg.File = "traces.jsonl"
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("TRACING_SAMPLE_RATIO"), 64); err == nil && f >= 0 && f <= 1 {
+		cfg.SampleRatio = f
+	}
+	return cfg
+}
+
+var provider *sdktrace.TracerProvider
+
+// Start installs the global tracer provider and the W3C trace context propagator
+func Start(cfg Config) error {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.Service))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+
+	switch cfg.Exporter {
+	case ExporterNone:
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case ExporterFile:
+		exporter, err := otlptrace.New(context.Background(), &fileClient{path: cfg.File})
+		if err != nil {
+			return fmt.Errorf("trace file %s: %w", cfg.File, err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	default:
+		return fmt.Errorf("unknown TRACING_EXPORTER %q: want none, stdout or file", cfg.Exporter)
+	}
+
+	provider = sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
+
+// Close exports the spans that are still buffered
+func Close(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// maxLinks bounds the requests a batch span links to
+const maxLinks = 128
+
+// StartBatch starts a span for work done on behalf of many requests, such as delivering
+// a batch of queued logs. It has no parent; instead it links to the spans of the
+// requests, so each of their traces leads to it.
+func StartBatch(name string, requests []trace.SpanContext, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	type key struct {
+		traceID trace.TraceID
+		spanID  trace.SpanID
+	}
+	seen := map[key]bool{}
+	var links []trace.Link
+	for _, sc := range requests {
+		id := key{sc.TraceID(), sc.SpanID()}
+		if !sc.IsValid() || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if links = append(links, trace.Link{SpanContext: sc}); len(links) == maxLinks {
+			break
+		}
+	}
+	return tracer().Start(context.Background(), name,
+		trace.WithNewRoot(),
+		trace.WithLinks(links...),
+		trace.WithAttributes(attrs...),
+	)
+}